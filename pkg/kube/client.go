@@ -16,21 +16,41 @@ package kube
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	"github.com/hashicorp/go-multierror"
+	kubeApiAdmission "k8s.io/api/admissionregistration/v1beta1"
+	kubeApiApps "k8s.io/api/apps/v1"
+	kubeApiAuthorization "k8s.io/api/authorization/v1"
 	kubeApiCore "k8s.io/api/core/v1"
 	kubeExtClient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	kubeApiErrors "k8s.io/apimachinery/pkg/api/errors"
 	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	kubeVersion "k8s.io/apimachinery/pkg/version"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/printers"
 	"k8s.io/cli-runtime/pkg/resource"
@@ -53,8 +73,15 @@ import (
 const (
 	defaultLocalAddress = "localhost"
 	fieldManager        = "istio-kube-client"
+
+	// defaultConcurrency bounds the number of concurrent requests made to pods by a single operation.
+	defaultConcurrency = 10
 )
 
+// ErrNoIstioPods is returned, possibly wrapped, when no running pod of the Istio control plane is found,
+// typically because Istio is not installed in the namespace.
+var ErrNoIstioPods = errors.New("no running Istio pods")
+
 // Client is a helper for common Kubernetes client operations
 type Client interface {
 	kubernetes.Interface
@@ -65,71 +92,485 @@ type Client interface {
 	// Rest returns the raw Kubernetes REST client.
 	REST() rest.Interface
 
+	// RESTClientFor returns a REST client for the given API group and version, such as
+	// networking.istio.io/v1beta1. The client decodes the types registered in the client-go scheme, other
+	// responses can be read raw.
+	RESTClientFor(gv schema.GroupVersion) (rest.Interface, error)
+
 	// Ext returns the API extensions client.
 	Ext() kubeExtClient.Interface
 
 	// Dynamic client.
 	Dynamic() dynamic.Interface
 
+	// Factory returns the kubectl factory the clients are created from. It is an escape hatch for callers
+	// needing kubectl machinery not otherwise exposed by the Client, such as to build kubectl commands.
+	// It is the factory given to NewClient, with the options of the Client applied to its REST config.
+	Factory() util.Factory
+
 	// Revision of the Istio control plane.
 	Revision() string
 
+	// Preflight returns an error unless the API server is reachable and the client may list the pods of the
+	// control plane namespace. If istioNamespace is empty, it is found with DiscoverIstioNamespace.
+	Preflight(ctx context.Context, istioNamespace string) error
+
 	// GetKubernetesVersion returns the Kubernetes server version
 	GetKubernetesVersion() (*kubeVersion.Info, error)
 
+	// DetectCNI detects the CNI plugin installed in the cluster from the kube-system DaemonSets.
+	DetectCNI(ctx context.Context) (CNIInfo, error)
+
 	// EnvoyDo makes an http request to the Envoy in the specified pod.
 	EnvoyDo(ctx context.Context, podName, podNamespace, method, path string, body []byte) ([]byte, error)
 
+	// EnvoyDoWithOptions makes an http request to the Envoy in the specified pod, customized by the given options.
+	EnvoyDoWithOptions(ctx context.Context, podName, podNamespace, method, path string, body []byte,
+		opts ...EnvoyDoOption) ([]byte, error)
+
+	// DiscoveryDo makes an http request to the named Istio discovery instance.
+	DiscoveryDo(ctx context.Context, pilotName, pilotNamespace, path string) ([]byte, error)
+
+	// GetProxyServerInfo returns the state, version and uptime of the Envoy server of the proxy, from the Envoy
+	// /server_info endpoint.
+	GetProxyServerInfo(ctx context.Context, podName, podNamespace string) (*ServerInfo, error)
+
+	// DrainProxy makes the Envoy of the proxy drain its listeners, like a proxy being shut down does. It returns
+	// an error if the Envoy admin refuses the request.
+	DrainProxy(ctx context.Context, podName, podNamespace string) error
+
+	// QuitProxy makes the Envoy of the proxy exit. It returns an error if the Envoy admin refuses the request.
+	QuitProxy(ctx context.Context, podName, podNamespace string) error
+
+	// GetProxyLogLevels returns the log level of every logger of the Envoy of the proxy, keyed by logger name.
+	GetProxyLogLevels(ctx context.Context, podName, podNamespace string) (map[string]string, error)
+
+	// SetProxyLogLevel sets the level of the given logger of the Envoy of the proxy, or of all its loggers if
+	// logger is empty.
+	SetProxyLogLevel(ctx context.Context, podName, podNamespace, logger, level string) error
+
+	// GetProxyRuntime returns the values of the runtime keys of the Envoy of the proxy, once all its runtime
+	// layers are applied.
+	GetProxyRuntime(ctx context.Context, podName, podNamespace string) (map[string]string, error)
+
+	// GetProxyMemory returns the memory allocation statistics of the Envoy of the proxy.
+	GetProxyMemory(ctx context.Context, podName, podNamespace string) (*MemoryStats, error)
+
+	// ProxyAdminRequest sends a request to the Envoy admin of the proxy by running `pilot-agent request` in its
+	// istio-proxy container, for pods whose admin port can't be port forwarded to.
+	ProxyAdminRequest(ctx context.Context, podName, podNamespace, method, path string) ([]byte, error)
+
+	// GetUnstructured gets a resource of any type through the dynamic client.
+	GetUnstructured(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) (*unstructured.Unstructured, error)
+
+	// ListUnstructured lists the resources of any type through the dynamic client.
+	ListUnstructured(ctx context.Context, gvr schema.GroupVersionResource, namespace string,
+		opts kubeApiMeta.ListOptions) (*unstructured.UnstructuredList, error)
+
+	// ApplyUnstructured server-side applies the object, forcing ownership of its fields to the Istio field manager.
+	// The resource of the object is resolved from its kind.
+	ApplyUnstructured(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+
+	// ListIstioResources lists the Istio resources of the kind, such as VirtualService, in the namespace.
+	// The namespace is ignored for cluster-scoped kinds.
+	ListIstioResources(ctx context.Context, kind, namespace string) ([]unstructured.Unstructured, error)
+
+	// GetProxyConfigStatus gets the version of the clusters, listeners and routes accepted by the proxy,
+	// and the updates it rejected.
+	GetProxyConfigStatus(ctx context.Context, podName, podNamespace string) (*ConfigStatus, error)
+
+	// GetProxyConnections gets the number of active downstream connections of the listeners of the proxy, and
+	// of active upstream connections of its clusters.
+	GetProxyConnections(ctx context.Context, podName, podNamespace string) (downstream, upstream int64, err error)
+
+	// GetInjectionTemplate gets the sidecar template of the injector config of the revision, read from the
+	// istio-sidecar-injector ConfigMap of the namespace, suffixed by the revision unless it is the default one.
+	GetInjectionTemplate(ctx context.Context, namespace, revision string) (string, error)
+
+	// GetProxyRestartEpoch gets the hot restart epoch of the Envoy process of the proxy, which is 0 until the
+	// proxy is hot restarted, for instance to apply a new bootstrap config.
+	GetProxyRestartEpoch(ctx context.Context, podName, podNamespace string) (int, error)
+
+	// ListGatewayAPIGateways lists the Kubernetes Gateway API Gateways in the namespace, or in all namespaces
+	// if it is empty. ErrGatewayAPINotInstalled is returned if the Gateway API CRDs are not installed.
+	ListGatewayAPIGateways(ctx context.Context, namespace string) ([]unstructured.Unstructured, error)
+
+	// ListHTTPRoutes lists the Kubernetes Gateway API HTTPRoutes in the namespace, or in all namespaces
+	// if it is empty. ErrGatewayAPINotInstalled is returned if the Gateway API CRDs are not installed.
+	ListHTTPRoutes(ctx context.Context, namespace string) ([]unstructured.Unstructured, error)
+
+	// ListOpenShiftRoutes lists the OpenShift Routes in the namespace, or in all namespaces if it is empty.
+	// ErrNotOpenShift is returned if the cluster does not serve Routes.
+	ListOpenShiftRoutes(ctx context.Context, namespace string) ([]unstructured.Unstructured, error)
+
+	// IsProxyReady queries the readiness endpoint of the sidecar in the given pod, port 15021 by default, and
+	// returns whether it reports ready along with the body of its response.
+	IsProxyReady(ctx context.Context, podName, podNamespace string, opts ...EnvoyDoOption) (bool, string, error)
+
 	// AllDiscoveryDo makes an http request to each Istio discovery instance.
 	AllDiscoveryDo(ctx context.Context, namespace, path string) (map[string][]byte, error)
 
+	// DiscoverIstioNamespace finds the namespace the Istio control plane is running in.
+	DiscoverIstioNamespace(ctx context.Context) (string, error)
+
+	// CheckIstiodConsistency compares the config held by every istiod instance in the namespace. It returns
+	// whether they all agree, along with the config version of each instance.
+	CheckIstiodConsistency(ctx context.Context, namespace string) (bool, map[string]string, error)
+
+	// GetProxySyncStatus returns the sync status of every proxy connected to the istiod instances in
+	// istiodNamespace, sorted by proxy ID. Proxies reported by several instances are returned once.
+	GetProxySyncStatus(ctx context.Context, istiodNamespace string) ([]SyncStatus, error)
+
+	// WatchProxySyncStatus polls the sync status of the proxies connected to the istiod instances in the namespace
+	// and calls fn with the first status and every time it changes, until ctx is cancelled. Transient failures,
+	// such as istiod being unreachable or answering with a 5xx, are logged and the next poll is attempted; any
+	// other failure ends the watch and is returned.
+	WatchProxySyncStatus(ctx context.Context, namespace string, fn func([]SyncStatus), opts ...SyncStatusWatchOption) error
+
+	// FindProxyController returns the name of the istiod pod the proxy, identified like in the sync status, is
+	// connected to. A proxy reported by several istiod instances is resolved like GetProxySyncStatus does.
+	FindProxyController(ctx context.Context, istiodNamespace, proxyID string) (string, error)
+
+	// GetDeltaXDSStats gets the incremental xDS push statistics reported by each Istio discovery instance.
+	// ErrDeltaXDSUnsupported is returned if the control plane does not expose them.
+	GetDeltaXDSStats(ctx context.Context, namespace string) ([]DeltaXDSStat, error)
+
 	// GetIstioVersions gets the version for each Istio control plane component.
 	GetIstioVersions(ctx context.Context, namespace string) (*version.MeshInfo, error)
 
+	// GetIstioPodVersions is like GetIstioVersions, but also reports the pod which reported each version.
+	GetIstioPodVersions(ctx context.Context, namespace string) ([]PodVersion, error)
+
+	// CheckVersionCompatibility returns the components of the control plane in namespace whose major version
+	// differs from the version of the client, or whose minor version differs by more than maxMinorSkew, such as
+	// DefaultMaxMinorVersionSkew.
+	CheckVersionCompatibility(ctx context.Context, namespace string, maxMinorSkew int) ([]VersionMismatch, error)
+
+	// GetEffectiveSamplingRate returns the trace sampling percentage applied to the given pod, taking into
+	// account Telemetry resources, the proxy config annotation and the mesh defaults.
+	GetEffectiveSamplingRate(ctx context.Context, namespace, podName string) (float64, error)
+
+	// ListPodsByProxyVersion lists the pods in the namespace whose Envoy reports the given version.
+	ListPodsByProxyVersion(ctx context.Context, namespace, version string) ([]kubeApiCore.Pod, error)
+
+	// GetProxyLocality returns the locality of the proxy in the given pod.
+	GetProxyLocality(ctx context.Context, namespace, podName string) (Locality, error)
+
+	// GetPod returns the named pod.
+	GetPod(ctx context.Context, namespace, name string) (*kubeApiCore.Pod, error)
+
 	// PodsForSelector finds pods matching selector.
 	PodsForSelector(ctx context.Context, namespace string, labelSelectors ...string) (*kubeApiCore.PodList, error)
 
+	// WatchPods calls onEvent for every pod matching labelSelector that is added, modified or deleted, until
+	// ctx is cancelled. Expired watches are re-established.
+	WatchPods(ctx context.Context, namespace, labelSelector string, onEvent func(watch.EventType, *kubeApiCore.Pod)) error
+
 	// GetIstioPods retrieves the pod objects for Istio deployments
 	GetIstioPods(ctx context.Context, namespace string, params map[string]string) ([]kubeApiCore.Pod, error)
 
+	// GetIstioPodsRunning retrieves the running pods with the given labels, of the revision of the client if it
+	// has one.
+	GetIstioPodsRunning(ctx context.Context, namespace string, extraLabels map[string]string) ([]kubeApiCore.Pod, error)
+
+	// GetGatewayPods retrieves the pods of the gateways of the given type, IngressGateway or EgressGateway, of the
+	// revision of the client if it has one.
+	GetGatewayPods(ctx context.Context, namespace, gatewayType string) ([]kubeApiCore.Pod, error)
+
+	// GetIstioPodsMatching retrieves the pods matching any of the given selectors, de-duplicated.
+	GetIstioPodsMatching(ctx context.Context, namespace string, selectors []labels.Selector) ([]kubeApiCore.Pod, error)
+
+	// PodExecCombined runs the command in the container like PodExec, returning its standard output and error
+	// interleaved in the order they were written, like a terminal shows them.
+	PodExecCombined(ctx context.Context, podName, podNamespace, container, command string) (string, error)
+
+	// PodExecWithEnv runs the command in the container like PodExec, with the given environment variables set
+	// by wrapping it with env. If container is empty, the default container of the pod is used.
+	// Exec runs the arguments without a shell, so values are not shell-escaped: each KEY=VALUE reaches env as a
+	// single argument, verbatim. Names must match [A-Za-z_][A-Za-z0-9_]*, and the command can't contain "=".
+	PodExecWithEnv(ctx context.Context, podName, podNamespace, container string, env map[string]string,
+		command []string) (stdout string, stderr string, err error)
+
+	// PodReachability requests the URL from the container of the source pod, with curl or else wget, and
+	// returns the status code and body of the response. If container is empty, the default container of the
+	// pod is used, like PodExec.
+	PodReachability(ctx context.Context, srcPod, srcNamespace, container, targetURL string) (int, string, error)
+
 	// PodExec takes a command and the pod data to run the command in the specified pod.
-	PodExec(podName, podNamespace, container string, command string) (stdout string, stderr string, err error)
+	// If container is empty, the container named by the kubectl.kubernetes.io/default-container annotation
+	// of the pod, or else its first container, is used.
+	// Options, such as WithTransientErrorRetry, customize how the command is run.
+	PodExec(podName, podNamespace, container string, command string, opts ...PodExecOption) (stdout string, stderr string, err error)
+
+	// CopyToPod copies the local file or directory at srcLocalPath to destPath in the container, using tar.
+	// The parent directory of destPath must exist in the container.
+	CopyToPod(ctx context.Context, namespace, podName, container, srcLocalPath, destPath string) error
 
-	// PodLogs retrieves the logs for the given pod.
+	// CopyFromPod copies the file or directory at srcPath in the container to destLocalPath, using tar.
+	CopyFromPod(ctx context.Context, namespace, podName, container, srcPath, destLocalPath string) error
+
+	// PodLogs retrieves the logs for the given pod. If no container of the pod is named container, the logs of
+	// the only container whose name contains it are retrieved, so that "proxy" selects "istio-proxy".
 	PodLogs(ctx context.Context, podName string, podNamespace string, container string, previousLog bool) (string, error)
 
+	// GetCrashedContainerLogs retrieves the logs of the previous instance of the container of the given pod,
+	// and the number of times the container restarted. The logs are empty if the container never restarted.
+	// The container is matched like PodLogs does.
+	GetCrashedContainerLogs(ctx context.Context, podName, podNamespace, container string) (string, int32, error)
+
+	// AllContainerLogs retrieves the logs of every container of the given pod, including init containers, keyed
+	// by container name. Containers which have not started yet are omitted.
+	AllContainerLogs(ctx context.Context, podName, podNamespace string) (map[string]string, error)
+
+	// CollectLogs retrieves the logs of the container of every pod matching the label selector, keyed by
+	// "namespace/name", fetching a bounded number of pods at once. If container is empty, the default container
+	// of each pod is used, so sidecar logs must be requested explicitly, such as with "istio-proxy". If
+	// tailLines > 0, only the last lines are returned. The logs of the other pods are returned along with the errors.
+	CollectLogs(ctx context.Context, namespace, selector, container string, tailLines int64) (map[string]string, error)
+
 	// NewPortForwarder creates a new PortForwarder configured for the given pod. If localPort=0, a port will be
 	// dynamically selected. If localAddress is empty, "localhost" is used.
-	NewPortForwarder(podName string, ns string, localAddress string, localPort int, podPort int) (PortForwarder, error)
+	// Options, such as WithAutoReconnect, customize the forwarder.
+	NewPortForwarder(podName string, ns string, localAddress string, localPort int, podPort int,
+		opts ...PortForwarderOption) (PortForwarder, error)
+
+	// NewServicePortForwarder creates a new PortForwarder to a ready pod backing the service, forwarding to the
+	// container port targeted by servicePort. Named target ports are resolved from the ports of the containers.
+	NewServicePortForwarder(serviceName, ns, localAddress string, localPort, servicePort int,
+		opts ...PortForwarderOption) (PortForwarder, error)
+
+	// GetProxyStats returns the stats of the proxy in the given pod whose name matches the filter regex,
+	// or all of them if filter is empty. Options, such as WithPrometheusFormat, customize the request.
+	GetProxyStats(ctx context.Context, podName, podNamespace string, filter string,
+		opts ...ProxyStatsOption) (map[string]float64, error)
+
+	// GetProxyEndpoints returns the endpoints of the cluster of the proxy, with their current health and weight,
+	// from the Envoy /clusters endpoint. An empty clusterFilter returns the endpoints of all the clusters.
+	GetProxyEndpoints(ctx context.Context, podName, podNamespace, clusterFilter string) ([]Endpoint, error)
+
+	// GetProxyLoadBalancingWeights returns the endpoints of the cluster of the proxy in the given pod, with their
+	// load balancing weights, as found in the EDS config dump of the proxy.
+	GetProxyLoadBalancingWeights(ctx context.Context, namespace, podName, cluster string) ([]EndpointWeight, error)
+
+	// GetProxyListeners returns the active listeners of the proxy in the given pod.
+	GetProxyListeners(ctx context.Context, podName, podNamespace string) ([]*listenerv3.Listener, error)
+
+	// GetProxyListenerErrors returns the listener updates rejected by the Envoy of the proxy, such as those of
+	// listeners binding the address of another listener.
+	GetProxyListenerErrors(ctx context.Context, podName, podNamespace string) ([]ListenerError, error)
+
+	// ResolveProxyCluster returns the name of the outbound cluster of the proxy for the given service FQDN and
+	// port, and false if the proxy has no such cluster.
+	ResolveProxyCluster(ctx context.Context, podName, podNamespace, fqdn string, port int) (string, bool, error)
+
+	// GetProxyRoutes returns the dynamic route configurations of the proxy in the given pod.
+	GetProxyRoutes(ctx context.Context, podName, podNamespace string) ([]*routev3.RouteConfiguration, error)
+
+	// GetProxyCerts returns the CA and workload certificates loaded by the proxy in the given pod.
+	GetProxyCerts(ctx context.Context, podName, podNamespace string) ([]ProxyCert, error)
+
+	// GetProxyBootstrap returns the JSON bootstrap config the proxy in the given pod was started with.
+	GetProxyBootstrap(ctx context.Context, podName, podNamespace string) ([]byte, error)
+
+	// GetProxyConfigDumpFiltered returns the config dump of the proxy in the given pod, restricted to the
+	// resourceType field, such as "dynamic_active_clusters", and to the resources whose name matches nameRegex.
+	// Empty filters are not applied.
+	GetProxyConfigDumpFiltered(ctx context.Context, podName, podNamespace, resourceType, nameRegex string) ([]byte, error)
+
+	// GetAllProxyConfigDumps returns the config dumps of the proxies of all the running injected pods of the
+	// namespace, keyed by namespace/name of the pod. Dumps which could be retrieved are returned with the errors.
+	GetAllProxyConfigDumps(ctx context.Context, namespace string) (map[string][]byte, error)
+
+	// DiffProxyConfig returns a unified diff between the config dumps of the proxies in the two pods. Update
+	// timestamps and xDS versions are ignored, so that an empty diff means both proxies have the same config.
+	DiffProxyConfig(ctx context.Context, podA, namespaceA, podB, namespaceB string) (string, error)
+
+	// GetProxyInboundCluster returns the config of the inbound cluster for the port of the proxy in the given pod.
+	GetProxyInboundCluster(ctx context.Context, namespace, podName string, port int) (*clusterv3.Cluster, error)
+
+	// GetProxyCircuitBreakerStatus returns the circuit breaker thresholds and outlier detection ejections of
+	// every cluster of the proxy in the given pod.
+	GetProxyCircuitBreakerStatus(ctx context.Context, namespace, podName string) ([]CircuitBreakerStatus, error)
+
+	// GetExtensionProviders returns the extension providers configured in the mesh config of the client's revision.
+	GetExtensionProviders(ctx context.Context, namespace string) ([]ExtensionProvider, error)
+
+	// GetNamespaceLabels returns the labels of the namespace.
+	GetNamespaceLabels(ctx context.Context, namespace string) (map[string]string, error)
+
+	// AddNamespaceLabel sets the label of the namespace to the given value, leaving its other labels untouched.
+	AddNamespaceLabel(ctx context.Context, namespace, key, value string) error
+
+	// RemoveNamespaceLabel removes the label from the namespace, leaving its other labels untouched. Removing a
+	// label the namespace doesn't have is not an error.
+	RemoveNamespaceLabel(ctx context.Context, namespace, key string) error
+
+	// GetInjectionStatus returns whether the labels of the namespace enable sidecar injection, and for
+	// which revision.
+	GetInjectionStatus(ctx context.Context, namespace string) (InjectionStatus, error)
+
+	// CreateNamespaceWithInjection creates the namespace, labeled for injection by the default revision if
+	// revision is empty, or else by the given revision. The labels of an existing namespace are updated.
+	CreateNamespaceWithInjection(ctx context.Context, name, revision string) error
+
+	// GetMutatingWebhookOrder returns the mutating webhooks that would be called for a pod with the given labels
+	// created in namespace, in the order the API server invokes them.
+	GetMutatingWebhookOrder(ctx context.Context, namespace string, podLabels map[string]string) ([]WebhookMatch, error)
+
+	// ResolveInjectingRevision returns the control plane revision whose sidecar injector would inject pods
+	// created in namespace, or "default" for the control plane installed without a revision.
+	ResolveInjectingRevision(ctx context.Context, namespace string) (string, error)
+
+	// GetInjectionWebhook returns the MutatingWebhookConfiguration of the sidecar injector of the control plane
+	// revision, or of the control plane installed without a revision if revision is empty or "default".
+	GetInjectionWebhook(ctx context.Context, revision string) (*kubeApiAdmission.MutatingWebhookConfiguration, error)
+
+	// PreviewInjection returns the spec of a pod created from podTemplate in namespace, after the mutating
+	// webhooks, including the sidecar injector, have been applied. The pod is created with a server-side dry run.
+	PreviewInjection(ctx context.Context, namespace string, podTemplate kubeApiCore.PodTemplateSpec) (*kubeApiCore.PodSpec, error)
+
+	// GetDeployment returns the named deployment.
+	GetDeployment(ctx context.Context, namespace, name string) (*kubeApiApps.Deployment, error)
+
+	// ListIstioDeployments returns the deployments of Istio components, such as istiod and the gateways,
+	// identified by their istio label and sorted by namespace and name.
+	ListIstioDeployments(ctx context.Context, namespace string) ([]kubeApiApps.Deployment, error)
+
+	// ScaleDeployment sets the number of replicas of the deployment through its scale subresource.
+	ScaleDeployment(ctx context.Context, namespace, name string, replicas int32) error
+
+	// RestartDeployment triggers a rolling restart of the deployment, like `kubectl rollout restart`.
+	RestartDeployment(ctx context.Context, namespace, name string) error
+
+	// GetSecret returns the named secret.
+	GetSecret(ctx context.Context, namespace, name string) (*kubeApiCore.Secret, error)
+
+	// GetCertFromSecret parses the first PEM encoded certificate stored under key in the named secret.
+	GetCertFromSecret(ctx context.Context, namespace, name, key string) (*x509.Certificate, error)
+
+	// RotateCACert validates and writes the given CA certificate, key and root certificate to the cacerts
+	// secret in the namespace. Istiod only uses the new CA once restarted: if restartIstiod, the istiod
+	// deployments of the namespace are restarted after the secret is written.
+	RotateCACert(ctx context.Context, namespace string, newCert, newKey, newRoot []byte, restartIstiod bool) error
+
+	// WaitForCRDsEstablished waits until all the named CRDs have the Established condition, or ctx is done.
+	// The names of the CRDs which are still not established are returned in the error.
+	WaitForCRDsEstablished(ctx context.Context, crdNames ...string) error
 
 	// ApplyYAMLFiles applies the resources in the given YAML files.
 	ApplyYAMLFiles(namespace string, yamlFiles ...string) error
 
+	// ApplyYAMLDir applies the resources in the .yaml and .yml files of the directory, and of its subdirectories
+	// if recursive, like kubectl apply -R. Files are applied in lexical order of their paths.
+	ApplyYAMLDir(namespace, dir string, recursive bool) error
+
 	// ApplyYAMLFilesDryRun performs a dry run for applying the resource in the given YAML files
 	ApplyYAMLFilesDryRun(namespace string, yamlFiles ...string) error
 
+	// ApplyYAMLDryRunResult performs a server-side dry run for applying the resources in the given YAML, and
+	// returns the objects the server would produce.
+	ApplyYAMLDryRunResult(ctx context.Context, namespace string, yaml io.Reader) ([]*unstructured.Unstructured, error)
+
+	// ApplyYAMLFilesWithOptions applies the resources in the given YAML files, customized by the given options.
+	ApplyYAMLFilesWithOptions(namespace string, opts ApplyOptions, yamlFiles ...string) error
+
+	// DiffYAMLFiles returns a unified diff between the live resources and the result of applying the given
+	// YAML files, computed with a server-side dry run.
+	DiffYAMLFiles(ctx context.Context, namespace string, yamlFiles ...string) (string, error)
+
 	// DeleteYAMLFiles deletes the resources in the given YAML files.
 	DeleteYAMLFiles(namespace string, yamlFiles ...string) error
 
 	// DeleteYAMLFilesDryRun performs a dry run for deleting the resources in the given YAML files.
 	DeleteYAMLFilesDryRun(namespace string, yamlFiles ...string) error
+
+	// DeleteYAMLFilesWithOptions deletes the resources in the given YAML files, customized by the given options.
+	DeleteYAMLFilesWithOptions(namespace string, opts DeleteOptions, yamlFiles ...string) error
+
+	// DeleteByLabel deletes the resources of the given types matching labelSelector in the namespace, or in all
+	// namespaces if namespace is empty. labelSelector must not be empty.
+	DeleteByLabel(ctx context.Context, namespace, labelSelector string, gvrs ...schema.GroupVersionResource) error
+
+	// WaitForResourceDeleted waits until the named resource doesn't exist anymore, or ctx is done. The namespace
+	// of cluster scoped resources is empty.
+	WaitForResourceDeleted(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) error
+}
+
+// CascadeStrategy controls what happens to the dependents of a deleted resource.
+type CascadeStrategy string
+
+const (
+	// CascadeBackground deletes the dependents in the background, after the owner is deleted.
+	CascadeBackground CascadeStrategy = "background"
+
+	// CascadeForeground deletes the dependents before the owner, which is only deleted once they are gone.
+	CascadeForeground CascadeStrategy = "foreground"
+
+	// CascadeOrphan leaves the dependents in place, removing their owner references.
+	CascadeOrphan CascadeStrategy = "orphan"
+)
+
+// ApplyOptions customizes the application of resources. The zero value matches the behavior of ApplyYAMLFiles.
+type ApplyOptions struct {
+	// Output receives the result of applying every object, such as "configmap/istio created", as it happens.
+	// If nil, the output is discarded.
+	Output io.Writer
+
+	// PruneSelector enables pruning: once all the files are applied, the objects matching this label selector
+	// which are not in the files are deleted, like `kubectl apply --prune -l`.
+	PruneSelector string
+
+	// PruneAllowlist restricts pruning to the given kinds, so that other objects matching PruneSelector are
+	// left alone. It is required when PruneSelector is set.
+	PruneAllowlist []schema.GroupVersionKind
+}
+
+// DeleteOptions customizes the deletion of resources. The zero value matches the behavior of DeleteYAMLFiles.
+type DeleteOptions struct {
+	// Cascade is the strategy applied to dependents. Defaults to CascadeBackground.
+	Cascade CascadeStrategy
+
+	// GracePeriod is the number of seconds given to a resource to terminate gracefully. Zero deletes
+	// immediately. If nil, the default grace period of each resource is used.
+	GracePeriod *int
 }
 
 var _ Client = &client{}
 
 // Client is a helper wrapper around the Kube RESTClient for istioctl -> Pilot/Envoy/Mesh related things
 type client struct {
-	*kubernetes.Clientset
+	kubernetes.Interface
 	clientFactory util.Factory
 	restClient    *rest.RESTClient
 	config        *rest.Config
-	extSet        *kubeExtClient.Clientset
+	extSet        kubeExtClient.Interface
 	revision      string
+	retryPolicy   RetryPolicy
+	// httpClient sends the requests to the Envoy admin of pods.
+	httpClient *http.Client
+
+	// forwarderFactory creates the port forwarders returned by NewPortForwarder.
+	forwarderFactory portForwarderFactory
+	// executorFactory creates the executors running the commands of PodExec.
+	executorFactory executorFactory
 }
 
 // NewClient creates a Kubernetes client from the given factory. The "revision" parameter
 // controls the behavior of GetIstioPods, by selecting a specific revision of the control plane.
-func NewClient(clientFactory util.Factory, revision string) (Client, error) {
+func NewClient(clientFactory util.Factory, revision string, opts ...ClientOption) (Client, error) {
+	options := newClientOptions(opts)
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	// Wrap the factory rather than rebuilding it, so that the customizations of the caller are kept.
+	factory := &overriddenFactory{Factory: clientFactory, override: options.restConfigOverride()}
+	if options.kubeContext != "" {
+		var err error
+		if factory.loader, err = withCurrentContext(clientFactory.ToRawKubeConfigLoader(), options.kubeContext); err != nil {
+			return nil, err
+		}
+	}
+	clientFactory = factory
 	restConfig, err := clientFactory.ToRESTConfig()
 	if err != nil {
 		return nil, err
@@ -148,18 +589,37 @@ func NewClient(clientFactory util.Factory, revision string) (Client, error) {
 	}
 	return &client{
 		clientFactory: clientFactory,
-		Clientset:     clientSet,
+		Interface:     clientSet,
 		restClient:    restClient,
 		config:        restConfig,
 		extSet:        extSet,
 		revision:      revision,
+		retryPolicy:   options.retryPolicy,
+		httpClient:    options.envoyHTTPClient(),
+
+		forwarderFactory: newPortForwarder,
+		executorFactory:  newSPDYExecutor,
 	}, nil
 }
 
 // NewClient creates a Kubernetes client from the given ClientConfig. The "revision" parameter
 // controls the behavior of GetIstioPods, by selecting a specific revision of the control plane.
-func NewClientForConfig(clientConfig clientcmd.ClientConfig, revision string) (Client, error) {
-	return NewClient(newClientFactory(clientConfig), revision)
+func NewClientForConfig(clientConfig clientcmd.ClientConfig, revision string, opts ...ClientOption) (Client, error) {
+	return NewClient(newClientFactory(clientConfig), revision, opts...)
+}
+
+// NewClientFromKubeconfig creates a Kubernetes client from the given kubeconfig file content, such as the
+// kubeconfig stored in a Secret. If kubeContext is empty, the current context of the kubeconfig is used.
+func NewClientFromKubeconfig(kubeconfig []byte, kubeContext, revision string, opts ...ClientOption) (Client, error) {
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing kubeconfig: %v", err)
+	}
+	clientConfig := newOverridableClientConfig(clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+		func(overrides *clientcmd.ConfigOverrides) clientcmd.ClientConfig {
+			return clientcmd.NewDefaultClientConfig(*config, overrides)
+		})
+	return NewClientForConfig(clientConfig, revision, opts...)
 }
 
 func (c *client) RESTConfig() *rest.Config {
@@ -170,6 +630,22 @@ func (c *client) RESTConfig() *rest.Config {
 func (c *client) REST() rest.Interface {
 	return c.restClient
 }
+
+func (c *client) RESTClientFor(gv schema.GroupVersion) (rest.Interface, error) {
+	config := c.RESTConfig()
+	config.GroupVersion = &gv
+	config.APIPath = "/apis"
+	if gv.Group == "" {
+		config.APIPath = "/api"
+	}
+	config.NegotiatedSerializer = scheme.Codecs.WithoutConversion()
+	restClient, err := rest.RESTClientFor(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create REST client for %s: %v", gv, err)
+	}
+	return restClient, nil
+}
+
 func (c *client) Ext() kubeExtClient.Interface {
 	return c.extSet
 }
@@ -184,15 +660,52 @@ func (c *client) Dynamic() dynamic.Interface {
 	return out
 }
 
+func (c *client) Factory() util.Factory {
+	return c.clientFactory
+}
+
 func (c *client) Revision() string {
 	return c.revision
 }
 
+func (c *client) Preflight(ctx context.Context, istioNamespace string) error {
+	if _, err := c.Discovery().ServerVersion(); err != nil {
+		return fmt.Errorf("unable to reach the Kubernetes API server: %v", err)
+	}
+	if istioNamespace == "" {
+		var err error
+		if istioNamespace, err = c.DiscoverIstioNamespace(ctx); err != nil {
+			return err
+		}
+	}
+	review, err := c.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &kubeApiAuthorization.SelfSubjectAccessReview{
+		Spec: kubeApiAuthorization.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &kubeApiAuthorization.ResourceAttributes{
+				Namespace: istioNamespace,
+				Verb:      "list",
+				Resource:  "pods",
+			},
+		},
+	}, kubeApiMeta.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to check permissions: %v", err)
+	}
+	if !review.Status.Allowed {
+		msg := fmt.Sprintf("not allowed to list pods in namespace %s", istioNamespace)
+		if review.Status.Reason != "" {
+			msg += ": " + review.Status.Reason
+		}
+		return errors.New(msg)
+	}
+	return nil
+}
+
 func (c *client) GetKubernetesVersion() (*kubeVersion.Info, error) {
-	return c.extSet.ServerVersion()
+	return c.extSet.Discovery().ServerVersion()
 }
 
-func (c *client) PodExec(podName, podNamespace, container string, command string) (stdout, stderr string, err error) {
+func (c *client) PodExec(podName, podNamespace, container string, command string,
+	opts ...PodExecOption) (stdout, stderr string, err error) {
 	defer func() {
 		if err != nil {
 			if len(stderr) > 0 {
@@ -204,7 +717,151 @@ func (c *client) PodExec(podName, podNamespace, container string, command string
 		}
 	}()
 
-	commandFields := strings.Fields(command)
+	if container == "" {
+		pod, err := c.GetPod(context.Background(), podNamespace, podName)
+		if err != nil {
+			return "", "", err
+		}
+		container = defaultContainer(pod)
+	}
+
+	run := func() error {
+		var stdoutBuf, stderrBuf bytes.Buffer
+		err := c.podExecStream(context.Background(), podName, podNamespace, container, strings.Fields(command), nil,
+			&stdoutBuf, &stderrBuf)
+		stdout = stdoutBuf.String()
+		stderr = stderrBuf.String()
+		return err
+	}
+
+	options := newPodExecOptions(opts)
+	if options.transientRetryTimeout <= 0 {
+		err = run()
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), options.transientRetryTimeout)
+	defer cancel()
+	err = execRetryPolicy.do(ctx, isTransientExecError, run)
+	return
+}
+
+func (c *client) PodExecCombined(ctx context.Context, podName, podNamespace, container, command string) (string, error) {
+	if container == "" {
+		pod, err := c.GetPod(ctx, podNamespace, podName)
+		if err != nil {
+			return "", err
+		}
+		container = defaultContainer(pod)
+	}
+	// The output streams are copied concurrently, so writes to the shared buffer are serialized.
+	var buf bytes.Buffer
+	out := &syncWriter{w: &buf}
+	err := c.podExecStream(ctx, podName, podNamespace, container, strings.Fields(command), nil, out, out)
+	combined := buf.String()
+	if err != nil {
+		return combined, fmt.Errorf("error exec'ing into %s/%s %s container: %v", podName, podNamespace, container, err)
+	}
+	return combined, nil
+}
+
+func (c *client) PodExecWithEnv(ctx context.Context, podName, podNamespace, container string, env map[string]string,
+	command []string) (string, string, error) {
+	if len(command) == 0 {
+		return "", "", errors.New("no command to exec")
+	}
+	if container == "" {
+		pod, err := c.GetPod(ctx, podNamespace, podName)
+		if err != nil {
+			return "", "", err
+		}
+		container = defaultContainer(pod)
+	}
+	wrapped, err := envCommand(env, command)
+	if err != nil {
+		return "", "", err
+	}
+	var stdout, stderr bytes.Buffer
+	if err := c.podExecStream(ctx, podName, podNamespace, container, wrapped, nil, &stdout, &stderr); err != nil {
+		return stdout.String(), stderr.String(), fmt.Errorf("error exec'ing into %s/%s %s container: %v\n%s",
+			podName, podNamespace, container, err, stderr.String())
+	}
+	return stdout.String(), stderr.String(), nil
+}
+
+// envVarName matches the names of the environment variables which env can't mistake for one of its options.
+var envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envCommand returns the command run by env with the variables set, sorted by name.
+func envCommand(env map[string]string, command []string) ([]string, error) {
+	// env takes every leading argument containing = as another variable.
+	if strings.Contains(command[0], "=") {
+		return nil, fmt.Errorf("invalid command %q: must not contain =", command[0])
+	}
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		if !envVarName.MatchString(key) {
+			return nil, fmt.Errorf("invalid environment variable name %q", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	wrapped := make([]string, 0, len(keys)+len(command)+1)
+	wrapped = append(wrapped, "env")
+	for _, key := range keys {
+		wrapped = append(wrapped, key+"="+env[key])
+	}
+	return append(wrapped, command...), nil
+}
+
+// syncWriter is an io.Writer safe for concurrent use.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// defaultContainerAnnotation names the container selected by kubectl when none is given.
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+// defaultContainer returns the container named by the default container annotation of the pod, or its first
+// container if the annotation is missing or names no container, like kubectl.
+func defaultContainer(pod *kubeApiCore.Pod) string {
+	if name := pod.Annotations[defaultContainerAnnotation]; name != "" {
+		for _, container := range pod.Spec.Containers {
+			if container.Name == name {
+				return name
+			}
+		}
+	}
+	if len(pod.Spec.Containers) > 0 {
+		return pod.Spec.Containers[0].Name
+	}
+	return ""
+}
+
+// execRetryPolicy retries commands failing with transient errors until the timeout of PodExec expires.
+var execRetryPolicy = RetryPolicy{
+	Attempts:       math.MaxInt32,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     time.Second,
+}
+
+// isTransientExecError returns true if err reports that the container is not ready to run commands yet.
+func isTransientExecError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "container not found") || strings.Contains(msg, "container not created")
+}
+
+// podExecStream runs command in the container, streaming stdin to it and its output to stdout and stderr, until
+// the command exits or ctx is done. The executor can't be interrupted, so once ctx is done the stream is left
+// behind: its input fails, which closes the standard input of the command, and its remaining output is dropped.
+func (c *client) podExecStream(ctx context.Context, podName, podNamespace, container string, command []string,
+	stdin io.Reader, stdout, stderr io.Writer) error {
 	req := c.restClient.Post().
 		Resource("pods").
 		Name(podName).
@@ -213,40 +870,136 @@ func (c *client) PodExec(podName, podNamespace, container string, command string
 		Param("container", container).
 		VersionedParams(&kubeApiCore.PodExecOptions{
 			Container: container,
-			Command:   commandFields,
-			Stdin:     false,
-			Stdout:    true,
-			Stderr:    true,
+			Command:   command,
+			Stdin:     stdin != nil,
+			Stdout:    stdout != nil,
+			Stderr:    stderr != nil,
 			TTY:       false,
 		}, scheme.ParameterCodec)
 
-	wrapper, upgrader, err := roundTripperFor(c.config)
+	exec, err := c.executorFactory(c.config, "POST", req.URL())
 	if err != nil {
-		return "", "", err
+		return err
 	}
-	exec, err := remotecommand.NewSPDYExecutorForTransports(wrapper, upgrader, "POST", req.URL())
-	if err != nil {
-		return "", "", err
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stream := &execStream{ctx: ctx}
+	opts := remotecommand.StreamOptions{Tty: false}
+	if stdin != nil {
+		opts.Stdin = stream.reader(stdin)
+	}
+	if stdout != nil {
+		opts.Stdout = stream.writer(stdout)
+	}
+	if stderr != nil {
+		opts.Stderr = stream.writer(stderr)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- exec.Stream(opts)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		stream.abandon()
+		return fmt.Errorf("exec in %s/%s interrupted: %w", podNamespace, podName, ctx.Err())
 	}
+}
+
+// execStream guards the streams of an exec, so that they are no longer used once it is abandoned.
+type execStream struct {
+	ctx       context.Context
+	mu        sync.Mutex
+	abandoned bool
+}
 
-	var stdoutBuf, stderrBuf bytes.Buffer
-	err = exec.Stream(remotecommand.StreamOptions{
-		Stdin:  nil,
-		Stdout: &stdoutBuf,
-		Stderr: &stderrBuf,
-		Tty:    false,
+func (s *execStream) abandon() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.abandoned = true
+}
+
+func (s *execStream) reader(r io.Reader) io.Reader {
+	return readerFunc(func(p []byte) (int, error) {
+		if err := s.ctx.Err(); err != nil {
+			return 0, err
+		}
+		return r.Read(p)
 	})
+}
 
-	stdout = stdoutBuf.String()
-	stderr = stderrBuf.String()
-	return
+func (s *execStream) writer(w io.Writer) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.abandoned {
+			return len(p), nil
+		}
+		return w.Write(p)
+	})
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
 }
 
 func (c *client) PodLogs(ctx context.Context, podName, podNamespace, container string, previousLog bool) (string, error) {
-	opts := &kubeApiCore.PodLogOptions{
+	if container != "" {
+		pod, err := c.GetPod(ctx, podNamespace, podName)
+		if err != nil {
+			return "", err
+		}
+		if container, err = matchContainer(pod, container); err != nil {
+			return "", err
+		}
+	}
+	return c.podLogs(ctx, podName, podNamespace, container, previousLog)
+}
+
+// matchContainer returns the container of the pod named name, or else the only container whose name contains
+// name, such as "istio-proxy" for "proxy".
+func matchContainer(pod *kubeApiCore.Pod, name string) (string, error) {
+	var matches []string
+	for _, containers := range [][]kubeApiCore.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			if container.Name == name {
+				return name, nil
+			}
+			if strings.Contains(container.Name, name) {
+				matches = append(matches, container.Name)
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("pod %s/%s has no container matching %q", pod.Namespace, pod.Name, name)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("%q matches several containers of pod %s/%s: %s", name, pod.Namespace, pod.Name,
+			strings.Join(matches, ", "))
+	}
+}
+
+func (c *client) podLogs(ctx context.Context, podName, podNamespace, container string, previousLog bool) (string, error) {
+	return c.podLogsWithOptions(ctx, podName, podNamespace, &kubeApiCore.PodLogOptions{
 		Container: container,
 		Previous:  previousLog,
-	}
+	})
+}
+
+func (c *client) podLogsWithOptions(ctx context.Context, podName, podNamespace string,
+	opts *kubeApiCore.PodLogOptions) (string, error) {
 	res, err := c.CoreV1().Pods(podNamespace).GetLogs(podName, opts).Stream(ctx)
 	if err != nil {
 		return "", err
@@ -261,6 +1014,94 @@ func (c *client) PodLogs(ctx context.Context, podName, podNamespace, container s
 	return builder.String(), nil
 }
 
+func (c *client) GetCrashedContainerLogs(ctx context.Context, podName, podNamespace, container string) (string, int32, error) {
+	pod, err := c.GetPod(ctx, podNamespace, podName)
+	if err != nil {
+		return "", 0, err
+	}
+	if container, err = matchContainer(pod, container); err != nil {
+		return "", 0, err
+	}
+	var restarts int32
+	for _, statuses := range [][]kubeApiCore.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.Name == container {
+				restarts = status.RestartCount
+			}
+		}
+	}
+	if restarts == 0 {
+		// There is no previous instance of the container to get the logs of.
+		return "", 0, nil
+	}
+	logs, err := c.podLogs(ctx, podName, podNamespace, container, true)
+	if err != nil {
+		return "", restarts, err
+	}
+	return logs, restarts, nil
+}
+
+func (c *client) AllContainerLogs(ctx context.Context, podName, podNamespace string) (map[string]string, error) {
+	pod, err := c.GetPod(ctx, podNamespace, podName)
+	if err != nil {
+		return nil, err
+	}
+	started := map[string]bool{}
+	for _, statuses := range [][]kubeApiCore.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			// Containers which are waiting to start for the first time have no logs yet.
+			started[status.Name] = status.State.Waiting == nil || status.RestartCount > 0
+		}
+	}
+
+	out := map[string]string{}
+	var errs error
+	for _, containers := range [][]kubeApiCore.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			if !started[container.Name] {
+				continue
+			}
+			logs, err := c.podLogs(ctx, podName, podNamespace, container.Name, false)
+			if err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("failed getting logs of container %s: %v", container.Name, err))
+				continue
+			}
+			out[container.Name] = logs
+		}
+	}
+	return out, errs
+}
+
+func (c *client) CollectLogs(ctx context.Context, namespace, selector, container string, tailLines int64) (map[string]string, error) {
+	pods, err := c.PodsForSelector(ctx, namespace, selector)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list pods matching %q in %s: %v", selector, namespace, err)
+	}
+
+	out := map[string]string{}
+	var mu sync.Mutex
+	var errs error
+	forEachConcurrently(len(pods.Items), defaultConcurrency, func(i int) {
+		pod := &pods.Items[i]
+		opts := &kubeApiCore.PodLogOptions{Container: container}
+		if container == "" {
+			opts.Container = defaultContainer(pod)
+		}
+		if tailLines > 0 {
+			opts.TailLines = &tailLines
+		}
+		logs, err := c.podLogsWithOptions(ctx, pod.Name, pod.Namespace, opts)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed getting logs of pod %s/%s: %v", pod.Namespace, pod.Name, err))
+			return
+		}
+		out[pod.Namespace+"/"+pod.Name] = logs
+	})
+	return out, errs
+}
+
 // proxyGet returns a response of the pod by calling it through the proxy.
 // Not a part of client-go https://github.com/kubernetes/kubernetes/issues/90768
 func (c *client) proxyGet(name, namespace, path string, port int) rest.ResponseWrapper {
@@ -283,6 +1124,21 @@ func (c *client) proxyGet(name, namespace, path string, port int) rest.ResponseW
 	return request
 }
 
+// proxyGetRaw calls proxyGet and returns the raw response, retrying transient failures
+// according to the client's RetryPolicy.
+func (c *client) proxyGetRaw(ctx context.Context, name, namespace, path string, port int) ([]byte, error) {
+	var res []byte
+	err := c.retryPolicy.do(ctx, isRetryableProxyError, func() (err error) {
+		res, err = c.proxyGet(name, namespace, path, port).DoRaw(ctx)
+		return err
+	})
+	return res, err
+}
+
+func (c *client) DiscoveryDo(ctx context.Context, pilotName, pilotNamespace, path string) ([]byte, error) {
+	return c.proxyGetRaw(ctx, pilotName, pilotNamespace, path, 8080)
+}
+
 func (c *client) AllDiscoveryDo(ctx context.Context, pilotNamespace, path string) (map[string][]byte, error) {
 	pilots, err := c.GetIstioPods(ctx, pilotNamespace, map[string]string{
 		"labelSelector": "app=istiod",
@@ -292,11 +1148,11 @@ func (c *client) AllDiscoveryDo(ctx context.Context, pilotNamespace, path string
 		return nil, err
 	}
 	if len(pilots) == 0 {
-		return nil, errors.New("unable to find any Pilot instances")
+		return nil, fmt.Errorf("unable to find any Pilot instances: %w", ErrNoIstioPods)
 	}
 	result := map[string][]byte{}
 	for _, pilot := range pilots {
-		res, err := c.proxyGet(pilot.Name, pilot.Namespace, path, 8080).DoRaw(ctx)
+		res, err := c.DiscoveryDo(ctx, pilot.Name, pilot.Namespace, path)
 		if err != nil {
 			return nil, err
 		}
@@ -307,34 +1163,162 @@ func (c *client) AllDiscoveryDo(ctx context.Context, pilotNamespace, path string
 	return result, err
 }
 
-func (c *client) EnvoyDo(ctx context.Context, podName, podNamespace, method, path string, _ []byte) ([]byte, error) {
+func (c *client) EnvoyDo(ctx context.Context, podName, podNamespace, method, path string, body []byte) ([]byte, error) {
+	return c.EnvoyDoWithOptions(ctx, podName, podNamespace, method, path, body)
+}
+
+func (c *client) EnvoyDoWithOptions(ctx context.Context, podName, podNamespace, method, path string, body []byte,
+	opts ...EnvoyDoOption) ([]byte, error) {
+	options := newEnvoyDoOptions(opts)
+	_, out, err := c.envoyRequest(ctx, podName, podNamespace, method, path, body, options)
+	// Only fall back when the request was never sent, so that it doesn't reach Envoy twice.
+	var setupErr *forwardSetupError
+	if err != nil && options.execFallback && errors.As(err, &setupErr) && ctx.Err() == nil {
+		out, execErr := c.envoyExecRequest(ctx, podName, podNamespace, method, path, body, options.headers, options.adminSocket)
+		if execErr != nil {
+			return nil, fmt.Errorf("%v; exec fallback failed: %v", err, execErr)
+		}
+		return out, nil
+	}
+	return out, err
+}
+
+func (c *client) ProxyAdminRequest(ctx context.Context, podName, podNamespace, method, path string) ([]byte, error) {
+	out, err := c.envoyExecRequest(ctx, podName, podNamespace, method, path, nil, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed running pilot-agent request in %s/%s: %v", podNamespace, podName, err)
+	}
+	return out, nil
+}
+
+// envoyExecRequest sends the request to the Envoy admin from within the istio-proxy container of the pod,
+// with curl if the admin listens on adminSocket, or else with pilot-agent. pilot-agent can't send a body or
+// headers, so requests with either are rejected when adminSocket is empty.
+func (c *client) envoyExecRequest(ctx context.Context, podName, podNamespace, method, path string, body []byte,
+	headers http.Header, adminSocket string) ([]byte, error) {
+	command := []string{"pilot-agent", "request", method, path}
+	var stdin io.Reader
+	if adminSocket != "" {
+		command = []string{"curl", "-sS", "-X", method, "--unix-socket", adminSocket}
+		keys := make([]string, 0, len(headers))
+		for key := range headers {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			for _, val := range headers[key] {
+				command = append(command, "-H", key+": "+val)
+			}
+		}
+		if len(body) > 0 {
+			command = append(command, "--data-binary", "@-")
+			stdin = bytes.NewReader(body)
+		}
+		command = append(command, "http://localhost/"+path)
+	} else if len(body) > 0 || len(headers) > 0 {
+		return nil, errors.New("pilot-agent request can't send a body or headers, the admin socket must be set")
+	}
+	var stdout, stderr bytes.Buffer
+	if err := c.podExecStream(ctx, podName, podNamespace, proxyContainerName, command, stdin, &stdout, &stderr); err != nil {
+		if stderr.Len() > 0 {
+			return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// envoyRequest sends a request to the Envoy admin of the pod and returns the status code and body of the response.
+// The request is sent again through a new port forward when the port forward drops.
+func (c *client) envoyRequest(ctx context.Context, podName, podNamespace, method, path string, reqBody []byte,
+	options envoyDoOptions) (int, []byte, error) {
+	policy := forwardRetryPolicy
+	policy.Attempts = options.forwardAttempts
+	var status int
+	var out []byte
+	err := policy.do(ctx, isForwardResetError, func() error {
+		var err error
+		status, out, err = c.envoyRequestOnce(ctx, podName, podNamespace, method, path, reqBody, options)
+		return err
+	})
+	return status, out, err
+}
+
+// forwardRetryPolicy retries the requests to the Envoy admin failing because the port forward dropped.
+// The number of attempts is set by the request options.
+var forwardRetryPolicy = RetryPolicy{
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     time.Second,
+}
+
+// isForwardResetError returns true if err reports that the port forward to the pod dropped.
+func isForwardResetError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "connection reset by peer") || strings.Contains(msg, "an error occurred forwarding")
+}
+
+// forwardSetupError reports that the port forward to the pod could not be set up, so that the request wasn't sent.
+type forwardSetupError struct {
+	err error
+}
+
+func (e *forwardSetupError) Error() string {
+	return e.err.Error()
+}
+
+// envoyRequestOnce sends the request through a new port forward to the pod.
+func (c *client) envoyRequestOnce(ctx context.Context, podName, podNamespace, method, path string, reqBody []byte,
+	options envoyDoOptions) (int, []byte, error) {
 	formatError := func(err error) error {
 		return fmt.Errorf("failure running port forward process: %v", err)
 	}
 
-	fw, err := c.NewPortForwarder(podName, podNamespace, "127.0.0.1", 0, 15000)
+	fw, err := c.NewPortForwarder(podName, podNamespace, "127.0.0.1", 0, options.port)
 	if err != nil {
-		return nil, err
+		return 0, nil, &forwardSetupError{err}
 	}
 	if err = fw.Start(); err != nil {
-		return nil, formatError(err)
+		return 0, nil, &forwardSetupError{formatError(err)}
 	}
 	defer fw.Close()
-	req, err := http.NewRequest(method, fmt.Sprintf("http://%s/%s", fw.Address(), path), nil)
+	req, err := http.NewRequest(method, fmt.Sprintf("http://%s/%s", fw.Address(), path), bytes.NewReader(reqBody))
 	if err != nil {
-		return nil, formatError(err)
+		return 0, nil, formatError(err)
 	}
-	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	for key, vals := range options.headers {
+		for _, val := range vals {
+			req.Header.Add(key, val)
+		}
+	}
+	// Setting Accept-Encoding disables the transparent decompression of the transport, so that the
+	// response is decompressed here whatever http.Client is in use.
+	if req.Header.Get("Accept-Encoding") == "" {
+		if options.disableCompression {
+			req.Header.Set("Accept-Encoding", "identity")
+		} else {
+			req.Header.Set("Accept-Encoding", "gzip")
+		}
+	}
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
 	if err != nil {
-		return nil, formatError(err)
+		return 0, nil, formatError(err)
 	}
 	defer closeQuietly(resp.Body)
-	out, err := ioutil.ReadAll(resp.Body)
+	var body io.Reader = resp.Body
+	if !options.disableCompression && resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return 0, nil, formatError(err)
+		}
+		defer closeQuietly(gz)
+		body = gz
+	}
+	out, err := ioutil.ReadAll(body)
 	if err != nil {
-		return nil, formatError(err)
+		return 0, nil, formatError(err)
 	}
 
-	return out, nil
+	return resp.StatusCode, out, nil
 }
 
 func (c *client) GetIstioPods(ctx context.Context, namespace string, params map[string]string) ([]kubeApiCore.Pod, error) {
@@ -365,7 +1349,77 @@ func (c *client) GetIstioPods(ctx context.Context, namespace string, params map[
 	return list.Items, nil
 }
 
+func (c *client) GetIstioPodsRunning(ctx context.Context, namespace string, extraLabels map[string]string) ([]kubeApiCore.Pod, error) {
+	params := map[string]string{
+		"fieldSelector": fields.OneTermEqualSelector("status.phase", string(kubeApiCore.PodRunning)).String(),
+	}
+	if len(extraLabels) > 0 {
+		params["labelSelector"] = labels.SelectorFromSet(extraLabels).String()
+	}
+	return c.GetIstioPods(ctx, namespace, params)
+}
+
+// Gateway types selected by GetGatewayPods.
+const (
+	IngressGateway = "ingressgateway"
+	EgressGateway  = "egressgateway"
+)
+
+func (c *client) GetGatewayPods(ctx context.Context, namespace, gatewayType string) ([]kubeApiCore.Pod, error) {
+	if gatewayType != IngressGateway && gatewayType != EgressGateway {
+		return nil, fmt.Errorf("invalid gateway type %q, must be %s or %s", gatewayType, IngressGateway, EgressGateway)
+	}
+	return c.GetIstioPods(ctx, namespace, map[string]string{
+		"labelSelector": "istio=" + gatewayType,
+	})
+}
+
+func (c *client) GetIstioPodsMatching(ctx context.Context, namespace string, selectors []labels.Selector) ([]kubeApiCore.Pod, error) {
+	var out []kubeApiCore.Pod
+	seen := map[string]struct{}{}
+	for _, selector := range selectors {
+		pods, err := c.GetIstioPods(ctx, namespace, map[string]string{
+			"labelSelector": selector.String(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods {
+			key := pod.Namespace + "/" + pod.Name
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			out = append(out, pod)
+		}
+	}
+	return out, nil
+}
+
+// PodVersion is the version reported by a single replica of an Istio control plane component.
+// version.ServerInfo is embedded so that it serializes to the same JSON, with the pod identity added.
+type PodVersion struct {
+	version.ServerInfo
+	Pod       string `json:"pod"`
+	Namespace string `json:"namespace"`
+}
+
+// versionRequestTimeout bounds the time GetIstioVersions waits for the version of a single pod.
+var versionRequestTimeout = 10 * time.Second
+
 func (c *client) GetIstioVersions(ctx context.Context, namespace string) (*version.MeshInfo, error) {
+	versions, err := c.GetIstioPodVersions(ctx, namespace)
+	if versions == nil {
+		return nil, err
+	}
+	res := version.MeshInfo{}
+	for _, v := range versions {
+		res = append(res, v.ServerInfo)
+	}
+	return &res, err
+}
+
+func (c *client) GetIstioPodVersions(ctx context.Context, namespace string) ([]PodVersion, error) {
 	pods, err := c.GetIstioPods(ctx, namespace, map[string]string{
 		"labelSelector": "istio,istio!=ingressgateway,istio!=egressgateway,istio!=ilbgateway",
 		"fieldSelector": "status.phase=Running",
@@ -374,23 +1428,33 @@ func (c *client) GetIstioVersions(ctx context.Context, namespace string) (*versi
 		return nil, err
 	}
 	if len(pods) == 0 {
-		return nil, fmt.Errorf("no running Istio pods in %q", namespace)
+		return nil, fmt.Errorf("%w in %q", ErrNoIstioPods, namespace)
 	}
 
+	versions := make([]*PodVersion, len(pods))
+	var mu sync.Mutex
 	var errs error
-	res := version.MeshInfo{}
-	for _, pod := range pods {
-		component := pod.Labels["istio"]
-		server := version.ServerInfo{Component: component}
+	forEachConcurrently(len(pods), defaultConcurrency, func(i int) {
+		pod := pods[i]
+		// A slow pod must not delay the versions of the others past its own timeout.
+		podCtx, cancel := context.WithTimeout(ctx, versionRequestTimeout)
+		defer cancel()
 
 		// :15014/version returns something like
 		// 1.7-alpha.9c900ba74d10a1affe7c23557ef0eebd6103b03c-9c900ba74d10a1affe7c23557ef0eebd6103b03c-Clean
-		result, err := c.proxyGet(pod.Name, pod.Namespace, "/version", 15014).DoRaw(ctx)
+		result, err := c.proxyGetRaw(podCtx, pod.Name, pod.Namespace, "/version", 15014)
 		if err != nil {
+			mu.Lock()
 			errs = multierror.Append(errs, fmt.Errorf("error port-forewarding into %s : %v", pod.Name, err))
-			continue
+			mu.Unlock()
+			return
 		}
 		if len(result) > 0 {
+			server := &PodVersion{
+				ServerInfo: version.ServerInfo{Component: pod.Labels["istio"]},
+				Pod:        pod.Name,
+				Namespace:  pod.Namespace,
+			}
 			versionParts := strings.Split(string(result), "-")
 			nParts := len(versionParts)
 			if nParts >= 3 {
@@ -403,14 +1467,42 @@ func (c *client) GetIstioVersions(ctx context.Context, namespace string) (*versi
 			}
 			// (Golang version not available through :15014/version endpoint)
 
-			res = append(res, server)
+			versions[i] = server
+		}
+	})
+
+	res := []PodVersion{}
+	for _, server := range versions {
+		if server != nil {
+			res = append(res, *server)
 		}
 	}
-	return &res, errs
+	return res, errs
 }
 
-func (c *client) NewPortForwarder(podName, ns, localAddress string, localPort int, podPort int) (PortForwarder, error) {
-	return newPortForwarder(c.config, podName, ns, localAddress, localPort, podPort)
+func (c *client) NewPortForwarder(podName, ns, localAddress string, localPort int, podPort int,
+	opts ...PortForwarderOption) (PortForwarder, error) {
+	if err := validateLocalAddress(localAddress); err != nil {
+		return nil, err
+	}
+	options := newPortForwarderOptions(opts)
+	if !options.reconnect {
+		return c.forwarderFactory(c.config, podName, ns, localAddress, localPort, podPort)
+	}
+	return newReconnectingForwarder(localPort, options, func(localPort int) (PortForwarder, error) {
+		return c.forwarderFactory(c.config, podName, ns, localAddress, localPort, podPort)
+	}), nil
+}
+
+func (c *client) GetPod(ctx context.Context, namespace, name string) (*kubeApiCore.Pod, error) {
+	pod, err := c.CoreV1().Pods(namespace).Get(ctx, name, kubeApiMeta.GetOptions{})
+	if err != nil {
+		if kubeApiErrors.IsNotFound(err) {
+			return nil, fmt.Errorf("pod %s/%s not found", namespace, name)
+		}
+		return nil, fmt.Errorf("unable to get pod %s/%s: %v", namespace, name, err)
+	}
+	return pod, nil
 }
 
 func (c *client) PodsForSelector(ctx context.Context, namespace string, labelSelectors ...string) (*kubeApiCore.PodList, error) {
@@ -421,23 +1513,127 @@ func (c *client) PodsForSelector(ctx context.Context, namespace string, labelSel
 
 func (c *client) ApplyYAMLFiles(namespace string, yamlFiles ...string) error {
 	for _, f := range removeEmptyFiles(yamlFiles) {
-		if err := c.applyYAMLFile(namespace, false, f); err != nil {
+		if err := c.applyYAMLFile(namespace, false, ApplyOptions{}, f, nil); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+func (c *client) ApplyYAMLDir(namespace, dir string, recursive bool) error {
+	files, err := yamlFilesInDir(dir, recursive)
+	if err != nil {
+		return err
+	}
+	return c.ApplyYAMLFiles(namespace, files...)
+}
+
+// yamlFilesInDir returns the .yaml and .yml files of dir, and of its subdirectories if recursive, in lexical
+// order of their paths.
+func yamlFilesInDir(dir string, recursive bool) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read YAML files of %s: %v", dir, err)
+	}
+	// The walk visits the entries of each directory in lexical order, which is not the lexical order of the
+	// paths: "base/c.yaml" is visited before "base.yaml".
+	sort.Strings(files)
+	return files, nil
+}
+
 func (c *client) ApplyYAMLFilesDryRun(namespace string, yamlFiles ...string) error {
 	for _, f := range removeEmptyFiles(yamlFiles) {
-		if err := c.applyYAMLFile(namespace, true, f); err != nil {
+		if err := c.applyYAMLFile(namespace, true, ApplyOptions{}, f, nil); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (c *client) applyYAMLFile(namespace string, dryRun bool, file string) error {
+func (c *client) ApplyYAMLDryRunResult(ctx context.Context, namespace string, yaml io.Reader) ([]*unstructured.Unstructured, error) {
+	cmdNamespace, enforceNamespace, err := c.clientFactory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return nil, err
+	}
+	if len(namespace) > 0 {
+		cmdNamespace = namespace
+		enforceNamespace = true
+	}
+	dynamicClient, err := c.clientFactory.DynamicClient()
+	if err != nil {
+		return nil, err
+	}
+
+	r := c.clientFactory.NewBuilder().
+		Unstructured().
+		NamespaceParam(cmdNamespace).DefaultNamespace().
+		Stream(yaml, "STDIN").
+		Flatten().
+		Do()
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	var merged []*unstructured.Unstructured
+	err = r.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+		obj, err := dryRunApply(ctx, dynamicClient.Resource(info.Mapping.Resource).Namespace(info.Namespace), info)
+		if err != nil {
+			return err
+		}
+		merged = append(merged, obj)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+func (c *client) ApplyYAMLFilesWithOptions(namespace string, opts ApplyOptions, yamlFiles ...string) error {
+	if err := validatePrune(opts); err != nil {
+		return err
+	}
+	applied := newAppliedObjects()
+	for _, f := range removeEmptyFiles(yamlFiles) {
+		if err := c.applyYAMLFile(namespace, false, opts, f, applied); err != nil {
+			return err
+		}
+	}
+	if opts.PruneSelector == "" {
+		return nil
+	}
+	mapper, err := c.clientFactory.ToRESTMapper()
+	if err != nil {
+		return err
+	}
+	out := opts.Output
+	if out == nil {
+		out = ioutil.Discard
+	}
+	return c.pruneObjects(context.TODO(), mapper, opts.PruneSelector, opts.PruneAllowlist, applied, false, out)
+}
+
+// applyYAMLFile applies the objects of file and records them in applied, if not nil.
+func (c *client) applyYAMLFile(namespace string, dryRun bool, applyOpts ApplyOptions, file string,
+	applied *appliedObjects) error {
 	dynamicClient, err := c.clientFactory.DynamicClient()
 	if err != nil {
 		return err
@@ -449,6 +1645,10 @@ func (c *client) applyYAMLFile(namespace string, dryRun bool, file string) error
 
 	// Create the options.
 	streams, _, stdout, stderr := genericclioptions.NewTestIOStreams()
+	if applyOpts.Output != nil {
+		// The output is still buffered, to be reported on errors.
+		streams.Out = io.MultiWriter(stdout, applyOpts.Output)
+	}
 	opts := apply.NewApplyOptions(streams)
 	opts.DynamicClient = dynamicClient
 	opts.DryRunVerifier = resource.NewDryRunVerifier(dynamicClient, discoveryClient)
@@ -501,24 +1701,118 @@ func (c *client) applyYAMLFile(namespace string, dryRun bool, file string) error
 		s := stdout.String() + stderr.String()
 		return fmt.Errorf("%v: %s", err, s)
 	}
+	if applied != nil {
+		applied.uids = applied.uids.Union(opts.VisitedUids)
+		applied.namespaces = applied.namespaces.Union(opts.VisitedNamespaces)
+	}
 	return nil
 }
 
-func (c *client) DeleteYAMLFiles(namespace string, yamlFiles ...string) (err error) {
-	for _, f := range removeEmptyFiles(yamlFiles) {
-		err = multierror.Append(err, c.deleteFile(namespace, false, f)).ErrorOrNil()
+func (c *client) DeleteYAMLFiles(namespace string, yamlFiles ...string) error {
+	return c.deleteYAMLFiles(namespace, false, DeleteOptions{}, yamlFiles)
+}
+
+func (c *client) DeleteYAMLFilesDryRun(namespace string, yamlFiles ...string) error {
+	return c.deleteYAMLFiles(namespace, true, DeleteOptions{}, yamlFiles)
+}
+
+func (c *client) DeleteYAMLFilesWithOptions(namespace string, opts DeleteOptions, yamlFiles ...string) error {
+	return c.deleteYAMLFiles(namespace, false, opts, yamlFiles)
+}
+
+func (c *client) DeleteByLabel(ctx context.Context, namespace, labelSelector string, gvrs ...schema.GroupVersionResource) error {
+	if labelSelector == "" {
+		return errors.New("refusing to delete resources without a label selector")
 	}
-	return err
+	if _, err := labels.Parse(labelSelector); err != nil {
+		return fmt.Errorf("invalid label selector %q: %v", labelSelector, err)
+	}
+	var errs error
+	for _, gvr := range gvrs {
+		resources := c.Dynamic().Resource(gvr)
+		list, err := resources.Namespace(namespace).List(ctx, kubeApiMeta.ListOptions{LabelSelector: labelSelector})
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("unable to list %s: %v", gvr.Resource, err))
+			continue
+		}
+		for _, item := range list.Items {
+			err := resources.Namespace(item.GetNamespace()).Delete(ctx, item.GetName(), kubeApiMeta.DeleteOptions{})
+			if err != nil && !kubeApiErrors.IsNotFound(err) {
+				errs = multierror.Append(errs, fmt.Errorf("unable to delete %s %s: %v", gvr.Resource, item.GetName(), err))
+			}
+		}
+	}
+	return errs
 }
 
-func (c *client) DeleteYAMLFilesDryRun(namespace string, yamlFiles ...string) (err error) {
-	for _, f := range removeEmptyFiles(yamlFiles) {
-		err = multierror.Append(err, c.deleteFile(namespace, true, f)).ErrorOrNil()
+// deletionPollInterval is the interval between two checks of the existence of a resource being deleted.
+const deletionPollInterval = 500 * time.Millisecond
+
+func (c *client) WaitForResourceDeleted(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) error {
+	resource := c.Dynamic().Resource(gvr).Namespace(namespace)
+	ticker := time.NewTicker(deletionPollInterval)
+	defer ticker.Stop()
+	for {
+		_, err := resource.Get(ctx, name, kubeApiMeta.GetOptions{})
+		if kubeApiErrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("unable to get %s %s: %v", gvr.Resource, name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s %s not deleted: %v", gvr.Resource, name, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// deleteYAMLFiles deletes the resources of all the files at once, so that the server resources are discovered
+// only once. If some files can't be read, the others are deleted one by one, as they would be individually.
+func (c *client) deleteYAMLFiles(namespace string, dryRun bool, opts DeleteOptions, yamlFiles []string) error {
+	files := removeEmptyFiles(yamlFiles)
+	if len(files) == 0 {
+		return nil
+	}
+	err := c.deleteFiles(namespace, dryRun, opts, files)
+	if _, ok := err.(builderError); !ok || len(files) == 1 {
+		return unwrapBuilderError(err)
+	}
+	var errs error
+	for _, f := range files {
+		errs = multierror.Append(errs, unwrapBuilderError(c.deleteFiles(namespace, dryRun, opts, []string{f}))).ErrorOrNil()
+	}
+	return errs
+}
+
+// builderError is an error building the resources to delete from files.
+type builderError struct {
+	error
+}
+
+func unwrapBuilderError(err error) error {
+	if b, ok := err.(builderError); ok {
+		return b.error
 	}
 	return err
 }
 
-func (c *client) deleteFile(namespace string, dryRun bool, file string) error {
+func (c *client) deleteFiles(namespace string, dryRun bool, deleteOpts DeleteOptions, files []string) error {
+	var cascade bool
+	switch deleteOpts.Cascade {
+	case "", CascadeBackground, CascadeForeground:
+		cascade = true
+	case CascadeOrphan:
+		cascade = false
+	default:
+		return fmt.Errorf("unsupported cascade strategy %q", deleteOpts.Cascade)
+	}
+	gracePeriod := -1
+	if deleteOpts.GracePeriod != nil {
+		gracePeriod = *deleteOpts.GracePeriod
+	}
+
 	// Create the options.
 	streams, _, stdout, stderr := genericclioptions.NewTestIOStreams()
 
@@ -533,7 +1827,7 @@ func (c *client) deleteFile(namespace string, dryRun bool, file string) error {
 	}
 
 	fileOpts := resource.FilenameOptions{
-		Filenames: []string{file},
+		Filenames: files,
 	}
 
 	dynamicClient, err := c.clientFactory.DynamicClient()
@@ -546,8 +1840,8 @@ func (c *client) deleteFile(namespace string, dryRun bool, file string) error {
 	}
 	opts := kubectlDelete.DeleteOptions{
 		FilenameOptions:  fileOpts,
-		Cascade:          true,
-		GracePeriod:      -1,
+		Cascade:          cascade,
+		GracePeriod:      gracePeriod,
 		IgnoreNotFound:   true,
 		WaitForDeletion:  true,
 		WarnClusterScope: enforceNamespace,
@@ -572,7 +1866,10 @@ func (c *client) deleteFile(namespace string, dryRun bool, file string) error {
 		Do()
 	err = r.Err()
 	if err != nil {
-		return err
+		return builderError{err}
+	}
+	if deleteOpts.Cascade == CascadeForeground {
+		return c.deleteForeground(dynamicClient, r, dryRun, gracePeriod)
 	}
 	opts.Result = r
 
@@ -589,10 +1886,67 @@ func (c *client) deleteFile(namespace string, dryRun bool, file string) error {
 	return nil
 }
 
+// deleteForeground deletes the objects of r with the foreground propagation policy, which the kubectl delete
+// command does not support, and waits until they are gone, which happens once their dependents are deleted.
+func (c *client) deleteForeground(dynamicClient dynamic.Interface, r *resource.Result, dryRun bool, gracePeriod int) error {
+	policy := kubeApiMeta.DeletePropagationForeground
+	opts := kubeApiMeta.DeleteOptions{PropagationPolicy: &policy}
+	if gracePeriod >= 0 {
+		seconds := int64(gracePeriod)
+		opts.GracePeriodSeconds = &seconds
+	}
+	if dryRun {
+		opts.DryRun = []string{kubeApiMeta.DryRunAll}
+	}
+
+	var deleted []*resource.Info
+	err := r.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+		err = dynamicClient.Resource(info.Mapping.Resource).Namespace(info.Namespace).Delete(context.TODO(), info.Name, opts)
+		if err != nil {
+			if kubeApiErrors.IsNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("failed deleting %s: %v", info.ObjectName(), err)
+		}
+		deleted = append(deleted, info)
+		return nil
+	})
+	if err != nil || dryRun {
+		return err
+	}
+	for _, info := range deleted {
+		if err := c.WaitForResourceDeleted(context.TODO(), info.Mapping.Resource, info.Namespace, info.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func closeQuietly(c io.Closer) {
 	_ = c.Close()
 }
 
+// forEachConcurrently calls fn for every index in [0, n), running at most limit calls at a time.
+func forEachConcurrently(n, limit int, fn func(i int)) {
+	sem := make(chan struct{}, limit)
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
 func removeEmptyFiles(files []string) []string {
 	out := make([]string, 0, len(files))
 	for _, f := range files {
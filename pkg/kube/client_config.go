@@ -15,6 +15,8 @@
 package kube
 
 import (
+	"fmt"
+
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
@@ -81,6 +83,44 @@ func (c *clientConfig) copyRestConfig() *rest.Config {
 	return &out
 }
 
+// overridableClientConfig is a clientcmd.ClientConfig which remembers its overrides, so that another context
+// of its kubeconfig can be selected without losing them.
+type overridableClientConfig struct {
+	clientcmd.ClientConfig
+	overrides clientcmd.ConfigOverrides
+	// build creates the ClientConfig of the kubeconfig with the given overrides.
+	build func(overrides *clientcmd.ConfigOverrides) clientcmd.ClientConfig
+}
+
+func newOverridableClientConfig(overrides clientcmd.ConfigOverrides,
+	build func(overrides *clientcmd.ConfigOverrides) clientcmd.ClientConfig) *overridableClientConfig {
+	return &overridableClientConfig{
+		ClientConfig: build(&overrides),
+		overrides:    overrides,
+		build:        build,
+	}
+}
+
+// withCurrentContext returns a ClientConfig of the kubeconfig loaded by loader, using kubeContext rather
+// than its current context. The overrides of loader are kept if it was created by this package, such as by
+// BuildClientCmd; those of other ClientConfigs can't be read.
+func withCurrentContext(loader clientcmd.ClientConfig, kubeContext string) (clientcmd.ClientConfig, error) {
+	raw, err := loader.RawConfig()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := raw.Contexts[kubeContext]; !ok {
+		return nil, fmt.Errorf("context %q not found in kubeconfig", kubeContext)
+	}
+	if overridable, ok := loader.(*overridableClientConfig); ok {
+		overrides := overridable.overrides
+		overrides.CurrentContext = kubeContext
+		return newOverridableClientConfig(overrides, overridable.build), nil
+	}
+	return clientcmd.NewNonInteractiveClientConfig(raw, kubeContext,
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext}, loader.ConfigAccess()), nil
+}
+
 func newAuthInfo(restConfig *rest.Config) *api.AuthInfo {
 	return &api.AuthInfo{
 		ClientCertificate:     restConfig.CertFile,
@@ -121,3 +121,64 @@ func (c *clientFactory) Validator(validate bool) (validation.Schema, error) {
 func (c *clientFactory) OpenAPISchema() (openapi.Resources, error) {
 	return c.factory.OpenAPISchema()
 }
+
+// overriddenFactory is a util.Factory creating its REST clients from the rest.Config of the wrapped factory,
+// changed by override. All other clients and kubectl machinery are provided by the wrapped factory.
+type overriddenFactory struct {
+	util.Factory
+	// loader replaces the kubeconfig loader of the wrapped factory, such as to select another context.
+	// If nil, the rest.Config of the wrapped factory is used.
+	loader   clientcmd.ClientConfig
+	override func(*rest.Config)
+}
+
+func (f *overriddenFactory) ToRawKubeConfigLoader() clientcmd.ClientConfig {
+	if f.loader != nil {
+		return f.loader
+	}
+	return f.Factory.ToRawKubeConfigLoader()
+}
+
+func (f *overriddenFactory) ToRESTConfig() (*rest.Config, error) {
+	var restConfig *rest.Config
+	if f.loader != nil {
+		loaded, err := f.loader.ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		restConfig = SetRestDefaults(loaded)
+	} else {
+		wrapped, err := f.Factory.ToRESTConfig()
+		if err != nil {
+			return nil, err
+		}
+		// The wrapped factory may return the same config every time, so it must not be changed.
+		restConfig = rest.CopyConfig(wrapped)
+	}
+	f.override(restConfig)
+	return restConfig, nil
+}
+
+func (f *overriddenFactory) RESTClient() (*rest.RESTClient, error) {
+	restConfig, err := f.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	return rest.RESTClientFor(SetRestDefaults(restConfig))
+}
+
+func (f *overriddenFactory) DynamicClient() (dynamic.Interface, error) {
+	restConfig, err := f.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(restConfig)
+}
+
+func (f *overriddenFactory) KubernetesClientSet() (*kubernetes.Clientset, error) {
+	restConfig, err := f.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(restConfig)
+}
@@ -0,0 +1,392 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/client-go/rest"
+
+	"istio.io/pkg/version"
+)
+
+// ClientOption configures optional behavior of a Client created by NewClient.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	retryPolicy   RetryPolicy
+	requestLogger RequestLogger
+	impersonate   *rest.ImpersonationConfig
+	tlsClientCert *tlsClientCert
+	userAgent     string
+	envoyClient   *http.Client
+	kubeContext   string
+}
+
+// tlsClientCert is the PEM encoded client certificate material set by WithTLSClientCert.
+type tlsClientCert struct {
+	certData, keyData, caData []byte
+}
+
+// envoyRequestTimeout bounds the requests sent to the Envoy admin of pods by the default http.Client.
+const envoyRequestTimeout = 30 * time.Second
+
+func newClientOptions(opts []ClientOption) clientOptions {
+	out := clientOptions{
+		retryPolicy: DefaultRetryPolicy,
+		envoyClient: &http.Client{Timeout: envoyRequestTimeout},
+	}
+	for _, opt := range opts {
+		opt(&out)
+	}
+	return out
+}
+
+// validate returns an error if the options can't be applied.
+func (o clientOptions) validate() error {
+	if o.tlsClientCert == nil {
+		return nil
+	}
+	if _, err := tls.X509KeyPair(o.tlsClientCert.certData, o.tlsClientCert.keyData); err != nil {
+		return fmt.Errorf("invalid client certificate: %v", err)
+	}
+	if len(o.tlsClientCert.caData) > 0 && !x509.NewCertPool().AppendCertsFromPEM(o.tlsClientCert.caData) {
+		return errors.New("invalid CA certificate: no PEM encoded certificate found")
+	}
+	return nil
+}
+
+// defaultUserAgent identifies the requests of the Client in the API server audit logs, such as
+// "istio/1.7.0 istioctl/v0.0.0 (linux/amd64) kubernetes/$Format".
+func defaultUserAgent() string {
+	return fmt.Sprintf("istio/%s %s", version.Info.Version, rest.DefaultKubernetesUserAgent())
+}
+
+// restConfigOverride returns a function applying the options which change the rest.Config of the Client.
+func (o clientOptions) restConfigOverride() func(*rest.Config) {
+	return func(config *rest.Config) {
+		if o.userAgent != "" {
+			config.UserAgent = o.userAgent
+		} else if config.UserAgent == "" {
+			config.UserAgent = defaultUserAgent()
+		}
+		if o.impersonate != nil {
+			config.Impersonate = *o.impersonate
+		}
+		if o.tlsClientCert != nil {
+			config.CertFile, config.CertData = "", o.tlsClientCert.certData
+			config.KeyFile, config.KeyData = "", o.tlsClientCert.keyData
+			if len(o.tlsClientCert.caData) > 0 {
+				config.CAFile, config.CAData = "", o.tlsClientCert.caData
+			}
+		}
+		if o.requestLogger != nil {
+			config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+				return newLoggingRoundTripper(rt, o.requestLogger)
+			})
+		}
+	}
+}
+
+// envoyHTTPClient returns the http.Client sending the requests to the Envoy admin of pods, reporting them to
+// the request logger if there is one.
+func (o clientOptions) envoyHTTPClient() *http.Client {
+	if o.requestLogger == nil {
+		return o.envoyClient
+	}
+	transport := o.envoyClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	logged := *o.envoyClient
+	logged.Transport = newLoggingRoundTripper(transport, o.requestLogger)
+	return &logged
+}
+
+// WithRetryPolicy sets the policy used to retry requests proxied to Istio pods, such as
+// those made by GetIstioVersions and AllDiscoveryDo.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(o *clientOptions) {
+		o.retryPolicy = policy
+	}
+}
+
+// WithRequestLogger reports every request made by the Client, including those sent to the Envoy admin of
+// pods, to logger. By default requests are not reported.
+func WithRequestLogger(logger RequestLogger) ClientOption {
+	return func(o *clientOptions) {
+		o.requestLogger = logger
+	}
+}
+
+// WithImpersonation makes all the requests of the Client act as the given user, like `kubectl --as`.
+// The client-go version in use does not support impersonating a UID.
+func WithImpersonation(impersonate rest.ImpersonationConfig) ClientOption {
+	return func(o *clientOptions) {
+		o.impersonate = &rest.ImpersonationConfig{
+			UserName: impersonate.UserName,
+			Groups:   append([]string(nil), impersonate.Groups...),
+			Extra:    impersonate.Extra,
+		}
+	}
+}
+
+// WithTLSClientCert authenticates the Client to the API server with the given PEM encoded client certificate
+// and key, replacing those of the kubeconfig. If caData is not empty, it also replaces the CA certificates
+// the API server is verified with. NewClient fails if the certificate and key don't match.
+func WithTLSClientCert(certData, keyData, caData []byte) ClientOption {
+	return func(o *clientOptions) {
+		o.tlsClientCert = &tlsClientCert{certData: certData, keyData: keyData, caData: caData}
+	}
+}
+
+// WithUserAgent sets the User-Agent of the requests the Client sends to the API server. By default it
+// includes the Istio version, unless the rest.Config the Client is created from already sets one.
+func WithUserAgent(userAgent string) ClientOption {
+	return func(o *clientOptions) {
+		o.userAgent = userAgent
+	}
+}
+
+// WithEnvoyHTTPClient sets the http.Client sending the requests to the Envoy admin of pods, for instance to
+// instrument them. By default, or if client is nil, a client with a timeout of 30 seconds is used.
+func WithEnvoyHTTPClient(client *http.Client) ClientOption {
+	return func(o *clientOptions) {
+		if client != nil {
+			o.envoyClient = client
+		}
+	}
+}
+
+// WithKubeContext selects the kubeconfig context the Client connects to, like the --context flag of kubectl,
+// instead of the current context of the kubeconfig of the ClientConfig.
+func WithKubeContext(kubeContext string) ClientOption {
+	return func(o *clientOptions) {
+		o.kubeContext = kubeContext
+	}
+}
+
+// EnvoyDoOption configures a single request made by EnvoyDoWithOptions.
+type EnvoyDoOption func(*envoyDoOptions)
+
+type envoyDoOptions struct {
+	headers            http.Header
+	port               int
+	disableCompression bool
+	execFallback       bool
+	adminSocket        string
+	forwardAttempts    int
+}
+
+// defaultForwardAttempts is the number of attempts of a request to the Envoy admin when the port forward drops.
+const defaultForwardAttempts = 3
+
+// Ports of the Envoy admin and of the readiness endpoint of the sidecar.
+const (
+	envoyAdminPort     = 15000
+	proxyReadinessPort = 15021
+)
+
+func newEnvoyDoOptions(opts []EnvoyDoOption) envoyDoOptions {
+	out := envoyDoOptions{
+		port:            envoyAdminPort,
+		forwardAttempts: defaultForwardAttempts,
+	}
+	for _, opt := range opts {
+		opt(&out)
+	}
+	return out
+}
+
+// WithHeaders adds the given headers to the request sent to the Envoy admin.
+func WithHeaders(headers http.Header) EnvoyDoOption {
+	return func(o *envoyDoOptions) {
+		if o.headers == nil {
+			o.headers = http.Header{}
+		}
+		for key, vals := range headers {
+			for _, val := range vals {
+				o.headers.Add(key, val)
+			}
+		}
+	}
+}
+
+// WithProxyPort sends the request to the given port of the pod instead of the default one.
+func WithProxyPort(port int) EnvoyDoOption {
+	return func(o *envoyDoOptions) {
+		o.port = port
+	}
+}
+
+// WithoutCompression disables the gzip compression of the response, which is otherwise requested from
+// the Envoy admin and decompressed before being returned.
+func WithoutCompression() EnvoyDoOption {
+	return func(o *envoyDoOptions) {
+		o.disableCompression = true
+	}
+}
+
+// WithExecFallback sends the request from within the istio-proxy container of the pod when it can't be sent
+// through a port forward, for instance because the Envoy admin only listens on a Unix domain socket.
+// If adminSocket is set, the request is sent to it with curl, otherwise with `pilot-agent request`, which
+// can't send the body or headers of the request. There is no fallback once the request may have reached
+// Envoy, or when ctx is done.
+func WithExecFallback(adminSocket string) EnvoyDoOption {
+	return func(o *envoyDoOptions) {
+		o.execFallback = true
+		o.adminSocket = adminSocket
+	}
+}
+
+// WithForwardAttempts sets the number of attempts of the request, each with a new port forward, when the port
+// forward to the pod drops. Values <= 1 disable retries. Defaults to 3.
+func WithForwardAttempts(attempts int) EnvoyDoOption {
+	return func(o *envoyDoOptions) {
+		o.forwardAttempts = attempts
+	}
+}
+
+// ProxyStatsOption configures a single request made by GetProxyStats.
+type ProxyStatsOption func(*proxyStatsOptions)
+
+type proxyStatsOptions struct {
+	prometheus bool
+	usedOnly   bool
+}
+
+func newProxyStatsOptions(opts []ProxyStatsOption) proxyStatsOptions {
+	var out proxyStatsOptions
+	for _, opt := range opts {
+		opt(&out)
+	}
+	return out
+}
+
+// WithPrometheusFormat requests the stats from the /stats/prometheus endpoint. The metrics are keyed by their
+// Prometheus name followed by their labels.
+func WithPrometheusFormat() ProxyStatsOption {
+	return func(o *proxyStatsOptions) {
+		o.prometheus = true
+	}
+}
+
+// WithUsedOnly only requests the stats which Envoy has updated at least once.
+func WithUsedOnly() ProxyStatsOption {
+	return func(o *proxyStatsOptions) {
+		o.usedOnly = true
+	}
+}
+
+// PodExecOption configures a single command run by PodExec.
+type PodExecOption func(*podExecOptions)
+
+type podExecOptions struct {
+	transientRetryTimeout time.Duration
+}
+
+func newPodExecOptions(opts []PodExecOption) podExecOptions {
+	var out podExecOptions
+	for _, opt := range opts {
+		opt(&out)
+	}
+	return out
+}
+
+// WithTransientErrorRetry retries the command for up to timeout while the container is reported as not found
+// or not created, as happens right after a pod starts running. Other errors are returned immediately.
+func WithTransientErrorRetry(timeout time.Duration) PodExecOption {
+	return func(o *podExecOptions) {
+		o.transientRetryTimeout = timeout
+	}
+}
+
+// SyncStatusWatchOption configures a watch started by WatchProxySyncStatus.
+type SyncStatusWatchOption func(*syncStatusWatchOptions)
+
+type syncStatusWatchOptions struct {
+	pollInterval time.Duration
+}
+
+// defaultSyncStatusPollInterval is the default interval between two sync status requests to istiod.
+const defaultSyncStatusPollInterval = 5 * time.Second
+
+func newSyncStatusWatchOptions(opts []SyncStatusWatchOption) syncStatusWatchOptions {
+	out := syncStatusWatchOptions{
+		pollInterval: defaultSyncStatusPollInterval,
+	}
+	for _, opt := range opts {
+		opt(&out)
+	}
+	return out
+}
+
+// WithPollInterval sets the interval between two sync status requests to istiod.
+func WithPollInterval(interval time.Duration) SyncStatusWatchOption {
+	return func(o *syncStatusWatchOptions) {
+		if interval > 0 {
+			o.pollInterval = interval
+		}
+	}
+}
+
+// PortForwarderOption configures a PortForwarder created by NewPortForwarder or NewServicePortForwarder.
+type PortForwarderOption func(*portForwarderOptions)
+
+type portForwarderOptions struct {
+	reconnect         bool
+	onReconnect       func(error)
+	reconnectInterval time.Duration
+}
+
+// defaultReconnectInterval is the default interval between two reconnection attempts of a forwarder.
+const defaultReconnectInterval = time.Second
+
+func newPortForwarderOptions(opts []PortForwarderOption) portForwarderOptions {
+	out := portForwarderOptions{
+		reconnectInterval: defaultReconnectInterval,
+	}
+	for _, opt := range opts {
+		opt(&out)
+	}
+	return out
+}
+
+// WithAutoReconnect establishes a new port forward on the same local port when the current one stops, for
+// instance because the pod restarted. A pod forwarder reconnects to the pod of the same name, as happens when
+// its containers restart or a StatefulSet replaces it, while a service forwarder resolves a ready pod of the
+// service again, so it may reconnect to another pod. If onReconnect is not nil, it is called after each
+// reconnection attempt, with its error if it failed. Attempts are repeated until the forwarder is closed.
+func WithAutoReconnect(onReconnect func(err error)) PortForwarderOption {
+	return func(o *portForwarderOptions) {
+		o.reconnect = true
+		o.onReconnect = onReconnect
+	}
+}
+
+// WithReconnectInterval sets the interval between two reconnection attempts of an auto-reconnecting forwarder
+// which failed to reconnect.
+func WithReconnectInterval(interval time.Duration) PortForwarderOption {
+	return func(o *portForwarderOptions) {
+		if interval > 0 {
+			o.reconnectInterval = interval
+		}
+	}
+}
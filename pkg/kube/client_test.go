@@ -0,0 +1,1615 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kubeApiAuthorization "k8s.io/api/authorization/v1"
+	kubeApiCore "k8s.io/api/core/v1"
+	extfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	"k8s.io/apimachinery/pkg/api/meta"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8sTesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/validation"
+)
+
+// fakeFactory is a util.Factory serving a fake dynamic client. Other methods are not implemented.
+type fakeFactory struct {
+	util.Factory
+	dynamic dynamic.Interface
+	mapper  meta.RESTMapper
+}
+
+func (f *fakeFactory) DynamicClient() (dynamic.Interface, error) {
+	return f.dynamic, nil
+}
+
+func (f *fakeFactory) ToRESTMapper() (meta.RESTMapper, error) {
+	if f.mapper == nil {
+		return nil, errors.New("no fake REST mapper")
+	}
+	return f.mapper, nil
+}
+
+// newFakeClient creates a client backed by fake clientsets holding the given objects. Unstructured
+// objects are served by the dynamic client, all others by the Kubernetes clientset.
+func newFakeClient(objects ...runtime.Object) *client {
+	var kubeObjects, dynamicObjects []runtime.Object
+	for _, obj := range objects {
+		if _, ok := obj.(*unstructured.Unstructured); ok {
+			dynamicObjects = append(dynamicObjects, obj)
+		} else {
+			kubeObjects = append(kubeObjects, obj)
+		}
+	}
+	return &client{
+		Interface: fake.NewSimpleClientset(kubeObjects...),
+		clientFactory: &fakeFactory{
+			dynamic: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), dynamicObjects...),
+		},
+		extSet:      extfake.NewSimpleClientset(),
+		config:      &rest.Config{},
+		retryPolicy: DefaultRetryPolicy,
+		httpClient:  http.DefaultClient,
+		forwarderFactory: func(_ *rest.Config, podName, ns, _ string, _, _ int) (PortForwarder, error) {
+			return nil, fmt.Errorf("no fake envoy for %s/%s", podName, ns)
+		},
+	}
+}
+
+// fakeForwarder is a PortForwarder to a local address.
+type fakeForwarder struct {
+	address string
+	// startErr is returned by Start, if set.
+	startErr error
+}
+
+func (f *fakeForwarder) Start() error {
+	return f.startErr
+}
+
+func (f *fakeForwarder) Address() string {
+	return f.address
+}
+
+func (f *fakeForwarder) Close() {}
+
+func (f *fakeForwarder) WaitForStop() {}
+
+// withFakeEnvoys makes port forwards to the given pods reach the corresponding handlers.
+func withFakeEnvoys(t *testing.T, c *client, handlers map[string]http.Handler) {
+	t.Helper()
+	addresses := map[string]string{}
+	for pod, handler := range handlers {
+		srv := httptest.NewServer(handler)
+		t.Cleanup(srv.Close)
+		addresses[pod] = srv.Listener.Addr().String()
+	}
+	c.forwarderFactory = func(_ *rest.Config, podName, ns, _ string, _, _ int) (PortForwarder, error) {
+		address, ok := addresses[podName]
+		if !ok {
+			return nil, fmt.Errorf("pod %s/%s not found", podName, ns)
+		}
+		return &fakeForwarder{address: address}, nil
+	}
+}
+
+// newTestServerClient creates a Client which sends all API server requests to the given handler.
+func newTestServerClient(t testing.TB, handler http.Handler, opts ...ClientOption) Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	c, err := NewClientForConfig(NewClientConfigForRestConfig(&rest.Config{Host: srv.URL}), "", opts...)
+	if err != nil {
+		t.Fatalf("failed creating client: %v", err)
+	}
+	return c
+}
+
+func writeJSON(t testing.TB, w http.ResponseWriter, obj interface{}) {
+	t.Helper()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		t.Errorf("failed writing response: %v", err)
+	}
+}
+
+func podList(pods ...kubeApiCore.Pod) *kubeApiCore.PodList {
+	return &kubeApiCore.PodList{
+		TypeMeta: kubeApiMeta.TypeMeta{Kind: "PodList", APIVersion: "v1"},
+		Items:    pods,
+	}
+}
+
+func istioPod(name, namespace, component string) kubeApiCore.Pod {
+	return kubeApiCore.Pod{
+		ObjectMeta: kubeApiMeta.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{"app": component, "istio": component},
+		},
+		Status: kubeApiCore.PodStatus{Phase: kubeApiCore.PodRunning},
+	}
+}
+
+func TestNewClientFromKubeconfig(t *testing.T) {
+	kubeconfig := []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: primary
+  cluster:
+    server: https://primary.example.com
+- name: remote
+  cluster:
+    server: https://remote.example.com
+users:
+- name: admin
+  user:
+    token: secret-token
+contexts:
+- name: primary
+  context:
+    cluster: primary
+    user: admin
+- name: remote
+  context:
+    cluster: remote
+    user: admin
+current-context: primary
+`)
+
+	cases := []struct {
+		context  string
+		wantHost string
+	}{
+		{context: "", wantHost: "https://primary.example.com"},
+		{context: "remote", wantHost: "https://remote.example.com"},
+	}
+	for _, tt := range cases {
+		c, err := NewClientFromKubeconfig(kubeconfig, tt.context, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.RESTConfig(); got.Host != tt.wantHost || got.BearerToken != "secret-token" {
+			t.Fatalf("context %q: got host %s token %q, want host %s", tt.context, got.Host, got.BearerToken, tt.wantHost)
+		}
+	}
+
+	if _, err := NewClientFromKubeconfig([]byte("not: [a kubeconfig"), "", ""); err == nil {
+		t.Fatal("expected an error for an invalid kubeconfig")
+	}
+}
+
+func TestWithKubeContext(t *testing.T) {
+	config, err := clientcmd.Load([]byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: primary
+  cluster:
+    server: https://primary.example.com
+- name: remote
+  cluster:
+    server: https://remote.example.com
+contexts:
+- name: primary
+  context:
+    cluster: primary
+- name: remote
+  context:
+    cluster: remote
+current-context: primary
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConfig := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{})
+
+	c, err := NewClientForConfig(clientConfig, "", WithKubeContext("remote"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.RESTConfig().Host; got != "https://remote.example.com" {
+		t.Fatalf("got host %s, want the host of the remote context", got)
+	}
+	if _, err := NewClientForConfig(clientConfig, "", WithKubeContext("missing")); err == nil {
+		t.Fatal("expected an error for an unknown context")
+	}
+
+	// The overrides of the kubeconfig loader are kept.
+	overridden := newOverridableClientConfig(clientcmd.ConfigOverrides{
+		AuthInfo: api.AuthInfo{Token: "override-token"},
+		Context:  api.Context{Namespace: "istio-system"},
+	}, func(overrides *clientcmd.ConfigOverrides) clientcmd.ClientConfig {
+		return clientcmd.NewDefaultClientConfig(*config, overrides)
+	})
+	c, err = NewClientForConfig(overridden, "", WithKubeContext("remote"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.RESTConfig(); got.Host != "https://remote.example.com" || got.BearerToken != "override-token" {
+		t.Fatalf("got host %s and token %q, want the remote context with the overridden token", got.Host, got.BearerToken)
+	}
+	if ns, _, err := c.Factory().ToRawKubeConfigLoader().Namespace(); err != nil || ns != "istio-system" {
+		t.Fatalf("got namespace %q (%v), want the overridden namespace", ns, err)
+	}
+}
+
+func TestRESTClientFor(t *testing.T) {
+	c := newTestServerClient(t, http.NotFoundHandler())
+	cases := []struct {
+		gv   schema.GroupVersion
+		want string
+	}{
+		{
+			gv:   schema.GroupVersion{Group: "networking.istio.io", Version: "v1beta1"},
+			want: "/apis/networking.istio.io/v1beta1/namespaces/default/virtualservices",
+		},
+		{
+			gv:   schema.GroupVersion{Version: "v1"},
+			want: "/api/v1/namespaces/default/virtualservices",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.gv.String(), func(t *testing.T) {
+			restClient, err := c.RESTClientFor(tt.gv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := restClient.Get().Namespace("default").Resource("virtualservices").URL().Path; got != tt.want {
+				t.Fatalf("got path %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		objects   []runtime.Object
+		namespace string
+	}{
+		{name: "allowed", namespace: "istio-control"},
+		{name: "discovered namespace", objects: []runtime.Object{istiodDeployment("istiod", "istio-control")}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClient(tt.objects...)
+			var reviewed *kubeApiAuthorization.ResourceAttributes
+			c.Interface.(*fake.Clientset).PrependReactor("create", "selfsubjectaccessreviews",
+				func(action k8sTesting.Action) (bool, runtime.Object, error) {
+					review := action.(k8sTesting.CreateAction).GetObject().(*kubeApiAuthorization.SelfSubjectAccessReview)
+					reviewed = review.Spec.ResourceAttributes
+					review.Status.Allowed = true
+					return true, review, nil
+				})
+			if err := c.Preflight(context.Background(), tt.namespace); err != nil {
+				t.Fatal(err)
+			}
+			want := &kubeApiAuthorization.ResourceAttributes{Namespace: "istio-control", Verb: "list", Resource: "pods"}
+			if !reflect.DeepEqual(reviewed, want) {
+				t.Fatalf("got access review of %+v, want %+v", reviewed, want)
+			}
+		})
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		c := newFakeClient()
+		c.Interface.(*fake.Clientset).PrependReactor("create", "selfsubjectaccessreviews",
+			func(action k8sTesting.Action) (bool, runtime.Object, error) {
+				review := action.(k8sTesting.CreateAction).GetObject().(*kubeApiAuthorization.SelfSubjectAccessReview)
+				review.Status.Reason = "RBAC: no role binding"
+				return true, review, nil
+			})
+		err := c.Preflight(context.Background(), "istio-system")
+		if err == nil || !strings.Contains(err.Error(), "RBAC: no role binding") {
+			t.Fatalf("got error %v, want the reason of the denied access", err)
+		}
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+		c, err := NewClientForConfig(NewClientConfigForRestConfig(&rest.Config{Host: srv.URL}), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.Preflight(context.Background(), "istio-system")
+		if err == nil || !strings.Contains(err.Error(), "unable to reach") {
+			t.Fatalf("got error %v, want an unreachable API server", err)
+		}
+	})
+}
+
+func TestFactory(t *testing.T) {
+	c := newTestServerClient(t, http.NotFoundHandler())
+	if c.Factory() == nil {
+		t.Fatal("got nil factory")
+	}
+	restConfig, err := c.Factory().ToRESTConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restConfig.Host != c.RESTConfig().Host {
+		t.Fatalf("got factory host %s, want %s", restConfig.Host, c.RESTConfig().Host)
+	}
+}
+
+// customFactory is a util.Factory customized by its creator, setting the QPS of its clients and using its
+// own validator.
+type customFactory struct {
+	util.Factory
+}
+
+var errCustomValidator = errors.New("custom validator")
+
+func (f *customFactory) ToRESTConfig() (*rest.Config, error) {
+	restConfig, err := f.Factory.ToRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+	restConfig.QPS = 42
+	return restConfig, nil
+}
+
+func (f *customFactory) Validator(bool) (validation.Schema, error) {
+	return nil, errCustomValidator
+}
+
+func TestFactoryCustomizations(t *testing.T) {
+	factory := &customFactory{Factory: newClientFactory(NewClientConfigForRestConfig(&rest.Config{Host: "https://10.0.0.1"}))}
+	c, err := NewClient(factory, "", WithUserAgent("istio-operator/1.7.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Factory().Validator(true); err != errCustomValidator {
+		t.Fatalf("got validator error %v, want the one of the custom factory", err)
+	}
+	restConfig, err := c.Factory().ToRESTConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, config := range []*rest.Config{restConfig, c.RESTConfig()} {
+		if config.QPS != 42 || config.UserAgent != "istio-operator/1.7.0" {
+			t.Fatalf("got QPS %v and user agent %q, want the ones of the factory and of the options", config.QPS, config.UserAgent)
+		}
+	}
+}
+
+func TestGetIstioVersionsRetry(t *testing.T) {
+	cases := []struct {
+		name         string
+		status       int
+		wantErr      bool
+		wantAttempts int32
+	}{
+		{name: "retry 503", status: http.StatusServiceUnavailable, wantErr: false, wantAttempts: 3},
+		{name: "no retry 404", status: http.StatusNotFound, wantErr: true, wantAttempts: 1},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			c := newTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v1/namespaces/istio-system/pods":
+					writeJSON(t, w, podList(istioPod("istiod-1", "istio-system", "istiod")))
+				case "/api/v1/namespaces/istio-system/pods/istiod-1:15014/proxy/version":
+					if atomic.AddInt32(&attempts, 1) <= 2 {
+						w.WriteHeader(tt.status)
+						return
+					}
+					_, _ = w.Write([]byte("1.7.0-9c900ba74d10a1affe7c23557ef0eebd6103b03c-Clean"))
+				default:
+					http.NotFound(w, r)
+				}
+			}), WithRetryPolicy(RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond}))
+
+			info, err := c.GetIstioVersions(context.Background(), "istio-system")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetIstioVersions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(&attempts); got != tt.wantAttempts {
+				t.Fatalf("got %d attempts, want %d", got, tt.wantAttempts)
+			}
+			if !tt.wantErr && ((*info)[0].Info.Version != "1.7.0") {
+				t.Fatalf("unexpected version: %+v", *info)
+			}
+		})
+	}
+}
+
+func TestGetIstioPodVersions(t *testing.T) {
+	c := newTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/namespaces/istio-system/pods":
+			writeJSON(t, w, podList(istioPod("istiod-1", "istio-system", "istiod"), istioPod("istiod-2", "istio-system", "istiod")))
+		case "/api/v1/namespaces/istio-system/pods/istiod-1:15014/proxy/version":
+			_, _ = w.Write([]byte("1.7.0-9c900ba74d10a1affe7c23557ef0eebd6103b03c-Clean"))
+		case "/api/v1/namespaces/istio-system/pods/istiod-2:15014/proxy/version":
+			_, _ = w.Write([]byte("1.6.5-ab12cd34ab12cd34ab12cd34ab12cd34ab12cd34-Clean"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	versions, err := c.GetIstioPodVersions(context.Background(), "istio-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, v := range versions {
+		if v.Namespace != "istio-system" || v.Component != "istiod" {
+			t.Fatalf("unexpected version entry: %+v", v)
+		}
+		got[v.Pod] = v.Info.Version
+	}
+	if want := map[string]string{"istiod-1": "1.7.0", "istiod-2": "1.6.5"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got versions by pod %v, want %v", got, want)
+	}
+
+	out, err := json.Marshal(versions[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{`"component":"istiod"`, `"pod":"istiod-`, `"namespace":"istio-system"`} {
+		if !strings.Contains(string(out), field) {
+			t.Fatalf("JSON %s does not contain %s", out, field)
+		}
+	}
+}
+
+func TestGetIstioPodVersionsSlowPod(t *testing.T) {
+	defer func(timeout time.Duration) { versionRequestTimeout = timeout }(versionRequestTimeout)
+	versionRequestTimeout = 100 * time.Millisecond
+
+	release := make(chan struct{})
+	defer close(release)
+	c := newTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/namespaces/istio-system/pods":
+			writeJSON(t, w, podList(
+				istioPod("istiod-1", "istio-system", "istiod"),
+				istioPod("istiod-2", "istio-system", "istiod"),
+				istioPod("istiod-3", "istio-system", "istiod"),
+			))
+		case "/api/v1/namespaces/istio-system/pods/istiod-2:15014/proxy/version":
+			// Hangs until the test ends, past the timeout of the request.
+			<-release
+		case "/api/v1/namespaces/istio-system/pods/istiod-1:15014/proxy/version",
+			"/api/v1/namespaces/istio-system/pods/istiod-3:15014/proxy/version":
+			_, _ = w.Write([]byte("1.7.0-9c900ba74d10a1affe7c23557ef0eebd6103b03c-Clean"))
+		default:
+			http.NotFound(w, r)
+		}
+	}), WithRetryPolicy(RetryPolicy{Attempts: 1}))
+
+	start := time.Now()
+	versions, err := c.GetIstioPodVersions(context.Background(), "istio-system")
+	if err == nil || !strings.Contains(err.Error(), "istiod-2") {
+		t.Fatalf("got error %v, want an error for the slow pod", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("versions took %v, want the slow pod to time out", elapsed)
+	}
+	var pods []string
+	for _, v := range versions {
+		pods = append(pods, v.Pod)
+	}
+	if want := []string{"istiod-1", "istiod-3"}; !reflect.DeepEqual(pods, want) {
+		t.Fatalf("got versions of %v, want %v", pods, want)
+	}
+}
+
+func TestErrNoIstioPods(t *testing.T) {
+	c := newTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/istio-system/pods" {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(t, w, podList())
+	}))
+
+	if _, err := c.GetIstioVersions(context.Background(), "istio-system"); !errors.Is(err, ErrNoIstioPods) {
+		t.Fatalf("GetIstioVersions: got error %v, want ErrNoIstioPods", err)
+	}
+	if _, err := c.AllDiscoveryDo(context.Background(), "istio-system", "/debug/syncz"); !errors.Is(err, ErrNoIstioPods) {
+		t.Fatalf("AllDiscoveryDo: got error %v, want ErrNoIstioPods", err)
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	var mu sync.Mutex
+	var logged []RequestInfo
+	c := newTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(t, w, podList(istioPod("istiod-1", "istio-system", "istiod")))
+	}), WithRequestLogger(func(info RequestInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		logged = append(logged, info)
+	}))
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetIstioPods(context.Background(), "istio-system", map[string]string{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(logged) != 2 {
+		t.Fatalf("got %d logged requests, want 2: %+v", len(logged), logged)
+	}
+	for _, info := range logged {
+		if info.Method != "GET" || info.Path != "/api/v1/namespaces/istio-system/pods" || info.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected request: %+v", info)
+		}
+	}
+}
+
+func TestImpersonation(t *testing.T) {
+	var mu sync.Mutex
+	var headers []http.Header
+	c := newTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header)
+		mu.Unlock()
+		writeJSON(t, w, podList())
+	}), WithImpersonation(rest.ImpersonationConfig{
+		UserName: "system:serviceaccount:default:bookinfo-productpage",
+		Groups:   []string{"system:serviceaccounts", "system:authenticated"},
+	}))
+
+	if _, err := c.GetIstioPods(context.Background(), "default", map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.PodsForSelector(context.Background(), "default", "app=productpage"); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(headers) != 2 {
+		t.Fatalf("got %d requests, want 2", len(headers))
+	}
+	for _, h := range headers {
+		if h.Get("Impersonate-User") != "system:serviceaccount:default:bookinfo-productpage" {
+			t.Fatalf("missing Impersonate-User header: %v", h)
+		}
+		if groups := h["Impersonate-Group"]; !reflect.DeepEqual(groups, []string{"system:serviceaccounts", "system:authenticated"}) {
+			t.Fatalf("unexpected Impersonate-Group headers: %v", groups)
+		}
+	}
+}
+
+// execFunc is a remotecommand.Executor running the function.
+type execFunc func(remotecommand.StreamOptions) error
+
+func (f execFunc) Stream(opts remotecommand.StreamOptions) error {
+	return f(opts)
+}
+
+func TestPodExecCombined(t *testing.T) {
+	c := newFakeClient()
+	withFakeExec(t, c)
+	var fail error
+	c.executorFactory = func(_ *rest.Config, _ string, _ *url.URL) (remotecommand.Executor, error) {
+		return execFunc(func(opts remotecommand.StreamOptions) error {
+			_, _ = io.WriteString(opts.Stdout, "starting\n")
+			_, _ = io.WriteString(opts.Stderr, "warning: no config\n")
+			_, _ = io.WriteString(opts.Stdout, "done\n")
+			return fail
+		}), nil
+	}
+
+	out, err := c.PodExecCombined(context.Background(), "productpage", "default", "istio-proxy", "pilot-agent request GET ready")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "starting\nwarning: no config\ndone\n"; out != want {
+		t.Fatalf("got output %q, want %q", out, want)
+	}
+
+	fail = errors.New("command terminated with exit code 1")
+	out, err = c.PodExecCombined(context.Background(), "productpage", "default", "istio-proxy", "pilot-agent request GET ready")
+	if err == nil || !strings.Contains(out, "warning: no config") {
+		t.Fatalf("got output %q and error %v, want the output of the failed command", out, err)
+	}
+}
+
+func TestPodExecCanceled(t *testing.T) {
+	c := newFakeClient()
+	withFakeExec(t, c)
+	started, release := make(chan struct{}), make(chan struct{})
+	finished := make(chan struct{})
+	c.executorFactory = func(_ *rest.Config, _ string, _ *url.URL) (remotecommand.Executor, error) {
+		return execFunc(func(opts remotecommand.StreamOptions) error {
+			defer close(finished)
+			_, _ = io.WriteString(opts.Stdout, "waiting\n")
+			close(started)
+			<-release
+			// Output of the abandoned command is dropped.
+			_, _ = io.WriteString(opts.Stdout, "done\n")
+			return nil
+		}), nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	out, err := c.PodExecCombined(ctx, "productpage", "default", "istio-proxy", "sleep 3600")
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Fatalf("got error %v, want the exec to be canceled", err)
+	}
+	if out != "waiting\n" {
+		t.Fatalf("got output %q, want the output written before the cancellation", out)
+	}
+	close(release)
+	<-finished
+
+	if _, err := c.PodExecCombined(ctx, "productpage", "default", "istio-proxy", "true"); err == nil {
+		t.Fatal("expected an error for an exec with a done context")
+	}
+}
+
+func TestPodExecWithEnv(t *testing.T) {
+	c := newFakeClient()
+	withFakeExec(t, c)
+	var commands [][]string
+	c.executorFactory = func(_ *rest.Config, _ string, u *url.URL) (remotecommand.Executor, error) {
+		command := u.Query()["command"]
+		commands = append(commands, command)
+		return execFunc(func(opts remotecommand.StreamOptions) error {
+			// Emulate env running printenv.
+			if len(command) == 0 || command[0] != "env" {
+				return fmt.Errorf("unexpected command %q", command)
+			}
+			env := map[string]string{}
+			args := command[1:]
+			for len(args) > 0 && strings.Contains(args[0], "=") {
+				kv := strings.SplitN(args[0], "=", 2)
+				env[kv[0]] = kv[1]
+				args = args[1:]
+			}
+			if len(args) != 2 || args[0] != "printenv" {
+				return fmt.Errorf("unexpected command %q", args)
+			}
+			_, _ = io.WriteString(opts.Stdout, env[args[1]]+"\n")
+			return nil
+		}), nil
+	}
+
+	value := `it's a "quoted" $VALUE; with spaces`
+	env := map[string]string{"ISTIO_META_DNS_CAPTURE": value, "PROXY_CONFIG": "{}"}
+	stdout, _, err := c.PodExecWithEnv(context.Background(), "productpage", "default", "istio-proxy", env,
+		[]string{"printenv", "ISTIO_META_DNS_CAPTURE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout != value+"\n" {
+		t.Fatalf("got output %q, want %q", stdout, value+"\n")
+	}
+	want := []string{"env", "ISTIO_META_DNS_CAPTURE=" + value, "PROXY_CONFIG={}", "printenv", "ISTIO_META_DNS_CAPTURE"}
+	if len(commands) != 1 || !reflect.DeepEqual(commands[0], want) {
+		t.Fatalf("got commands %q, want %q", commands, want)
+	}
+
+	for _, name := range []string{"", "A=B", "-i", "--unset", "1A", "A B"} {
+		if _, _, err := c.PodExecWithEnv(context.Background(), "productpage", "default", "istio-proxy",
+			map[string]string{name: "c"}, []string{"printenv", "A"}); err == nil {
+			t.Errorf("expected an error for the invalid variable name %q", name)
+		}
+	}
+	if _, _, err := c.PodExecWithEnv(context.Background(), "productpage", "default", "istio-proxy",
+		map[string]string{"A": "b"}, []string{"B=c", "printenv"}); err == nil {
+		t.Error("expected an error for a command taken as a variable")
+	}
+	if len(commands) != 1 {
+		t.Fatalf("got commands %q, want invalid commands not to be run", commands)
+	}
+}
+
+func TestPodExecTransientErrorRetry(t *testing.T) {
+	c := newFakeClient()
+	withFakeExec(t, c)
+	var errs []error
+	var attempts int
+	c.executorFactory = func(_ *rest.Config, _ string, _ *url.URL) (remotecommand.Executor, error) {
+		return execFunc(func(opts remotecommand.StreamOptions) error {
+			attempts++
+			if len(errs) > 0 {
+				err := errs[0]
+				errs = errs[1:]
+				return err
+			}
+			_, _ = opts.Stdout.Write([]byte("ok"))
+			return nil
+		}), nil
+	}
+
+	cases := []struct {
+		name         string
+		errs         []error
+		opts         []PodExecOption
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:         "transient error retried",
+			errs:         []error{fmt.Errorf(`container not found ("istio-proxy")`)},
+			opts:         []PodExecOption{WithTransientErrorRetry(5 * time.Second)},
+			wantAttempts: 2,
+		},
+		{
+			name:         "transient error without retry",
+			errs:         []error{fmt.Errorf(`container not found ("istio-proxy")`)},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "other errors fail fast",
+			errs:         []error{fmt.Errorf("command terminated with exit code 126")},
+			opts:         []PodExecOption{WithTransientErrorRetry(5 * time.Second)},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			errs, attempts = tt.errs, 0
+			stdout, _, err := c.PodExec("productpage", "default", "istio-proxy", "pilot-agent request GET ready", tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && stdout != "ok" {
+				t.Fatalf("got stdout %q, want ok", stdout)
+			}
+			if attempts != tt.wantAttempts {
+				t.Fatalf("got %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestPodExecDefaultContainer(t *testing.T) {
+	pod := func(name string, annotations map[string]string) *kubeApiCore.Pod {
+		return &kubeApiCore.Pod{
+			ObjectMeta: kubeApiMeta.ObjectMeta{Name: name, Namespace: "default", Annotations: annotations},
+			Spec: kubeApiCore.PodSpec{
+				Containers: []kubeApiCore.Container{{Name: "istio-proxy"}, {Name: "productpage"}},
+			},
+		}
+	}
+	c := newFakeClient(
+		pod("annotated", map[string]string{"kubectl.kubernetes.io/default-container": "productpage"}),
+		pod("unknown", map[string]string{"kubectl.kubernetes.io/default-container": "reviews"}),
+		pod("plain", nil),
+	)
+	withFakeExec(t, c)
+	var containers []string
+	c.executorFactory = func(_ *rest.Config, _ string, u *url.URL) (remotecommand.Executor, error) {
+		containers = append(containers, u.Query().Get("container"))
+		return execFunc(func(remotecommand.StreamOptions) error { return nil }), nil
+	}
+
+	cases := []struct {
+		pod       string
+		container string
+		want      string
+	}{
+		{pod: "annotated", want: "productpage"},
+		{pod: "annotated", container: "istio-proxy", want: "istio-proxy"},
+		{pod: "unknown", want: "istio-proxy"},
+		{pod: "plain", want: "istio-proxy"},
+	}
+	for _, tt := range cases {
+		containers = nil
+		if _, _, err := c.PodExec(tt.pod, "default", tt.container, "ls"); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(containers, []string{tt.want}) {
+			t.Fatalf("%s: got exec into containers %v, want %s", tt.pod, containers, tt.want)
+		}
+	}
+}
+
+func TestGetPod(t *testing.T) {
+	pod := istioPod("istiod-1", "istio-system", "istiod")
+	c := newFakeClient(&pod)
+
+	got, err := c.GetPod(context.Background(), "istio-system", "istiod-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "istiod-1" || got.Labels["app"] != "istiod" {
+		t.Fatalf("got pod %s/%s with labels %v, want istio-system/istiod-1", got.Namespace, got.Name, got.Labels)
+	}
+
+	_, err = c.GetPod(context.Background(), "istio-system", "istiod-2")
+	if err == nil || err.Error() != "pod istio-system/istiod-2 not found" {
+		t.Fatalf("got error %v, want pod istio-system/istiod-2 not found", err)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []ClientOption
+		want string
+	}{
+		{name: "default", want: defaultUserAgent()},
+		{name: "override", opts: []ClientOption{WithUserAgent("istio-operator/1.7.0")}, want: "istio-operator/1.7.0"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var agents []string
+			c := newTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				agents = append(agents, r.UserAgent())
+				mu.Unlock()
+				writeJSON(t, w, podList())
+			}), tt.opts...)
+
+			if _, err := c.GetIstioPods(context.Background(), "istio-system", map[string]string{}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.PodsForSelector(context.Background(), "default", "app=productpage"); err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if want := []string{tt.want, tt.want}; !reflect.DeepEqual(agents, want) {
+				t.Fatalf("got user agents %v, want %v", agents, want)
+			}
+		})
+	}
+
+	if !strings.HasPrefix(defaultUserAgent(), "istio/") {
+		t.Fatalf("default user agent %q doesn't identify Istio", defaultUserAgent())
+	}
+}
+
+// recordingTransport records the URLs of the requests it sends.
+type recordingTransport struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.urls = append(t.urls, req.URL.String())
+	t.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestEnvoyHTTPClient(t *testing.T) {
+	transport := &recordingTransport{}
+	c := newTestServerClient(t, http.NotFoundHandler(), WithEnvoyHTTPClient(&http.Client{Transport: transport})).(*client)
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"productpage": envoyResponse("/server_info", `{"state": "LIVE"}`),
+	})
+
+	if _, err := c.EnvoyDo(context.Background(), "productpage", "default", "GET", "server_info", nil); err != nil {
+		t.Fatal(err)
+	}
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	if len(transport.urls) != 1 || !strings.HasSuffix(transport.urls[0], "/server_info") {
+		t.Fatalf("got requests %v, want a single /server_info request", transport.urls)
+	}
+
+	if got := newTestServerClient(t, http.NotFoundHandler()).(*client).httpClient; got == http.DefaultClient ||
+		got.Timeout != envoyRequestTimeout {
+		t.Fatalf("got default Envoy client %+v, want a dedicated client with a timeout", got)
+	}
+
+	// A nil client selects the default one, including when requests are logged.
+	for _, opts := range [][]ClientOption{
+		{WithEnvoyHTTPClient(nil)},
+		{WithEnvoyHTTPClient(nil), WithRequestLogger(func(RequestInfo) {})},
+	} {
+		if got := newTestServerClient(t, http.NotFoundHandler(), opts...).(*client).httpClient; got == nil ||
+			got.Timeout != envoyRequestTimeout {
+			t.Fatalf("got Envoy client %+v for a nil client, want the default client", got)
+		}
+	}
+}
+
+func TestTLSClientCert(t *testing.T) {
+	ca := newTestCert(t, "root", true, time.Now().Add(time.Hour), nil)
+	cert := newTestCert(t, "istioctl", false, time.Now().Add(time.Hour), ca)
+	other := newTestCert(t, "other", false, time.Now().Add(time.Hour), ca)
+	clientConfig := NewClientConfigForRestConfig(&rest.Config{
+		Host:            "https://127.0.0.1:6443",
+		TLSClientConfig: rest.TLSClientConfig{CertFile: "/etc/kube/client.crt", KeyFile: "/etc/kube/client.key"},
+	})
+
+	c, err := NewClientForConfig(clientConfig, "", WithTLSClientCert(cert.certPEM, cert.keyPEM, ca.certPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig := c.RESTConfig().TLSClientConfig
+	if !bytes.Equal(tlsConfig.CertData, cert.certPEM) || !bytes.Equal(tlsConfig.KeyData, cert.keyPEM) ||
+		!bytes.Equal(tlsConfig.CAData, ca.certPEM) {
+		t.Fatalf("client certificate not set in the TLS config: %+v", tlsConfig)
+	}
+	if tlsConfig.CertFile != "" || tlsConfig.KeyFile != "" {
+		t.Fatalf("got certificate files %s %s, want them replaced", tlsConfig.CertFile, tlsConfig.KeyFile)
+	}
+
+	if _, err := NewClientForConfig(clientConfig, "", WithTLSClientCert(cert.certPEM, other.keyPEM, nil)); err == nil {
+		t.Fatal("expected an error for a mismatched certificate and key")
+	}
+	if _, err := NewClientForConfig(clientConfig, "", WithTLSClientCert(cert.certPEM, cert.keyPEM, []byte("ca"))); err == nil {
+		t.Fatal("expected an error for an invalid CA certificate")
+	}
+}
+
+func TestPodLogsPartialContainerName(t *testing.T) {
+	c := newFakeClient(&kubeApiCore.Pod{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: "productpage", Namespace: "default"},
+		Spec: kubeApiCore.PodSpec{
+			InitContainers: []kubeApiCore.Container{{Name: "istio-init"}},
+			Containers:     []kubeApiCore.Container{{Name: "istio-proxy"}, {Name: "app"}},
+		},
+	})
+	var containers []string
+	c.Interface.(*fake.Clientset).PrependReactor("get", "pods", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() == "log" {
+			containers = append(containers, action.(k8sTesting.GenericAction).GetValue().(*kubeApiCore.PodLogOptions).Container)
+		}
+		return false, nil, nil
+	})
+
+	for _, name := range []string{"proxy", "istio-proxy", "app", "init"} {
+		if _, err := c.PodLogs(context.Background(), "productpage", "default", name, false); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	if want := []string{"istio-proxy", "istio-proxy", "app", "istio-init"}; !reflect.DeepEqual(containers, want) {
+		t.Fatalf("got logs of containers %v, want %v", containers, want)
+	}
+
+	for _, name := range []string{"istio", "missing"} {
+		if _, err := c.PodLogs(context.Background(), "productpage", "default", name, false); err == nil {
+			t.Fatalf("expected an error for %q", name)
+		}
+	}
+}
+
+func TestGetCrashedContainerLogs(t *testing.T) {
+	c := newFakeClient(&kubeApiCore.Pod{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: "productpage", Namespace: "default"},
+		Spec: kubeApiCore.PodSpec{
+			Containers: []kubeApiCore.Container{{Name: "productpage"}, {Name: "istio-proxy"}},
+		},
+		Status: kubeApiCore.PodStatus{
+			ContainerStatuses: []kubeApiCore.ContainerStatus{
+				{Name: "productpage", RestartCount: 5, State: kubeApiCore.ContainerState{
+					Waiting: &kubeApiCore.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+				}},
+				{Name: "istio-proxy", State: kubeApiCore.ContainerState{Running: &kubeApiCore.ContainerStateRunning{}}},
+			},
+		},
+	})
+	var logOptions []kubeApiCore.PodLogOptions
+	c.Interface.(*fake.Clientset).PrependReactor("get", "pods", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() == "log" {
+			logOptions = append(logOptions, *action.(k8sTesting.GenericAction).GetValue().(*kubeApiCore.PodLogOptions))
+		}
+		return false, nil, nil
+	})
+
+	logs, restarts, err := c.GetCrashedContainerLogs(context.Background(), "productpage", "default", "productpage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logs != "fake logs" || restarts != 5 {
+		t.Fatalf("got logs %q after %d restarts, want the fake logs after 5", logs, restarts)
+	}
+	if want := []kubeApiCore.PodLogOptions{{Container: "productpage", Previous: true}}; !reflect.DeepEqual(logOptions, want) {
+		t.Fatalf("got log requests %+v, want %+v", logOptions, want)
+	}
+
+	logOptions = nil
+	logs, restarts, err = c.GetCrashedContainerLogs(context.Background(), "productpage", "default", "istio-proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logs != "" || restarts != 0 || len(logOptions) != 0 {
+		t.Fatalf("got logs %q after %d restarts, want no logs for a container which never restarted", logs, restarts)
+	}
+}
+
+func TestAllContainerLogs(t *testing.T) {
+	c := newFakeClient(&kubeApiCore.Pod{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: "productpage", Namespace: "default"},
+		Spec: kubeApiCore.PodSpec{
+			InitContainers: []kubeApiCore.Container{{Name: "istio-init"}},
+			Containers:     []kubeApiCore.Container{{Name: "productpage"}, {Name: "istio-proxy"}},
+		},
+		Status: kubeApiCore.PodStatus{
+			InitContainerStatuses: []kubeApiCore.ContainerStatus{{
+				Name:  "istio-init",
+				State: kubeApiCore.ContainerState{Terminated: &kubeApiCore.ContainerStateTerminated{}},
+			}},
+			ContainerStatuses: []kubeApiCore.ContainerStatus{
+				{Name: "productpage", State: kubeApiCore.ContainerState{
+					Waiting: &kubeApiCore.ContainerStateWaiting{Reason: "ContainerCreating"},
+				}},
+				{Name: "istio-proxy", State: kubeApiCore.ContainerState{Running: &kubeApiCore.ContainerStateRunning{}}},
+			},
+		},
+	})
+
+	logs, err := c.AllContainerLogs(context.Background(), "productpage", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fake clientset returns the same logs for every container.
+	want := map[string]string{"istio-init": "fake logs", "istio-proxy": "fake logs"}
+	if !reflect.DeepEqual(logs, want) {
+		t.Fatalf("got logs %v, want %v", logs, want)
+	}
+}
+
+func TestCollectLogs(t *testing.T) {
+	pod := func(name, namespace string) kubeApiCore.Pod {
+		p := istioPod(name, namespace, "reviews")
+		p.Spec.Containers = []kubeApiCore.Container{{Name: "reviews"}, {Name: "istio-proxy"}}
+		return p
+	}
+	var mu sync.Mutex
+	var queries []url.Values
+	c := newTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/pods":
+			if got := r.URL.Query().Get("labelSelector"); got != "app=reviews" {
+				t.Errorf("got label selector %q, want app=reviews", got)
+			}
+			writeJSON(t, w, podList(pod("reviews-v1", "default"), pod("reviews-v2", "default"), pod("reviews-v1", "staging")))
+		case "/api/v1/namespaces/default/pods/reviews-v1/log", "/api/v1/namespaces/staging/pods/reviews-v1/log":
+			mu.Lock()
+			queries = append(queries, r.URL.Query())
+			mu.Unlock()
+			ns := path.Base(path.Dir(path.Dir(path.Dir(r.URL.Path))))
+			_, _ = w.Write([]byte("logs of " + ns + " " + r.URL.Query().Get("container")))
+		default:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+
+	cases := []struct {
+		container     string
+		wantContainer string
+	}{
+		{wantContainer: "reviews"},
+		{container: "istio-proxy", wantContainer: "istio-proxy"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.wantContainer, func(t *testing.T) {
+			queries = nil
+			logs, err := c.CollectLogs(context.Background(), "", "app=reviews", tt.container, 100)
+			if err == nil || !strings.Contains(err.Error(), "default/reviews-v2") {
+				t.Fatalf("got error %v, want an error for default/reviews-v2", err)
+			}
+			want := map[string]string{
+				"default/reviews-v1": "logs of default " + tt.wantContainer,
+				"staging/reviews-v1": "logs of staging " + tt.wantContainer,
+			}
+			if !reflect.DeepEqual(logs, want) {
+				t.Fatalf("got logs %v, want %v", logs, want)
+			}
+			for _, query := range queries {
+				if query.Get("container") != tt.wantContainer || query.Get("tailLines") != "100" {
+					t.Fatalf("got log query %v, want the last 100 lines of the %s container", query, tt.wantContainer)
+				}
+			}
+		})
+	}
+}
+
+func TestGetIstioPodsRunning(t *testing.T) {
+	var queries []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+		writeJSON(t, w, podList(istioPod("istiod-1", "istio-system", "istiod")))
+	}))
+	t.Cleanup(srv.Close)
+	c, err := NewClientForConfig(NewClientConfigForRestConfig(&rest.Config{Host: srv.URL}), "canary")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, extraLabels := range []map[string]string{{"app": "istiod"}, nil} {
+		if _, err := c.GetIstioPodsRunning(context.Background(), "istio-system", extraLabels); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []url.Values{
+		{"fieldSelector": {"status.phase=Running"}, "labelSelector": {"app=istiod,istio.io/rev=canary"}},
+		{"fieldSelector": {"status.phase=Running"}, "labelSelector": {"istio.io/rev=canary"}},
+	}
+	if !reflect.DeepEqual(queries, want) {
+		t.Fatalf("got queries %v, want %v", queries, want)
+	}
+}
+
+func TestGetGatewayPods(t *testing.T) {
+	pods := []kubeApiCore.Pod{
+		istioPod("istio-ingressgateway-1", "istio-system", "ingressgateway"),
+		istioPod("istio-ingressgateway-2", "istio-system", "ingressgateway"),
+		istioPod("istio-egressgateway-1", "istio-system", "egressgateway"),
+		istioPod("istiod-1", "istio-system", "istiod"),
+	}
+	c := newTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+		if err != nil {
+			t.Errorf("invalid label selector: %v", err)
+		}
+		var matching []kubeApiCore.Pod
+		for _, pod := range pods {
+			if selector.Matches(labels.Set(pod.Labels)) {
+				matching = append(matching, pod)
+			}
+		}
+		writeJSON(t, w, podList(matching...))
+	}))
+
+	for gatewayType, want := range map[string][]string{
+		IngressGateway: {"istio-ingressgateway-1", "istio-ingressgateway-2"},
+		EgressGateway:  {"istio-egressgateway-1"},
+	} {
+		got, err := c.GetGatewayPods(context.Background(), "istio-system", gatewayType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names := podNames(got); !reflect.DeepEqual(names, want) {
+			t.Fatalf("got %s pods %v, want %v", gatewayType, names, want)
+		}
+	}
+
+	if _, err := c.GetGatewayPods(context.Background(), "istio-system", "istiod"); err == nil {
+		t.Fatal("expected an error for an invalid gateway type")
+	}
+}
+
+func TestGetIstioPodsMatching(t *testing.T) {
+	istiod := istioPod("istiod-1", "istio-system", "istiod")
+	ingress := istioPod("istio-ingressgateway-1", "istio-system", "ingressgateway")
+	c := newTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("labelSelector") {
+		case "app=istiod":
+			writeJSON(t, w, podList(istiod))
+		case "istio":
+			writeJSON(t, w, podList(istiod, ingress))
+		default:
+			writeJSON(t, w, podList())
+		}
+	}))
+
+	pods, err := c.GetIstioPodsMatching(context.Background(), "istio-system", []labels.Selector{
+		labels.SelectorFromSet(labels.Set{"app": "istiod"}),
+		labels.NewSelector().Add(mustRequirement(t, "istio", selection.Exists)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods) != 2 || pods[0].Name != istiod.Name || pods[1].Name != ingress.Name {
+		t.Fatalf("unexpected pods: %v", pods)
+	}
+}
+
+func mustRequirement(t *testing.T, key string, op selection.Operator, vals ...string) labels.Requirement {
+	t.Helper()
+	r, err := labels.NewRequirement(key, op, vals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *r
+}
+
+// discoveryHandler serves the discovery documents for ConfigMaps and Deployments, so that kubectl
+// machinery can map resources, and delegates all other requests to next.
+func discoveryHandler(next http.Handler) http.Handler {
+	documents := map[string]string{
+		"/api": `{"kind":"APIVersions","versions":["v1"],
+			"serverAddressByClientCIDRs":[{"clientCIDR":"0.0.0.0/0","serverAddress":"127.0.0.1"}]}`,
+		"/apis": `{"kind":"APIGroupList","apiVersion":"v1","groups":[{"name":"apps",
+			"versions":[{"groupVersion":"apps/v1","version":"v1"}],
+			"preferredVersion":{"groupVersion":"apps/v1","version":"v1"}}]}`,
+		"/api/v1": `{"kind":"APIResourceList","groupVersion":"v1","resources":[
+			{"name":"configmaps","singularName":"","namespaced":true,"kind":"ConfigMap",
+				"verbs":["create","delete","get","list","patch","update","watch"]},
+			{"name":"pods","singularName":"","namespaced":true,"kind":"Pod",
+				"verbs":["create","delete","get","list","patch","update","watch"]}]}`,
+		"/apis/apps/v1": `{"kind":"APIResourceList","apiVersion":"v1","groupVersion":"apps/v1","resources":[
+			{"name":"deployments","singularName":"","namespaced":true,"kind":"Deployment",
+				"verbs":["create","delete","get","list","patch","update","watch"]}]}`,
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if doc, ok := documents[r.URL.Path]; ok && r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(doc))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeYAMLFile writes the given content to a file in a temporary directory and returns its path.
+func writeYAMLFile(t testing.TB, content string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "kube-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	path := filepath.Join(dir, "resources.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const deploymentYAML = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: istio-ingressgateway
+  namespace: istio-system
+`
+
+func TestDeleteYAMLFilesWithOptions(t *testing.T) {
+	cases := []struct {
+		name       string
+		opts       DeleteOptions
+		wantPolicy kubeApiMeta.DeletionPropagation
+	}{
+		{name: "default", opts: DeleteOptions{}, wantPolicy: kubeApiMeta.DeletePropagationBackground},
+		{name: "background", opts: DeleteOptions{Cascade: CascadeBackground}, wantPolicy: kubeApiMeta.DeletePropagationBackground},
+		{name: "foreground", opts: DeleteOptions{Cascade: CascadeForeground}, wantPolicy: kubeApiMeta.DeletePropagationForeground},
+		{name: "orphan", opts: DeleteOptions{Cascade: CascadeOrphan}, wantPolicy: kubeApiMeta.DeletePropagationOrphan},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var deleted []string
+			var policies []kubeApiMeta.DeletionPropagation
+			c := newTestServerClient(t, discoveryHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodDelete:
+					opts := kubeApiMeta.DeleteOptions{}
+					if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+						t.Errorf("failed decoding delete options: %v", err)
+					}
+					deleted = append(deleted, r.URL.Path)
+					if opts.PropagationPolicy != nil {
+						policies = append(policies, *opts.PropagationPolicy)
+					}
+					writeJSON(t, w, &kubeApiMeta.Status{
+						TypeMeta: kubeApiMeta.TypeMeta{Kind: "Status", APIVersion: "v1"},
+						Status:   kubeApiMeta.StatusSuccess,
+					})
+				case http.MethodGet:
+					// The deployment is gone once deleted.
+					if strings.HasSuffix(r.URL.Path, "/istio-ingressgateway") {
+						http.NotFound(w, r)
+						return
+					}
+					writeJSON(t, w, map[string]interface{}{
+						"kind": "DeploymentList", "apiVersion": "apps/v1", "metadata": map[string]interface{}{},
+						"items": []interface{}{},
+					})
+				default:
+					http.NotFound(w, r)
+				}
+			})))
+
+			if err := c.DeleteYAMLFilesWithOptions("", tt.opts, writeYAMLFile(t, deploymentYAML)); err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"/apis/apps/v1/namespaces/istio-system/deployments/istio-ingressgateway"}
+			if !reflect.DeepEqual(deleted, want) {
+				t.Fatalf("deleted %v, want only %v", deleted, want)
+			}
+			if !reflect.DeepEqual(policies, []kubeApiMeta.DeletionPropagation{tt.wantPolicy}) {
+				t.Fatalf("got propagation policies %v, want %v", policies, tt.wantPolicy)
+			}
+		})
+	}
+}
+
+func TestApplyYAMLFilesOutput(t *testing.T) {
+	c := newTestServerClient(t, discoveryHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/openapi/v2":
+			// An empty schema, which does not validate any type.
+			w.Header().Set("Content-Type", "application/com.github.proto-openapi.spec.v2@v1.0+protobuf")
+		case r.URL.Path == "/api/v1/namespaces/istio-system/configmaps/istio" && r.Method == http.MethodGet:
+			http.NotFound(w, r)
+		case r.URL.Path == "/api/v1/namespaces/istio-system/configmaps" && r.Method == http.MethodPost:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.Copy(w, r.Body)
+		default:
+			http.NotFound(w, r)
+		}
+	})))
+	file := writeYAMLFile(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: istio
+  namespace: istio-system
+data:
+  mesh: ""
+`)
+
+	var out bytes.Buffer
+	if err := c.ApplyYAMLFilesWithOptions("", ApplyOptions{Output: &out}, file); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "configmap/istio created" {
+		t.Fatalf("got output %q, want configmap/istio created", got)
+	}
+}
+
+func TestApplyYAMLDir(t *testing.T) {
+	var created []string
+	c := newTestServerClient(t, discoveryHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/openapi/v2":
+			// An empty schema, which does not validate any type.
+			w.Header().Set("Content-Type", "application/com.github.proto-openapi.spec.v2@v1.0+protobuf")
+		case r.URL.Path == "/api/v1/namespaces/istio-system/configmaps" && r.Method == http.MethodPost:
+			cm := &kubeApiCore.ConfigMap{}
+			body, _ := ioutil.ReadAll(r.Body)
+			if err := json.Unmarshal(body, cm); err != nil {
+				t.Errorf("invalid config map: %v", err)
+			}
+			created = append(created, cm.Name)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write(body)
+		default:
+			http.NotFound(w, r)
+		}
+	})))
+	dir, err := ioutil.TempDir("", "kube-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	configMap := func(name string) string {
+		return "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: " + name + "\n  namespace: istio-system\n"
+	}
+	writeTestFile(t, filepath.Join(dir, "b.yaml"), configMap("b"))
+	writeTestFile(t, filepath.Join(dir, "a.yml"), configMap("a"))
+	writeTestFile(t, filepath.Join(dir, "empty.yaml"), "")
+	writeTestFile(t, filepath.Join(dir, "README.md"), "not a manifest")
+	writeTestFile(t, filepath.Join(dir, "base.yaml"), configMap("base"))
+	writeTestFile(t, filepath.Join(dir, "base", "c.yaml"), configMap("c"))
+	writeTestFile(t, filepath.Join(dir, "base", "nested", "d.yaml"), configMap("d"))
+
+	if err := c.ApplyYAMLDir("", dir, false); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "base"}; !reflect.DeepEqual(created, want) {
+		t.Fatalf("got created config maps %v, want %v", created, want)
+	}
+
+	created = nil
+	if err := c.ApplyYAMLDir("", dir, true); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "base", "c", "d"}; !reflect.DeepEqual(created, want) {
+		t.Fatalf("got created config maps %v, want %v", created, want)
+	}
+
+	if err := c.ApplyYAMLDir("", filepath.Join(dir, "missing"), true); err == nil {
+		t.Fatal("expected an error for a missing directory")
+	}
+}
+
+func TestDeleteByLabel(t *testing.T) {
+	configMap := func(name string, cmLabels map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "istio-system", "labels": cmLabels},
+		}}
+	}
+	c := newFakeClient(
+		configMap("istio-canary", map[string]interface{}{"istio.io/rev": "canary"}),
+		configMap("istio-sidecar-injector-canary", map[string]interface{}{"istio.io/rev": "canary"}),
+		configMap("istio", nil),
+	)
+	configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+	if err := c.DeleteByLabel(context.Background(), "istio-system", "istio.io/rev=canary", configMaps); err != nil {
+		t.Fatal(err)
+	}
+	list, err := c.Dynamic().Resource(configMaps).Namespace("istio-system").List(context.Background(), kubeApiMeta.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, item := range list.Items {
+		names = append(names, item.GetName())
+	}
+	if want := []string{"istio"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got remaining config maps %v, want %v", names, want)
+	}
+
+	if err := c.DeleteByLabel(context.Background(), "istio-system", "", configMaps); err == nil {
+		t.Fatal("expected an error for an empty label selector")
+	}
+}
+
+func TestWaitForResourceDeleted(t *testing.T) {
+	c := newFakeClient(&unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "istio-leader", "namespace": "istio-system"},
+	}})
+	configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+	// The config map is still there when the wait times out.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := c.WaitForResourceDeleted(ctx, configMaps, "istio-system", "istio-leader"); err == nil {
+		t.Fatal("expected an error for a resource which is not deleted")
+	}
+
+	deleted := make(chan error, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		deleted <- c.Dynamic().Resource(configMaps).Namespace("istio-system").
+			Delete(context.Background(), "istio-leader", kubeApiMeta.DeleteOptions{})
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.WaitForResourceDeleted(ctx, configMaps, "istio-system", "istio-leader"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-deleted; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteYAMLFilesInvalidFile(t *testing.T) {
+	var deleted []string
+	c := newTestServerClient(t, discoveryHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete:
+			deleted = append(deleted, r.URL.Path)
+			writeJSON(t, w, &kubeApiMeta.Status{
+				TypeMeta: kubeApiMeta.TypeMeta{Kind: "Status", APIVersion: "v1"},
+				Status:   kubeApiMeta.StatusSuccess,
+			})
+		case http.MethodGet:
+			writeJSON(t, w, map[string]interface{}{
+				"kind": "DeploymentList", "apiVersion": "apps/v1", "metadata": map[string]interface{}{},
+				"items": []interface{}{},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	})))
+
+	// The resources of the valid files are deleted even though another file can't be parsed.
+	err := c.DeleteYAMLFiles("",
+		writeYAMLFile(t, deploymentYAML),
+		writeYAMLFile(t, "kind: [invalid"),
+		writeYAMLFile(t, strings.Replace(deploymentYAML, "istio-ingressgateway", "istio-egressgateway", 1)))
+	if err == nil {
+		t.Fatal("expected an error for the invalid file")
+	}
+	sort.Strings(deleted)
+	want := []string{
+		"/apis/apps/v1/namespaces/istio-system/deployments/istio-egressgateway",
+		"/apis/apps/v1/namespaces/istio-system/deployments/istio-ingressgateway",
+	}
+	if !reflect.DeepEqual(deleted, want) {
+		t.Fatalf("deleted %v, want %v", deleted, want)
+	}
+}
+
+// BenchmarkDeleteYAMLFiles compares deleting many files with a single call of DeleteYAMLFiles to one call
+// per file, reporting the number of discovery requests made to the API server.
+func BenchmarkDeleteYAMLFiles(b *testing.B) {
+	var discoveryRequests int32
+	handler := discoveryHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete:
+			writeJSON(b, w, &kubeApiMeta.Status{
+				TypeMeta: kubeApiMeta.TypeMeta{Kind: "Status", APIVersion: "v1"},
+				Status:   kubeApiMeta.StatusSuccess,
+			})
+		case http.MethodGet:
+			writeJSON(b, w, map[string]interface{}{
+				"kind": "DeploymentList", "apiVersion": "apps/v1", "metadata": map[string]interface{}{},
+				"items": []interface{}{},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	c := newTestServerClient(b, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api" || r.URL.Path == "/apis" {
+			atomic.AddInt32(&discoveryRequests, 1)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+
+	files := make([]string, 20)
+	for i := range files {
+		files[i] = writeYAMLFile(b, strings.Replace(deploymentYAML, "istio-ingressgateway", fmt.Sprintf("gateway-%d", i), 1))
+	}
+
+	run := func(b *testing.B, deleteFiles func() error) {
+		atomic.StoreInt32(&discoveryRequests, 0)
+		for i := 0; i < b.N; i++ {
+			if err := deleteFiles(); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(atomic.LoadInt32(&discoveryRequests))/float64(b.N), "discovery-requests/op")
+	}
+	b.Run("per-file", func(b *testing.B) {
+		run(b, func() error {
+			for _, f := range files {
+				if err := c.DeleteYAMLFiles("", f); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	b.Run("bulk", func(b *testing.B) {
+		run(b, func() error {
+			return c.DeleteYAMLFiles("", files...)
+		})
+	})
+}
@@ -0,0 +1,94 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	kubeApiApps "k8s.io/api/apps/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CNIInfo describes the CNI plugin detected in the cluster.
+type CNIInfo struct {
+	// Name of the CNI plugin, e.g. "calico".
+	Name string
+	// Version of the CNI plugin, taken from its image tag. May be empty if the image is untagged.
+	Version string
+	// DaemonSet is the name of the kube-system DaemonSet running the plugin.
+	DaemonSet string
+}
+
+// knownCNIs maps a CNI name to the DaemonSet name prefixes used by its standard installation.
+var knownCNIs = []struct {
+	name     string
+	prefixes []string
+}{
+	{name: "calico", prefixes: []string{"calico-node"}},
+	{name: "cilium", prefixes: []string{"cilium"}},
+	{name: "flannel", prefixes: []string{"kube-flannel", "flannel"}},
+}
+
+func (c *client) DetectCNI(ctx context.Context) (CNIInfo, error) {
+	dss, err := c.AppsV1().DaemonSets("kube-system").List(ctx, kubeApiMeta.ListOptions{})
+	if err != nil {
+		return CNIInfo{}, fmt.Errorf("unable to list kube-system daemonsets: %v", err)
+	}
+	for _, cni := range knownCNIs {
+		for i := range dss.Items {
+			ds := &dss.Items[i]
+			for _, prefix := range cni.prefixes {
+				if strings.HasPrefix(ds.Name, prefix) {
+					return CNIInfo{
+						Name:      cni.name,
+						Version:   daemonSetImageTag(ds, cni.name),
+						DaemonSet: ds.Name,
+					}, nil
+				}
+			}
+		}
+	}
+	return CNIInfo{}, fmt.Errorf("unable to detect the CNI plugin from %d kube-system daemonsets", len(dss.Items))
+}
+
+// daemonSetImageTag returns the image tag of the first container whose name contains name, falling back
+// to the first container.
+func daemonSetImageTag(ds *kubeApiApps.DaemonSet, name string) string {
+	containers := ds.Spec.Template.Spec.Containers
+	if len(containers) == 0 {
+		return ""
+	}
+	image := containers[0].Image
+	for _, container := range containers {
+		if strings.Contains(container.Name, name) {
+			image = container.Image
+			break
+		}
+	}
+	return imageTag(image)
+}
+
+// imageTag returns the tag of a container image reference, e.g. "v3.15.1" for "calico/node:v3.15.1".
+func imageTag(image string) string {
+	image = strings.SplitN(image, "@", 2)[0]
+	// Only look at the last path segment, so that registry ports are not mistaken for tags.
+	image = image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(image, ":"); i >= 0 {
+		return image[i+1:]
+	}
+	return ""
+}
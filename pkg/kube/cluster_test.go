@@ -0,0 +1,69 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"testing"
+
+	kubeApiApps "k8s.io/api/apps/v1"
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDetectCNI(t *testing.T) {
+	calico := &kubeApiApps.DaemonSet{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: "calico-node", Namespace: "kube-system"},
+		Spec: kubeApiApps.DaemonSetSpec{
+			Template: kubeApiCore.PodTemplateSpec{
+				Spec: kubeApiCore.PodSpec{
+					Containers: []kubeApiCore.Container{
+						{Name: "install-cni", Image: "docker.io/calico/cni:v3.15.1"},
+						{Name: "calico-node", Image: "docker.io/calico/node:v3.15.1"},
+					},
+				},
+			},
+		},
+	}
+	kubeProxy := &kubeApiApps.DaemonSet{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: "kube-proxy", Namespace: "kube-system"},
+	}
+
+	got, err := newFakeClient(kubeProxy, calico).DetectCNI(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := CNIInfo{Name: "calico", Version: "v3.15.1", DaemonSet: "calico-node"}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	if _, err := newFakeClient(kubeProxy).DetectCNI(context.Background()); err == nil {
+		t.Fatal("expected error when no CNI daemonset is present")
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	cases := map[string]string{
+		"calico/node:v3.15.1":                    "v3.15.1",
+		"localhost:5000/cilium/cilium":           "",
+		"quay.io/coreos/flannel:v0.12.0@sha256:": "v0.12.0",
+	}
+	for image, want := range cases {
+		if got := imageTag(image); got != want {
+			t.Errorf("imageTag(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
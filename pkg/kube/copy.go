@@ -0,0 +1,185 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+func (c *client) CopyToPod(ctx context.Context, namespace, podName, container, srcLocalPath, destPath string) error {
+	if _, err := os.Stat(srcLocalPath); err != nil {
+		return fmt.Errorf("unable to copy %s: %v", srcLocalPath, err)
+	}
+	destPath = path.Clean(destPath)
+
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(writeTar(ctx, writer, srcLocalPath, path.Base(destPath)))
+	}()
+	// Unblock the tar writer if the command exits before reading all of its input.
+	defer closeQuietly(reader)
+
+	var stderr bytes.Buffer
+	command := []string{"tar", "-xmf", "-", "-C", path.Dir(destPath)}
+	if err := c.podExecStream(ctx, podName, namespace, container, command, reader, ioutil.Discard, &stderr); err != nil {
+		return copyError(srcLocalPath, fmt.Sprintf("%s/%s:%s", namespace, podName, destPath), err, stderr.String())
+	}
+	return nil
+}
+
+func (c *client) CopyFromPod(ctx context.Context, namespace, podName, container, srcPath, destLocalPath string) error {
+	srcPath = path.Clean(srcPath)
+
+	reader, writer := io.Pipe()
+	var stderr bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		command := []string{"tar", "-cf", "-", "-C", path.Dir(srcPath), path.Base(srcPath)}
+		err := c.podExecStream(ctx, podName, namespace, container, command, nil, writer, &stderr)
+		_ = writer.CloseWithError(err)
+		done <- err
+	}()
+
+	err := extractTar(ctx, reader, path.Base(srcPath), destLocalPath)
+	if err == nil {
+		// Consume the padding tar writes after the end of the archive.
+		_, err = io.Copy(ioutil.Discard, reader)
+	}
+	// Unblock the command if extraction failed before reading all of its output.
+	closeQuietly(reader)
+	if execErr := <-done; err == nil {
+		err = execErr
+	}
+	if err != nil {
+		return copyError(fmt.Sprintf("%s/%s:%s", namespace, podName, srcPath), destLocalPath, err, stderr.String())
+	}
+	return nil
+}
+
+func copyError(src, dest string, err error, stderr string) error {
+	if stderr = strings.TrimSpace(stderr); stderr != "" {
+		return fmt.Errorf("failed copying %s to %s: %v: %s", src, dest, err, stderr)
+	}
+	return fmt.Errorf("failed copying %s to %s: %v", src, dest, err)
+}
+
+// writeTar writes the file or directory at src to w as a tar archive, with src renamed to name.
+// Files other than regular files and directories are skipped.
+func writeTar(ctx context.Context, w io.Writer, src, name string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(name, filepath.ToSlash(rel))
+		if info.IsDir() {
+			hdr.Name += "/"
+			return tw.WriteHeader(hdr)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer closeQuietly(f)
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// extractTar extracts the tar archive read from r, rooted at name, to dest.
+// Entries other than regular files and directories are skipped.
+func extractTar(ctx context.Context, r io.Reader, name, dest string) error {
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		entry := path.Clean(hdr.Name)
+		var target string
+		switch {
+		case entry == name:
+			target = dest
+		case strings.HasPrefix(entry, name+"/"):
+			target = filepath.Join(dest, filepath.FromSlash(strings.TrimPrefix(entry, name+"/")))
+		default:
+			// Also rejects entries escaping the copied directory through "..".
+			return fmt.Errorf("unexpected archive entry %q", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := writeFile(target, tr, hdr.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func writeFile(name string, r io.Reader, perm os.FileMode) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		closeQuietly(f)
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,145 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// fakeExecutor runs the exec'd command locally, with the directories passed to -C rooted at root.
+type fakeExecutor struct {
+	root    string
+	command []string
+}
+
+func (e *fakeExecutor) Stream(opts remotecommand.StreamOptions) error {
+	args := append([]string{}, e.command[1:]...)
+	for i := range args {
+		if args[i] == "-C" && i+1 < len(args) {
+			args[i+1] = filepath.Join(e.root, args[i+1])
+		}
+	}
+	cmd := exec.Command(e.command[0], args...)
+	if opts.Stdin != nil {
+		cmd.Stdin = opts.Stdin
+	}
+	cmd.Stdout, cmd.Stderr = opts.Stdout, opts.Stderr
+	return cmd.Run()
+}
+
+// withFakeExec makes PodExec run commands locally, against a pod filesystem rooted at the returned directory.
+func withFakeExec(t *testing.T, c *client) string {
+	t.Helper()
+	root, err := ioutil.TempDir("", "pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(root) })
+
+	c.restClient, err = rest.RESTClientFor(SetRestDefaults(&rest.Config{Host: "localhost"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.executorFactory = func(_ *rest.Config, _ string, u *url.URL) (remotecommand.Executor, error) {
+		return &fakeExecutor{root: root, command: u.Query()["command"]}, nil
+	}
+	return root
+}
+
+func writeTestFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertFileContent(t *testing.T, name, want string) {
+	t.Helper()
+	got, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Fatalf("%s: got %q, want %q", name, got, want)
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	c := newFakeClient()
+	root := withFakeExec(t, c)
+	local, err := ioutil.TempDir("", "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+	writeTestFile(t, filepath.Join(local, "in.txt"), "hello pod")
+	writeTestFile(t, filepath.Join(root, "etc", "istio", ".keep"), "")
+
+	if err := c.CopyToPod(context.Background(), "default", "pod", "istio-proxy",
+		filepath.Join(local, "in.txt"), "/etc/istio/hello.txt"); err != nil {
+		t.Fatal(err)
+	}
+	assertFileContent(t, filepath.Join(root, "etc", "istio", "hello.txt"), "hello pod")
+
+	if err := c.CopyFromPod(context.Background(), "default", "pod", "istio-proxy",
+		"/etc/istio/hello.txt", filepath.Join(local, "out.txt")); err != nil {
+		t.Fatal(err)
+	}
+	assertFileContent(t, filepath.Join(local, "out.txt"), "hello pod")
+}
+
+func TestCopyDirectory(t *testing.T) {
+	c := newFakeClient()
+	root := withFakeExec(t, c)
+	local, err := ioutil.TempDir("", "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+	writeTestFile(t, filepath.Join(local, "src", "a.txt"), "a")
+	writeTestFile(t, filepath.Join(local, "src", "nested", "b.txt"), "b")
+	writeTestFile(t, filepath.Join(root, "tmp", ".keep"), "")
+
+	if err := c.CopyToPod(context.Background(), "default", "pod", "istio-proxy",
+		filepath.Join(local, "src"), "/tmp/config"); err != nil {
+		t.Fatal(err)
+	}
+	assertFileContent(t, filepath.Join(root, "tmp", "config", "a.txt"), "a")
+	assertFileContent(t, filepath.Join(root, "tmp", "config", "nested", "b.txt"), "b")
+
+	if err := c.CopyFromPod(context.Background(), "default", "pod", "istio-proxy",
+		"/tmp/config", filepath.Join(local, "dst")); err != nil {
+		t.Fatal(err)
+	}
+	assertFileContent(t, filepath.Join(local, "dst", "a.txt"), "a")
+	assertFileContent(t, filepath.Join(local, "dst", "nested", "b.txt"), "b")
+
+	if err := c.CopyFromPod(context.Background(), "default", "pod", "istio-proxy",
+		"/tmp/missing", filepath.Join(local, "missing")); err == nil {
+		t.Fatal("expected error copying a missing file")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	kubeApiExt "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	kubeApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// crdPollInterval is the interval between two checks of the conditions of CRDs.
+const crdPollInterval = 500 * time.Millisecond
+
+func (c *client) WaitForCRDsEstablished(ctx context.Context, crdNames ...string) error {
+	pending := append([]string(nil), crdNames...)
+	ticker := time.NewTicker(crdPollInterval)
+	defer ticker.Stop()
+	for {
+		var err error
+		if pending, err = c.pendingCRDs(ctx, pending); err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("CRDs not established: %s", strings.Join(pending, ", "))
+		case <-ticker.C:
+		}
+	}
+}
+
+// pendingCRDs returns the CRDs among crdNames which do not exist or are not established yet.
+func (c *client) pendingCRDs(ctx context.Context, crdNames []string) ([]string, error) {
+	var pending []string
+	for _, name := range crdNames {
+		crd, err := c.extSet.ApiextensionsV1beta1().CustomResourceDefinitions().Get(ctx, name, kubeApiMeta.GetOptions{})
+		if err != nil {
+			if kubeApiErrors.IsNotFound(err) || ctx.Err() != nil {
+				pending = append(pending, name)
+				continue
+			}
+			return nil, fmt.Errorf("unable to get CRD %s: %v", name, err)
+		}
+		if !crdEstablished(crd) {
+			pending = append(pending, name)
+		}
+	}
+	return pending, nil
+}
+
+func crdEstablished(crd *kubeApiExt.CustomResourceDefinition) bool {
+	for _, cond := range crd.Status.Conditions {
+		if cond.Type == kubeApiExt.Established {
+			return cond.Status == kubeApiExt.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	kubeApiExt "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	extfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+func crd(name string, conditions ...kubeApiExt.CustomResourceDefinitionCondition) *kubeApiExt.CustomResourceDefinition {
+	return &kubeApiExt.CustomResourceDefinition{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: name},
+		Status:     kubeApiExt.CustomResourceDefinitionStatus{Conditions: conditions},
+	}
+}
+
+func TestWaitForCRDsEstablished(t *testing.T) {
+	established := kubeApiExt.CustomResourceDefinitionCondition{
+		Type:   kubeApiExt.Established,
+		Status: kubeApiExt.ConditionTrue,
+	}
+	ext := extfake.NewSimpleClientset(
+		crd("gateways.networking.istio.io", established),
+		crd("virtualservices.networking.istio.io"),
+	)
+	// The CRD becomes established on the second check.
+	var gets int
+	ext.PrependReactor("get", "customresourcedefinitions", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		if action.(k8sTesting.GetAction).GetName() != "virtualservices.networking.istio.io" {
+			return false, nil, nil
+		}
+		gets++
+		if gets < 2 {
+			return false, nil, nil
+		}
+		return true, crd("virtualservices.networking.istio.io", established), nil
+	})
+	c := newFakeClient()
+	c.extSet = ext
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.WaitForCRDsEstablished(ctx, "gateways.networking.istio.io", "virtualservices.networking.istio.io"); err != nil {
+		t.Fatal(err)
+	}
+	if gets != 2 {
+		t.Fatalf("got %d checks of the pending CRD, want 2", gets)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := c.WaitForCRDsEstablished(ctx, "gateways.networking.istio.io", "sidecars.networking.istio.io")
+	if err == nil || !strings.Contains(err.Error(), "sidecars.networking.istio.io") ||
+		strings.Contains(err.Error(), "gateways.networking.istio.io") {
+		t.Fatalf("got error %v, want only sidecars.networking.istio.io not established", err)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	kubeApiApps "k8s.io/api/apps/v1"
+	kubeApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// restartedAtAnnotation is the pod template annotation set by `kubectl rollout restart`.
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+func (c *client) GetDeployment(ctx context.Context, namespace, name string) (*kubeApiApps.Deployment, error) {
+	deployment, err := c.AppsV1().Deployments(namespace).Get(ctx, name, kubeApiMeta.GetOptions{})
+	if err != nil {
+		if kubeApiErrors.IsNotFound(err) {
+			return nil, fmt.Errorf("deployment %s/%s not found", namespace, name)
+		}
+		return nil, fmt.Errorf("unable to get deployment %s/%s: %v", namespace, name, err)
+	}
+	return deployment, nil
+}
+
+func (c *client) ListIstioDeployments(ctx context.Context, namespace string) ([]kubeApiApps.Deployment, error) {
+	deployments, err := c.AppsV1().Deployments(namespace).List(ctx, kubeApiMeta.ListOptions{
+		LabelSelector: "istio",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list Istio deployments in %s: %v", namespace, err)
+	}
+	items := deployments.Items
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Namespace != items[j].Namespace {
+			return items[i].Namespace < items[j].Namespace
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items, nil
+}
+
+func (c *client) ScaleDeployment(ctx context.Context, namespace, name string, replicas int32) error {
+	if replicas < 0 {
+		return fmt.Errorf("invalid replica count %d for deployment %s/%s", replicas, namespace, name)
+	}
+	deployments := c.AppsV1().Deployments(namespace)
+	var getErr error
+	err := retryOnConflict(func() error {
+		scale, err := deployments.GetScale(ctx, name, kubeApiMeta.GetOptions{})
+		if err != nil {
+			getErr = err
+			return err
+		}
+		scale.Spec.Replicas = replicas
+		_, err = deployments.UpdateScale(ctx, name, scale, kubeApiMeta.UpdateOptions{})
+		return err
+	})
+	if getErr != nil {
+		if kubeApiErrors.IsNotFound(getErr) {
+			return fmt.Errorf("deployment %s/%s not found", namespace, name)
+		}
+		return fmt.Errorf("unable to get scale of deployment %s/%s: %v", namespace, name, getErr)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to scale deployment %s/%s: %v", namespace, name, err)
+	}
+	return nil
+}
+
+func (c *client) RestartDeployment(ctx context.Context, namespace, name string) error {
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`,
+		restartedAtAnnotation, time.Now().Format(time.RFC3339))
+	_, err := c.AppsV1().Deployments(namespace).Patch(ctx, name, types.StrategicMergePatchType, []byte(patch),
+		kubeApiMeta.PatchOptions{FieldManager: fieldManager})
+	if err != nil {
+		return fmt.Errorf("unable to restart deployment %s/%s: %v", namespace, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	kubeApiApps "k8s.io/api/apps/v1"
+	kubeApiAutoscaling "k8s.io/api/autoscaling/v1"
+	kubeApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+func TestGetDeployment(t *testing.T) {
+	c := newFakeClient(istiodDeployment("istiod", "istio-system"))
+
+	d, err := c.GetDeployment(context.Background(), "istio-system", "istiod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "istiod" || d.Labels["app"] != "istiod" {
+		t.Fatalf("got deployment %s with labels %v, want istiod", d.Name, d.Labels)
+	}
+
+	_, err = c.GetDeployment(context.Background(), "istio-system", "missing")
+	if err == nil || err.Error() != "deployment istio-system/missing not found" {
+		t.Fatalf("got error %v, want deployment istio-system/missing not found", err)
+	}
+}
+
+func TestListIstioDeployments(t *testing.T) {
+	deployment := func(name, namespace string, labels map[string]string) *kubeApiApps.Deployment {
+		return &kubeApiApps.Deployment{ObjectMeta: kubeApiMeta.ObjectMeta{Name: name, Namespace: namespace, Labels: labels}}
+	}
+	c := newFakeClient(
+		deployment("istiod", "istio-system", map[string]string{"app": "istiod", "istio": "pilot"}),
+		deployment("istio-ingressgateway", "istio-system", map[string]string{"istio": "ingressgateway"}),
+		deployment("istio-eastwestgateway", "istio-gateways", map[string]string{"istio": "eastwestgateway"}),
+		deployment("prometheus", "istio-system", map[string]string{"app": "prometheus"}),
+	)
+
+	cases := []struct {
+		namespace string
+		want      []string
+	}{
+		{namespace: "istio-system", want: []string{"istio-system/istio-ingressgateway", "istio-system/istiod"}},
+		{namespace: "", want: []string{
+			"istio-gateways/istio-eastwestgateway", "istio-system/istio-ingressgateway", "istio-system/istiod",
+		}},
+	}
+	for _, tt := range cases {
+		deployments, err := c.ListIstioDeployments(context.Background(), tt.namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, d := range deployments {
+			got = append(got, d.Namespace+"/"+d.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("namespace %q: got %v, want %v", tt.namespace, got, tt.want)
+		}
+	}
+}
+
+func TestRestartDeployment(t *testing.T) {
+	c := newFakeClient(istiodDeployment("istiod", "istio-system"))
+	if err := c.RestartDeployment(context.Background(), "istio-system", "istiod"); err != nil {
+		t.Fatal(err)
+	}
+	d, err := c.AppsV1().Deployments("istio-system").Get(context.Background(), "istiod", kubeApiMeta.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Spec.Template.Annotations[restartedAtAnnotation] == "" {
+		t.Fatalf("restart annotation not set: %v", d.Spec.Template.Annotations)
+	}
+
+	if err := c.RestartDeployment(context.Background(), "istio-system", "missing"); err == nil {
+		t.Fatal("expected error restarting a missing deployment")
+	}
+}
+
+// withScaleSubresource makes the fake clientset of c serve the scale subresource of deployments.
+func withScaleSubresource(c *client) {
+	cs := c.Interface.(*fake.Clientset)
+	gvr := kubeApiApps.SchemeGroupVersion.WithResource("deployments")
+	cs.PrependReactor("get", "deployments", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		get := action.(k8sTesting.GetAction)
+		obj, err := cs.Tracker().Get(gvr, get.GetNamespace(), get.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		d := obj.(*kubeApiApps.Deployment)
+		var replicas int32 = 1
+		if d.Spec.Replicas != nil {
+			replicas = *d.Spec.Replicas
+		}
+		return true, &kubeApiAutoscaling.Scale{
+			ObjectMeta: kubeApiMeta.ObjectMeta{Name: d.Name, Namespace: d.Namespace},
+			Spec:       kubeApiAutoscaling.ScaleSpec{Replicas: replicas},
+		}, nil
+	})
+	cs.PrependReactor("update", "deployments", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		scale := action.(k8sTesting.UpdateAction).GetObject().(*kubeApiAutoscaling.Scale)
+		obj, err := cs.Tracker().Get(gvr, action.GetNamespace(), scale.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		d := obj.(*kubeApiApps.Deployment).DeepCopy()
+		d.Spec.Replicas = &scale.Spec.Replicas
+		return true, scale, cs.Tracker().Update(gvr, d, action.GetNamespace())
+	})
+}
+
+func TestScaleDeployment(t *testing.T) {
+	d := istiodDeployment("istio-ingressgateway", "istio-system")
+	one := int32(1)
+	d.Spec.Replicas = &one
+	c := newFakeClient(d)
+	withScaleSubresource(c)
+
+	if err := c.ScaleDeployment(context.Background(), "istio-system", "istio-ingressgateway", 3); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.AppsV1().Deployments("istio-system").Get(context.Background(), "istio-ingressgateway", kubeApiMeta.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got.Spec.Replicas != 3 {
+		t.Fatalf("got %d replicas, want 3", *got.Spec.Replicas)
+	}
+
+	if err := c.ScaleDeployment(context.Background(), "istio-system", "istio-ingressgateway", -1); err == nil {
+		t.Fatal("expected error for negative replicas")
+	}
+	if err := c.ScaleDeployment(context.Background(), "istio-system", "missing", 1); err == nil {
+		t.Fatal("expected error for missing deployment")
+	}
+}
+
+func TestScaleDeploymentConflict(t *testing.T) {
+	c := newFakeClient(istiodDeployment("istio-ingressgateway", "istio-system"))
+	withScaleSubresource(c)
+	var updates int
+	c.Interface.(*fake.Clientset).PrependReactor("update", "deployments", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		updates++
+		if updates == 1 {
+			// Another actor modified the deployment since the scale was read.
+			return true, nil, kubeApiErrors.NewConflict(kubeApiApps.Resource("deployments"), "istio-ingressgateway",
+				errors.New("the object has been modified"))
+		}
+		return false, nil, nil
+	})
+
+	if err := c.ScaleDeployment(context.Background(), "istio-system", "istio-ingressgateway", 3); err != nil {
+		t.Fatal(err)
+	}
+	if updates != 2 {
+		t.Fatalf("got %d updates, want a retry after the conflict", updates)
+	}
+	got, err := c.AppsV1().Deployments("istio-system").Get(context.Background(), "istio-ingressgateway", kubeApiMeta.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got.Spec.Replicas != 3 {
+		t.Fatalf("got %d replicas, want 3", *got.Spec.Replicas)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	kubeApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// volatileMetadataFields are server-populated fields which are stripped before diffing objects.
+var volatileMetadataFields = []string{"managedFields", "resourceVersion", "generation", "uid", "creationTimestamp", "selfLink"}
+
+func (c *client) DiffYAMLFiles(ctx context.Context, namespace string, yamlFiles ...string) (string, error) {
+	files := removeEmptyFiles(yamlFiles)
+	if len(files) == 0 {
+		return "", nil
+	}
+
+	cmdNamespace, enforceNamespace, err := c.clientFactory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return "", err
+	}
+	if len(namespace) > 0 {
+		cmdNamespace = namespace
+		enforceNamespace = true
+	}
+	dynamicClient, err := c.clientFactory.DynamicClient()
+	if err != nil {
+		return "", err
+	}
+
+	r := c.clientFactory.NewBuilder().
+		Unstructured().
+		NamespaceParam(cmdNamespace).DefaultNamespace().
+		FilenameParam(enforceNamespace, &resource.FilenameOptions{Filenames: files}).
+		Flatten().
+		Do()
+	if err := r.Err(); err != nil {
+		return "", err
+	}
+
+	out := &strings.Builder{}
+	err = r.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+		ri := dynamicClient.Resource(info.Mapping.Resource).Namespace(info.Namespace)
+
+		// A missing object is diffed as empty.
+		live, err := ri.Get(ctx, info.Name, kubeApiMeta.GetOptions{})
+		if err != nil && !kubeApiErrors.IsNotFound(err) {
+			return err
+		}
+		merged, err := dryRunApply(ctx, ri, info)
+		if err != nil {
+			return err
+		}
+
+		name := path.Join(info.Mapping.GroupVersionKind.Kind, info.Namespace, info.Name)
+		diff, err := diffObjects(name, live, merged)
+		if err != nil {
+			return err
+		}
+		out.WriteString(diff)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// dryRunApply performs a server-side dry-run apply of the object of info, which returns the object as it
+// would be after applying it.
+func dryRunApply(ctx context.Context, ri dynamic.ResourceInterface, info *resource.Info) (*unstructured.Unstructured, error) {
+	desired, err := runtime.Encode(unstructured.UnstructuredJSONScheme, info.Object)
+	if err != nil {
+		return nil, err
+	}
+	force := true
+	merged, err := ri.Patch(ctx, info.Name, types.ApplyPatchType, desired, kubeApiMeta.PatchOptions{
+		DryRun:       []string{kubeApiMeta.DryRunAll},
+		FieldManager: fieldManager,
+		Force:        &force,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("dry-run apply of %s failed: %v", info.ObjectName(), err)
+	}
+	return merged, nil
+}
+
+// diffObjects returns a unified diff between the YAML of the live and merged objects, ignoring volatile
+// server-populated metadata. A nil live object is diffed as empty.
+func diffObjects(name string, live, merged *unstructured.Unstructured) (string, error) {
+	liveYAML, err := normalizedYAML(live)
+	if err != nil {
+		return "", err
+	}
+	mergedYAML, err := normalizedYAML(merged)
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		FromFile: "live/" + name,
+		A:        difflib.SplitLines(liveYAML),
+		ToFile:   "merged/" + name,
+		B:        difflib.SplitLines(mergedYAML),
+		Context:  3,
+	})
+}
+
+func normalizedYAML(obj *unstructured.Unstructured) (string, error) {
+	if obj == nil {
+		return "", nil
+	}
+	obj = obj.DeepCopy()
+	for _, field := range volatileMetadataFields {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+	out, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
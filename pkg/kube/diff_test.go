@@ -0,0 +1,153 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func TestDiffYAMLFiles(t *testing.T) {
+	live := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name": "istio", "namespace": "istio-system", "resourceVersion": "1", "uid": "1234",
+		},
+		"data": map[string]interface{}{"tracer": "zipkin", "unchanged": "value"},
+	}
+	var patches []string
+	c := newTestServerClient(t, discoveryHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/istio-system/configmaps/istio" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(t, w, live)
+		case http.MethodPatch:
+			if r.URL.Query().Get("dryRun") != "All" {
+				t.Errorf("expected a dry run, got %v", r.URL.Query())
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			patches = append(patches, string(body))
+			writeJSON(t, w, map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata": map[string]interface{}{
+					"name": "istio", "namespace": "istio-system", "resourceVersion": "2", "uid": "1234",
+				},
+				"data": map[string]interface{}{"tracer": "lightstep", "unchanged": "value"},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	})))
+
+	file := writeYAMLFile(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: istio
+  namespace: istio-system
+data:
+  tracer: lightstep
+  unchanged: value
+`)
+	diff, err := c.DiffYAMLFiles(context.Background(), "", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 1 {
+		t.Fatalf("expected a single dry-run apply, got %v", patches)
+	}
+	for _, want := range []string{"-  tracer: zipkin", "+  tracer: lightstep"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("diff does not contain %q:\n%s", want, diff)
+		}
+	}
+	if strings.Contains(diff, "resourceVersion") || strings.Contains(diff, "-  unchanged") {
+		t.Errorf("diff contains unexpected changes:\n%s", diff)
+	}
+}
+
+func TestApplyYAMLDryRunResult(t *testing.T) {
+	var patches []string
+	c := newTestServerClient(t, discoveryHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/istio-system/configmaps/istio" || r.Method != http.MethodPatch {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("dryRun") != "All" {
+			t.Errorf("expected a dry run, got %v", r.URL.Query())
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		patches = append(patches, string(body))
+		// The live object has a key which is not in the applied YAML.
+		writeJSON(t, w, map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]interface{}{
+				"name": "istio", "namespace": "istio-system", "resourceVersion": "2",
+			},
+			"data": map[string]interface{}{"tracer": "lightstep", "live": "value"},
+		})
+	})))
+
+	merged, err := c.ApplyYAMLDryRunResult(context.Background(), "istio-system", strings.NewReader(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: istio
+data:
+  tracer: lightstep
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 1 || !strings.Contains(patches[0], "lightstep") {
+		t.Fatalf("expected a single dry-run apply of the YAML, got %v", patches)
+	}
+	if len(merged) != 1 || merged[0].GetName() != "istio" {
+		t.Fatalf("unexpected merged objects %v", merged)
+	}
+	data, _, _ := unstructured.NestedStringMap(merged[0].Object, "data")
+	if want := map[string]string{"tracer": "lightstep", "live": "value"}; !reflect.DeepEqual(data, want) {
+		t.Fatalf("got merged data %v, want %v", data, want)
+	}
+}
+
+func TestNormalizedYAMLStripsVolatileFields(t *testing.T) {
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(`metadata:
+  name: foo
+  uid: "1"
+  managedFields: []
+`), &obj); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := diffObjects("ConfigMap/foo", nil, &unstructured.Unstructured{Object: obj})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(diff, "uid") || strings.Contains(diff, "managedFields") || !strings.Contains(diff, "+  name: foo") {
+		t.Fatalf("unexpected diff:\n%s", diff)
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	kubeApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"istio.io/pkg/log"
+)
+
+const (
+	// deltaXDSDebugPath is the istiod debug endpoint reporting incremental xDS push statistics.
+	deltaXDSDebugPath = "/debug/deltaz"
+	// configzDebugPath is the istiod debug endpoint listing all the config known to the instance.
+	configzDebugPath = "/debug/configz"
+	// synczDebugPath is the istiod debug endpoint reporting the sync status of the connected proxies.
+	synczDebugPath = "/debug/syncz"
+)
+
+// ErrDeltaXDSUnsupported is returned when the control plane does not expose incremental xDS statistics.
+var ErrDeltaXDSUnsupported = errors.New("istiod does not support delta xDS debug information")
+
+// DeltaXDSStat holds the incremental xDS push statistics for a single proxy and resource type.
+type DeltaXDSStat struct {
+	// Istiod is the name of the istiod pod that reported the stat.
+	Istiod           string `json:"istiod,omitempty"`
+	ProxyID          string `json:"proxy"`
+	TypeURL          string `json:"type_url"`
+	Pushes           int64  `json:"pushes"`
+	ResourcesSent    int64  `json:"resources_sent"`
+	ResourcesRemoved int64  `json:"resources_removed"`
+}
+
+// SyncStatus is the xDS sync status of a proxy, as reported by the istiod instance it is connected to.
+type SyncStatus struct {
+	// Istiod is the name of the istiod pod that reported the status.
+	Istiod        string `json:"istiod,omitempty"`
+	ProxyID       string `json:"proxy,omitempty"`
+	ProxyVersion  string `json:"proxy_version,omitempty"`
+	IstioVersion  string `json:"istio_version,omitempty"`
+	ClusterSent   string `json:"cluster_sent,omitempty"`
+	ClusterAcked  string `json:"cluster_acked,omitempty"`
+	ListenerSent  string `json:"listener_sent,omitempty"`
+	ListenerAcked string `json:"listener_acked,omitempty"`
+	RouteSent     string `json:"route_sent,omitempty"`
+	RouteAcked    string `json:"route_acked,omitempty"`
+	EndpointSent  string `json:"endpoint_sent,omitempty"`
+	EndpointAcked string `json:"endpoint_acked,omitempty"`
+}
+
+// SyncState is the state of the config of one xDS type of a proxy.
+type SyncState string
+
+const (
+	// SyncStateSynced means the proxy acknowledged the last config sent by istiod.
+	SyncStateSynced SyncState = "SYNCED"
+	// SyncStateNotSent means istiod did not send any config, for instance because the proxy did not request it.
+	SyncStateNotSent SyncState = "NOT SENT"
+	// SyncStateStale means istiod sent config which the proxy did not acknowledge yet.
+	SyncStateStale SyncState = "STALE"
+)
+
+func syncState(sent, acked string) SyncState {
+	switch {
+	case sent == "":
+		return SyncStateNotSent
+	case sent == acked:
+		return SyncStateSynced
+	default:
+		return SyncStateStale
+	}
+}
+
+// ClusterState returns the sync state of the CDS config of the proxy.
+func (s SyncStatus) ClusterState() SyncState { return syncState(s.ClusterSent, s.ClusterAcked) }
+
+// ListenerState returns the sync state of the LDS config of the proxy.
+func (s SyncStatus) ListenerState() SyncState { return syncState(s.ListenerSent, s.ListenerAcked) }
+
+// RouteState returns the sync state of the RDS config of the proxy.
+func (s SyncStatus) RouteState() SyncState { return syncState(s.RouteSent, s.RouteAcked) }
+
+// EndpointState returns the sync state of the EDS config of the proxy.
+func (s SyncStatus) EndpointState() SyncState { return syncState(s.EndpointSent, s.EndpointAcked) }
+
+// Synced returns true if none of the config types of the proxy is stale.
+func (s SyncStatus) Synced() bool {
+	for _, state := range []SyncState{s.ClusterState(), s.ListenerState(), s.RouteState(), s.EndpointState()} {
+		if state == SyncStateStale {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *client) DiscoverIstioNamespace(ctx context.Context) (string, error) {
+	deployments, err := c.AppsV1().Deployments(kubeApiMeta.NamespaceAll).List(ctx, kubeApiMeta.ListOptions{
+		LabelSelector: "app=istiod",
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to list istiod deployments: %v", err)
+	}
+	namespaces := map[string]struct{}{}
+	for _, d := range deployments.Items {
+		namespaces[d.Namespace] = struct{}{}
+	}
+	switch len(namespaces) {
+	case 0:
+		return "", errors.New("unable to find any istiod deployments")
+	case 1:
+		return deployments.Items[0].Namespace, nil
+	default:
+		found := make([]string, 0, len(namespaces))
+		for ns := range namespaces {
+			found = append(found, ns)
+		}
+		sort.Strings(found)
+		return "", fmt.Errorf("found istiod deployments in multiple namespaces: %s", strings.Join(found, ", "))
+	}
+}
+
+func (c *client) GetDeltaXDSStats(ctx context.Context, namespace string) ([]DeltaXDSStat, error) {
+	pilots, err := c.GetIstioPods(ctx, namespace, map[string]string{
+		"labelSelector": "app=istiod",
+		"fieldSelector": "status.phase=Running",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(pilots) == 0 {
+		return nil, fmt.Errorf("unable to find any Pilot instances: %w", ErrNoIstioPods)
+	}
+	results := map[string][]byte{}
+	for _, pilot := range pilots {
+		res, err := c.DiscoveryDo(ctx, pilot.Name, pilot.Namespace, deltaXDSDebugPath)
+		if err != nil {
+			// The proxy answers NotFound both for a missing pod and for a missing path. Only the latter means
+			// that istiod doesn't support the endpoint.
+			if kubeApiErrors.IsNotFound(err) {
+				if _, getErr := c.CoreV1().Pods(pilot.Namespace).Get(ctx, pilot.Name, kubeApiMeta.GetOptions{}); getErr == nil {
+					return nil, ErrDeltaXDSUnsupported
+				}
+			}
+			return nil, err
+		}
+		if len(res) > 0 {
+			results[pilot.Name] = res
+		}
+	}
+	return parseDeltaXDSStats(results)
+}
+
+func parseDeltaXDSStats(results map[string][]byte) ([]DeltaXDSStat, error) {
+	var out []DeltaXDSStat
+	for istiod, res := range results {
+		var stats []DeltaXDSStat
+		if err := json.Unmarshal(res, &stats); err != nil {
+			return nil, fmt.Errorf("failed parsing delta xDS stats from %s: %v", istiod, err)
+		}
+		for i := range stats {
+			stats[i].Istiod = istiod
+		}
+		out = append(out, stats...)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Istiod != out[j].Istiod {
+			return out[i].Istiod < out[j].Istiod
+		}
+		if out[i].ProxyID != out[j].ProxyID {
+			return out[i].ProxyID < out[j].ProxyID
+		}
+		return out[i].TypeURL < out[j].TypeURL
+	})
+	return out, nil
+}
+
+func (c *client) CheckIstiodConsistency(ctx context.Context, namespace string) (bool, map[string]string, error) {
+	results, err := c.AllDiscoveryDo(ctx, namespace, configzDebugPath)
+	if err != nil {
+		return false, nil, err
+	}
+	versions := make(map[string]string, len(results))
+	distinct := map[string]struct{}{}
+	for istiod, res := range results {
+		version, err := configVersion(res)
+		if err != nil {
+			return false, nil, fmt.Errorf("failed parsing config of %s: %v", istiod, err)
+		}
+		versions[istiod] = version
+		distinct[version] = struct{}{}
+	}
+	return len(distinct) <= 1, versions, nil
+}
+
+// configVersion returns a digest of the name and resource version of every config listed by /debug/configz,
+// so that two istiod instances report the same version only if they hold the same config.
+func configVersion(configz []byte) (string, error) {
+	var configs []struct {
+		Type            json.RawMessage `json:"type"`
+		Namespace       string          `json:"namespace"`
+		Name            string          `json:"name"`
+		ResourceVersion string          `json:"resourceVersion"`
+	}
+	if err := json.Unmarshal(configz, &configs); err != nil {
+		return "", err
+	}
+	keys := make([]string, 0, len(configs))
+	for _, cfg := range configs {
+		// configz terminates its list with an empty object.
+		if cfg.Name == "" {
+			continue
+		}
+		keys = append(keys, fmt.Sprintf("%s/%s/%s@%s", cfg.Type, cfg.Namespace, cfg.Name, cfg.ResourceVersion))
+	}
+	sort.Strings(keys)
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// getSyncStatuses returns the sync status of all the proxies connected to the istiod instances in namespace,
+// sorted by istiod and proxy.
+func (c *client) getSyncStatuses(ctx context.Context, namespace string) ([]SyncStatus, error) {
+	results, err := c.AllDiscoveryDo(ctx, namespace, synczDebugPath)
+	if err != nil {
+		return nil, err
+	}
+	var out []SyncStatus
+	for istiod, res := range results {
+		var statuses []SyncStatus
+		if err := json.Unmarshal(res, &statuses); err != nil {
+			return nil, fmt.Errorf("failed parsing sync status from %s: %v", istiod, err)
+		}
+		for i := range statuses {
+			statuses[i].Istiod = istiod
+		}
+		out = append(out, statuses...)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Istiod != out[j].Istiod {
+			return out[i].Istiod < out[j].Istiod
+		}
+		return out[i].ProxyID < out[j].ProxyID
+	})
+	return out, nil
+}
+
+func (c *client) GetProxySyncStatus(ctx context.Context, istiodNamespace string) ([]SyncStatus, error) {
+	statuses, err := c.getSyncStatuses(ctx, istiodNamespace)
+	if err != nil {
+		return nil, err
+	}
+	// A proxy reported by several istiod instances, for instance right after it reconnected, is only returned
+	// once, preferably with a synced status.
+	index := map[string]int{}
+	var out []SyncStatus
+	for _, status := range statuses {
+		i, ok := index[status.ProxyID]
+		if !ok {
+			index[status.ProxyID] = len(out)
+			out = append(out, status)
+			continue
+		}
+		if !out[i].Synced() && status.Synced() {
+			out[i] = status
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ProxyID < out[j].ProxyID })
+	return out, nil
+}
+
+func (c *client) FindProxyController(ctx context.Context, istiodNamespace, proxyID string) (string, error) {
+	statuses, err := c.GetProxySyncStatus(ctx, istiodNamespace)
+	if err != nil {
+		return "", err
+	}
+	for _, status := range statuses {
+		if status.ProxyID == proxyID {
+			return status.Istiod, nil
+		}
+	}
+	return "", fmt.Errorf("proxy %s is not connected to any istiod in %s", proxyID, istiodNamespace)
+}
+
+func (c *client) WatchProxySyncStatus(ctx context.Context, namespace string, fn func([]SyncStatus),
+	opts ...SyncStatusWatchOption) error {
+	options := newSyncStatusWatchOptions(opts)
+	ticker := time.NewTicker(options.pollInterval)
+	defer ticker.Stop()
+
+	var previous []SyncStatus
+	notified := false
+	for {
+		statuses, err := c.getSyncStatuses(ctx, namespace)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return nil
+		case err != nil && !isTransientSyncStatusError(err):
+			return err
+		case err != nil:
+			log.Warnf("failed polling the proxy sync status in %s, retrying: %v", namespace, err)
+		case !notified || !reflect.DeepEqual(statuses, previous):
+			fn(statuses)
+			previous = statuses
+			notified = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// isTransientSyncStatusError reports whether a failed poll of the sync status may succeed later, such as
+// while istiod is restarting.
+func isTransientSyncStatusError(err error) bool {
+	return errors.Is(err, ErrNoIstioPods) || isRetryableProxyError(err)
+}
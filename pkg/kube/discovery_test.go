@@ -0,0 +1,440 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kubeApiApps "k8s.io/api/apps/v1"
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// newDiscoveryTestClient returns a Client backed by a fake API server with one running istiod pod per
+// entry in responses. The pods can be read, and requests proxied to them are answered with the entry for
+// their path.
+func newDiscoveryTestClient(t *testing.T, responses map[string]map[string][]byte) Client {
+	t.Helper()
+	var pods []kubeApiCore.Pod
+	for name := range responses {
+		pods = append(pods, istioPod(name, "istio-system", "istiod"))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/namespaces/istio-system/pods", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, podList(pods...))
+	})
+	for name, paths := range responses {
+		pod := istioPod(name, "istio-system", "istiod")
+		pod.TypeMeta = kubeApiMeta.TypeMeta{Kind: "Pod", APIVersion: "v1"}
+		mux.HandleFunc("/api/v1/namespaces/istio-system/pods/"+name, func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(t, w, &pod)
+		})
+		for path, body := range paths {
+			body := body
+			mux.HandleFunc("/api/v1/namespaces/istio-system/pods/"+name+":8080/proxy"+path, func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write(body)
+			})
+		}
+	}
+	return newTestServerClient(t, mux)
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := ioutil.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDiscoveryDo(t *testing.T) {
+	var mu sync.Mutex
+	queried := map[string]int{}
+	c := newTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		queried[r.URL.Path]++
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	got, err := c.DiscoveryDo(context.Background(), "istiod-2", "istio-system", "/debug/syncz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "ok" {
+		t.Fatalf("unexpected response %q", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string]int{"/api/v1/namespaces/istio-system/pods/istiod-2:8080/proxy/debug/syncz": 1}
+	if !reflect.DeepEqual(queried, want) {
+		t.Fatalf("got requests %v, want %v", queried, want)
+	}
+}
+
+func TestGetDeltaXDSStats(t *testing.T) {
+	c := newDiscoveryTestClient(t, map[string]map[string][]byte{
+		"istiod-1": {deltaXDSDebugPath: readFixture(t, "deltaz.json")},
+	})
+	stats, err := c.GetDeltaXDSStats(context.Background(), "istio-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 stats, got %+v", stats)
+	}
+	got := stats[1]
+	if got.Istiod != "istiod-1" || got.ProxyID != "productpage-v1-7f44c4d57c-7hxsb.default" || got.Pushes != 12 ||
+		got.ResourcesSent != 40 || got.ResourcesRemoved != 2 {
+		t.Fatalf("unexpected stat: %+v", got)
+	}
+}
+
+func TestGetDeltaXDSStatsUnsupported(t *testing.T) {
+	c := newDiscoveryTestClient(t, map[string]map[string][]byte{
+		"istiod-1": {},
+	})
+	if _, err := c.GetDeltaXDSStats(context.Background(), "istio-system"); !errors.Is(err, ErrDeltaXDSUnsupported) {
+		t.Fatalf("expected ErrDeltaXDSUnsupported, got %v", err)
+	}
+}
+
+func TestGetDeltaXDSStatsMissingPod(t *testing.T) {
+	// istiod-1 is listed, but deleted before being queried.
+	c := newTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/namespaces/istio-system/pods" {
+			writeJSON(t, w, podList(istioPod("istiod-1", "istio-system", "istiod")))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(t, w, &kubeApiMeta.Status{
+			TypeMeta: kubeApiMeta.TypeMeta{Kind: "Status", APIVersion: "v1"},
+			Status:   kubeApiMeta.StatusFailure,
+			Reason:   kubeApiMeta.StatusReasonNotFound,
+			Message:  `pods "istiod-1" not found`,
+			Code:     http.StatusNotFound,
+		})
+	}))
+	_, err := c.GetDeltaXDSStats(context.Background(), "istio-system")
+	if err == nil || errors.Is(err, ErrDeltaXDSUnsupported) || !kubeApiErrors.IsNotFound(err) {
+		t.Fatalf("got error %v, want the NotFound error of the missing pod", err)
+	}
+}
+
+func istiodDeployment(name, namespace string) *kubeApiApps.Deployment {
+	return &kubeApiApps.Deployment{
+		ObjectMeta: kubeApiMeta.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{"app": "istiod"},
+		},
+	}
+}
+
+func TestDiscoverIstioNamespace(t *testing.T) {
+	cases := []struct {
+		name    string
+		objects []runtime.Object
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "non-standard namespace",
+			objects: []runtime.Object{istiodDeployment("istiod", "istio-control")},
+			want:    "istio-control",
+		},
+		{
+			name: "multiple replicas in one namespace",
+			objects: []runtime.Object{
+				istiodDeployment("istiod", "istio-control"),
+				istiodDeployment("istiod-canary", "istio-control"),
+			},
+			want: "istio-control",
+		},
+		{
+			name:    "not installed",
+			wantErr: true,
+		},
+		{
+			name: "ambiguous",
+			objects: []runtime.Object{
+				istiodDeployment("istiod", "istio-system"),
+				istiodDeployment("istiod", "istio-control"),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newFakeClient(tt.objects...).DiscoverIstioNamespace(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DiscoverIstioNamespace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func configz(resourceVersions ...string) []byte {
+	out := "\n[\n"
+	for i, rv := range resourceVersions {
+		out += fmt.Sprintf(`  {"type": {"Group": "networking.istio.io", "Version": "v1alpha3", "Kind": "VirtualService"},
+    "name": "vs-%d", "namespace": "default", "resourceVersion": %q, "spec": {}},
+`, i, rv)
+	}
+	return []byte(out + "\n{}]")
+}
+
+func TestCheckIstiodConsistency(t *testing.T) {
+	cases := []struct {
+		name      string
+		responses map[string]map[string][]byte
+		want      bool
+	}{
+		{
+			name: "agreeing",
+			responses: map[string]map[string][]byte{
+				"istiod-1": {configzDebugPath: configz("100", "200")},
+				"istiod-2": {configzDebugPath: configz("100", "200")},
+			},
+			want: true,
+		},
+		{
+			name: "disagreeing",
+			responses: map[string]map[string][]byte{
+				"istiod-1": {configzDebugPath: configz("100", "200")},
+				"istiod-2": {configzDebugPath: configz("100", "201")},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newDiscoveryTestClient(t, tt.responses)
+			consistent, versions, err := c.CheckIstiodConsistency(context.Background(), "istio-system")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if consistent != tt.want {
+				t.Fatalf("got consistent = %v, want %v: %v", consistent, tt.want, versions)
+			}
+			if len(versions) != 2 || versions["istiod-1"] == "" {
+				t.Fatalf("unexpected versions: %v", versions)
+			}
+			if (versions["istiod-1"] == versions["istiod-2"]) != tt.want {
+				t.Fatalf("versions do not reflect consistency: %v", versions)
+			}
+		})
+	}
+}
+
+func TestGetProxySyncStatus(t *testing.T) {
+	c := newDiscoveryTestClient(t, map[string]map[string][]byte{
+		"istiod-1": {synczDebugPath: readFixture(t, "syncz_istiod1.json")},
+		"istiod-2": {synczDebugPath: readFixture(t, "syncz_istiod2.json")},
+	})
+
+	statuses, err := c.GetProxySyncStatus(context.Background(), "istio-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type state struct {
+		proxy, istiod                      string
+		cluster, listener, route, endpoint SyncState
+		synced                             bool
+	}
+	var got []state
+	for _, s := range statuses {
+		got = append(got, state{s.ProxyID, s.Istiod, s.ClusterState(), s.ListenerState(), s.RouteState(), s.EndpointState(), s.Synced()})
+	}
+	want := []state{
+		{"details-v1-5974b67c8-wclmv.default", "istiod-2",
+			SyncStateSynced, SyncStateSynced, SyncStateSynced, SyncStateStale, false},
+		{"productpage-v1-7f44c4d57c-7hxsb.default", "istiod-1",
+			SyncStateSynced, SyncStateSynced, SyncStateSynced, SyncStateSynced, true},
+		// The synced status reported by the istiod the proxy reconnected to is preferred.
+		{"reviews-v1-545db77b95-4dj7w.default", "istiod-2",
+			SyncStateSynced, SyncStateSynced, SyncStateSynced, SyncStateSynced, true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestFindProxyController(t *testing.T) {
+	c := newDiscoveryTestClient(t, map[string]map[string][]byte{
+		"istiod-1": {synczDebugPath: readFixture(t, "syncz_istiod1.json")},
+		"istiod-2": {synczDebugPath: readFixture(t, "syncz_istiod2.json")},
+	})
+
+	for proxy, want := range map[string]string{
+		"productpage-v1-7f44c4d57c-7hxsb.default": "istiod-1",
+		"details-v1-5974b67c8-wclmv.default":      "istiod-2",
+		// Reported by both instances, but only synced with the one it reconnected to.
+		"reviews-v1-545db77b95-4dj7w.default": "istiod-2",
+	} {
+		got, err := c.FindProxyController(context.Background(), "istio-system", proxy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("got controller %s for %s, want %s", got, proxy, want)
+		}
+	}
+	if _, err := c.FindProxyController(context.Background(), "istio-system", "ratings-v1.default"); err == nil {
+		t.Fatal("expected an error for a proxy which is not connected")
+	}
+}
+
+func TestWatchProxySyncStatus(t *testing.T) {
+	responses := []string{
+		`[{"proxy": "productpage-v1.default", "cluster_sent": "1", "cluster_acked": "1"}]`,
+		`[{"proxy": "productpage-v1.default", "cluster_sent": "1", "cluster_acked": "1"}]`,
+		`[{"proxy": "productpage-v1.default", "cluster_sent": "2", "cluster_acked": "1"}]`,
+	}
+	var requests int32
+	c := newTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/namespaces/istio-system/pods":
+			writeJSON(t, w, podList(istioPod("istiod-1", "istio-system", "istiod")))
+		case "/api/v1/namespaces/istio-system/pods/istiod-1:8080/proxy" + synczDebugPath:
+			n := int(atomic.AddInt32(&requests, 1)) - 1
+			if n >= len(responses) {
+				n = len(responses) - 1
+			}
+			_, _ = w.Write([]byte(responses[n]))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var snapshots [][]SyncStatus
+	err := c.WatchProxySyncStatus(ctx, "istio-system", func(statuses []SyncStatus) {
+		snapshots = append(snapshots, statuses)
+		if len(snapshots) == 2 {
+			cancel()
+		}
+	}, WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]SyncStatus{
+		{{Istiod: "istiod-1", ProxyID: "productpage-v1.default", ClusterSent: "1", ClusterAcked: "1"}},
+		{{Istiod: "istiod-1", ProxyID: "productpage-v1.default", ClusterSent: "2", ClusterAcked: "1"}},
+	}
+	if !reflect.DeepEqual(snapshots, want) {
+		t.Fatalf("got snapshots %+v, want %+v", snapshots, want)
+	}
+	if got := atomic.LoadInt32(&requests); got < 3 {
+		t.Fatalf("expected the unchanged status to be polled, got %d requests", got)
+	}
+}
+
+func TestWatchProxySyncStatusErrors(t *testing.T) {
+	status := `[{"proxy": "productpage-v1.default", "cluster_sent": "1", "cluster_acked": "1"}]`
+	cases := []struct {
+		name     string
+		failures []func(w http.ResponseWriter)
+		wantErr  bool
+	}{
+		{
+			name: "transient failures are retried",
+			failures: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { http.Error(w, "unavailable", http.StatusServiceUnavailable) },
+				func(w http.ResponseWriter) { http.Error(w, "internal error", http.StatusInternalServerError) },
+			},
+		},
+		{
+			name: "invalid status ends the watch",
+			failures: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { _, _ = w.Write([]byte("not json")) },
+			},
+			wantErr: true,
+		},
+		{
+			name: "forbidden ends the watch",
+			failures: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { http.Error(w, "forbidden", http.StatusForbidden) },
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			c := newTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v1/namespaces/istio-system/pods":
+					writeJSON(t, w, podList(istioPod("istiod-1", "istio-system", "istiod")))
+				case "/api/v1/namespaces/istio-system/pods/istiod-1:8080/proxy" + synczDebugPath:
+					if n := int(atomic.AddInt32(&requests, 1)) - 1; n < len(tt.failures) {
+						tt.failures[n](w)
+						return
+					}
+					_, _ = w.Write([]byte(status))
+				default:
+					http.NotFound(w, r)
+				}
+			}), WithRetryPolicy(RetryPolicy{Attempts: 1}))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			var snapshots [][]SyncStatus
+			err := c.WatchProxySyncStatus(ctx, "istio-system", func(statuses []SyncStatus) {
+				snapshots = append(snapshots, statuses)
+				cancel()
+			}, WithPollInterval(time.Millisecond))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected the watch to fail")
+				}
+				if len(snapshots) != 0 {
+					t.Fatalf("expected no status to be reported, got %+v", snapshots)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := [][]SyncStatus{
+				{{Istiod: "istiod-1", ProxyID: "productpage-v1.default", ClusterSent: "1", ClusterAcked: "1"}},
+			}
+			if !reflect.DeepEqual(snapshots, want) {
+				t.Fatalf("got snapshots %+v, want %+v", snapshots, want)
+			}
+			if got, want := atomic.LoadInt32(&requests), int32(len(tt.failures)+1); got != want {
+				t.Fatalf("got %d requests, want %d", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// proxyContainerName is the name of the injected sidecar container.
+	proxyContainerName = "istio-proxy"
+)
+
+// isInjectedPod returns true if the pod has an istio-proxy container.
+func isInjectedPod(pod *kubeApiCore.Pod) bool {
+	for _, container := range pod.Spec.Containers {
+		if container.Name == proxyContainerName {
+			return true
+		}
+	}
+	return false
+}
+
+// listInjectedPods returns the running pods of the namespace which have an istio-proxy container.
+func (c *client) listInjectedPods(ctx context.Context, namespace string) ([]kubeApiCore.Pod, error) {
+	pods, err := c.CoreV1().Pods(namespace).List(ctx, kubeApiMeta.ListOptions{
+		FieldSelector: "status.phase=Running",
+	})
+	if err != nil {
+		return nil, err
+	}
+	var injected []kubeApiCore.Pod
+	for i := range pods.Items {
+		if isInjectedPod(&pods.Items[i]) {
+			injected = append(injected, pods.Items[i])
+		}
+	}
+	return injected, nil
+}
+
+// envoyServerInfo is the subset of the Envoy /server_info response used by this package.
+type envoyServerInfo struct {
+	Version            string `json:"version"`
+	State              string `json:"state"`
+	HotRestartVersion  string `json:"hot_restart_version"`
+	UptimeCurrentEpoch string `json:"uptime_current_epoch"`
+	UptimeAllEpochs    string `json:"uptime_all_epochs"`
+	CommandLineOptions struct {
+		RestartEpoch int `json:"restart_epoch"`
+	} `json:"command_line_options"`
+}
+
+func (c *client) getEnvoyServerInfo(ctx context.Context, podName, podNamespace string) (*envoyServerInfo, error) {
+	out, err := c.EnvoyDo(ctx, podName, podNamespace, "GET", "server_info", nil)
+	if err != nil {
+		return nil, err
+	}
+	info := &envoyServerInfo{}
+	if err := json.Unmarshal(out, info); err != nil {
+		return nil, fmt.Errorf("failed parsing server_info of %s.%s: %v", podName, podNamespace, err)
+	}
+	return info, nil
+}
+
+// ServerState is the state of the Envoy server, as reported by /server_info.
+type ServerState string
+
+const (
+	// ServerStateLive is the state of a server which is initialized and serving traffic.
+	ServerStateLive ServerState = "LIVE"
+	// ServerStateDraining is the state of a server draining its listeners, for instance before a hot restart.
+	ServerStateDraining ServerState = "DRAINING"
+	// ServerStatePreInitializing is the state of a server which hasn't started initializing yet.
+	ServerStatePreInitializing ServerState = "PRE_INITIALIZING"
+	// ServerStateInitializing is the state of a server waiting for its initial configuration.
+	ServerStateInitializing ServerState = "INITIALIZING"
+)
+
+// ServerInfo describes the Envoy server of a proxy.
+type ServerInfo struct {
+	// Version is the build version of Envoy, such as
+	// "73f240a29bece92a8882a36893ccce07b4a54664/1.15.0-dev/Clean/RELEASE/BoringSSL".
+	Version string
+	State   ServerState
+	// HotRestartVersion identifies the compatibility of the binary for hot restarts.
+	HotRestartVersion string
+	// UptimeCurrentEpoch is the time since the current Envoy process started.
+	UptimeCurrentEpoch time.Duration
+	// UptimeAllEpochs is the time since the first Envoy process started, across hot restarts.
+	UptimeAllEpochs time.Duration
+}
+
+func (c *client) GetProxyServerInfo(ctx context.Context, podName, podNamespace string) (*ServerInfo, error) {
+	info, err := c.getEnvoyServerInfo(ctx, podName, podNamespace)
+	if err != nil {
+		return nil, err
+	}
+	out := &ServerInfo{
+		Version:           info.Version,
+		State:             ServerState(info.State),
+		HotRestartVersion: info.HotRestartVersion,
+	}
+	switch out.State {
+	case ServerStateLive, ServerStateDraining, ServerStatePreInitializing, ServerStateInitializing:
+	default:
+		return nil, fmt.Errorf("unknown state %q of proxy %s.%s", info.State, podName, podNamespace)
+	}
+	// The uptimes are protobuf durations, such as "3600.5s".
+	if out.UptimeCurrentEpoch, err = parseProtoDuration(info.UptimeCurrentEpoch); err != nil {
+		return nil, fmt.Errorf("failed parsing uptime of proxy %s.%s: %v", podName, podNamespace, err)
+	}
+	if out.UptimeAllEpochs, err = parseProtoDuration(info.UptimeAllEpochs); err != nil {
+		return nil, fmt.Errorf("failed parsing uptime of proxy %s.%s: %v", podName, podNamespace, err)
+	}
+	return out, nil
+}
+
+func (c *client) GetProxyRestartEpoch(ctx context.Context, podName, podNamespace string) (int, error) {
+	info, err := c.getEnvoyServerInfo(ctx, podName, podNamespace)
+	if err != nil {
+		return 0, err
+	}
+	return info.CommandLineOptions.RestartEpoch, nil
+}
+
+// parseProtoDuration parses the JSON representation of a google.protobuf.Duration. An empty string is a
+// zero duration.
+func parseProtoDuration(d string) (time.Duration, error) {
+	if d == "" {
+		return 0, nil
+	}
+	if !strings.HasSuffix(d, "s") {
+		return 0, fmt.Errorf("invalid duration %q", d)
+	}
+	return time.ParseDuration(d)
+}
+
+func (c *client) DrainProxy(ctx context.Context, podName, podNamespace string) error {
+	_, err := c.envoyPost(ctx, podName, podNamespace, "drain_listeners")
+	return err
+}
+
+func (c *client) QuitProxy(ctx context.Context, podName, podNamespace string) error {
+	_, err := c.envoyPost(ctx, podName, podNamespace, "quitquitquit")
+	return err
+}
+
+// envoyPost sends a POST request to the Envoy admin of the pod and returns the body of the response, or an
+// error unless the request succeeds.
+func (c *client) envoyPost(ctx context.Context, podName, podNamespace, path string) ([]byte, error) {
+	status, out, err := c.envoyRequest(ctx, podName, podNamespace, "POST", path, nil, newEnvoyDoOptions(nil))
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("proxy %s.%s refused %s: %d %s", podName, podNamespace, path, status,
+			strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+func (c *client) IsProxyReady(ctx context.Context, podName, podNamespace string, opts ...EnvoyDoOption) (bool, string, error) {
+	options := newEnvoyDoOptions(append([]EnvoyDoOption{WithProxyPort(proxyReadinessPort)}, opts...))
+	// The Envoy admin serves readiness on /ready, the pilot-agent on /healthz/ready.
+	path := "healthz/ready"
+	if options.port == envoyAdminPort {
+		path = "ready"
+	}
+	status, out, err := c.envoyRequest(ctx, podName, podNamespace, "GET", path, nil, options)
+	if err != nil {
+		return false, "", err
+	}
+	return status == http.StatusOK, strings.TrimSpace(string(out)), nil
+}
+
+// envoyVersionMatches returns true if the Envoy build version reported by /server_info, such as
+// "73f240a29bece92a8882a36893ccce07b4a54664/1.15.0-dev/Clean/RELEASE/BoringSSL", matches version.
+// Both the full build version and its version number are accepted.
+func envoyVersionMatches(buildVersion, version string) bool {
+	if buildVersion == version {
+		return true
+	}
+	parts := strings.Split(buildVersion, "/")
+	return len(parts) > 1 && parts[1] == version
+}
+
+func (c *client) ListPodsByProxyVersion(ctx context.Context, namespace, version string) ([]kubeApiCore.Pod, error) {
+	injected, err := c.listInjectedPods(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]bool, len(injected))
+	var mu sync.Mutex
+	var errs error
+	forEachConcurrently(len(injected), defaultConcurrency, func(i int) {
+		pod := injected[i]
+		info, err := c.getEnvoyServerInfo(ctx, pod.Name, pod.Namespace)
+		if err != nil {
+			mu.Lock()
+			errs = multierror.Append(errs, err)
+			mu.Unlock()
+			return
+		}
+		matches[i] = envoyVersionMatches(info.Version, version)
+	})
+
+	var out []kubeApiCore.Pod
+	for i, pod := range injected {
+		if matches[i] {
+			out = append(out, pod)
+		}
+	}
+	return out, errs
+}
@@ -0,0 +1,106 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// envoyCertificates is the subset of the Envoy /certs response used by this package.
+type envoyCertificates struct {
+	Certificates []struct {
+		CACert    []envoyCertificateDetails `json:"ca_cert"`
+		CertChain []envoyCertificateDetails `json:"cert_chain"`
+	} `json:"certificates"`
+}
+
+type envoyCertificateDetails struct {
+	Path            string `json:"path"`
+	SerialNumber    string `json:"serial_number"`
+	SubjectAltNames []struct {
+		URI       string `json:"uri"`
+		DNS       string `json:"dns"`
+		IPAddress string `json:"ip_address"`
+	} `json:"subject_alt_names"`
+	ValidFrom      string `json:"valid_from"`
+	ExpirationTime string `json:"expiration_time"`
+}
+
+// ProxyCert is a certificate loaded by Envoy.
+type ProxyCert struct {
+	// CA is true for the certificates Envoy validates peers with, false for those of its certificate chains.
+	CA bool
+	// Path is the file the certificate was loaded from, or "<inline>" for certificates sent over SDS.
+	Path            string
+	SerialNumber    string
+	SubjectAltNames []string
+	ValidFrom       time.Time
+	ExpirationTime  time.Time
+	// Expired is true if the certificate was expired when it was retrieved.
+	Expired bool
+}
+
+func (c *client) GetProxyCerts(ctx context.Context, podName, podNamespace string) ([]ProxyCert, error) {
+	out, err := c.EnvoyDo(ctx, podName, podNamespace, "GET", "certs", nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseProxyCerts(out, time.Now())
+}
+
+func parseProxyCerts(out []byte, now time.Time) ([]ProxyCert, error) {
+	certs := envoyCertificates{}
+	if err := json.Unmarshal(out, &certs); err != nil {
+		return nil, fmt.Errorf("failed parsing certs: %v", err)
+	}
+	var result []ProxyCert
+	add := func(ca bool, details []envoyCertificateDetails) error {
+		for _, d := range details {
+			cert := ProxyCert{CA: ca, Path: d.Path, SerialNumber: d.SerialNumber}
+			for _, san := range d.SubjectAltNames {
+				switch {
+				case san.URI != "":
+					cert.SubjectAltNames = append(cert.SubjectAltNames, san.URI)
+				case san.DNS != "":
+					cert.SubjectAltNames = append(cert.SubjectAltNames, san.DNS)
+				case san.IPAddress != "":
+					cert.SubjectAltNames = append(cert.SubjectAltNames, san.IPAddress)
+				}
+			}
+			var err error
+			if cert.ValidFrom, err = time.Parse(time.RFC3339, d.ValidFrom); err != nil {
+				return fmt.Errorf("invalid start of validity of certificate %s: %v", d.SerialNumber, err)
+			}
+			if cert.ExpirationTime, err = time.Parse(time.RFC3339, d.ExpirationTime); err != nil {
+				return fmt.Errorf("invalid expiration time of certificate %s: %v", d.SerialNumber, err)
+			}
+			cert.Expired = !now.Before(cert.ExpirationTime)
+			result = append(result, cert)
+		}
+		return nil
+	}
+	for _, c := range certs.Certificates {
+		if err := add(true, c.CACert); err != nil {
+			return nil, err
+		}
+		if err := add(false, c.CertChain); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,67 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetProxyCerts(t *testing.T) {
+	c := newFakeClient()
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"productpage": envoyResponse("/certs", string(readFixture(t, "certs.json"))),
+	})
+
+	certs, err := c.GetProxyCerts(context.Background(), "productpage", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 {
+		t.Fatalf("got %d certs, want 2", len(certs))
+	}
+
+	// The CA of the fixture expired before the time of the test, the workload certificate did not.
+	now := time.Date(2020, 8, 12, 12, 0, 0, 0, time.UTC)
+	certs, err = parseProxyCerts(readFixture(t, "certs.json"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ProxyCert{
+		{
+			CA:             true,
+			Path:           "<inline>",
+			SerialNumber:   "9fb3e0ea5d45cc1e4b5e4ebd4c4f0f51",
+			ValidFrom:      time.Date(2019, 8, 1, 10, 31, 43, 0, time.UTC),
+			ExpirationTime: time.Date(2020, 8, 1, 10, 31, 43, 0, time.UTC),
+			Expired:        true,
+		},
+		{
+			Path:         "<inline>",
+			SerialNumber: "4c7fb4e5663c2a29d0c7ebae473b5a9b",
+			SubjectAltNames: []string{
+				"spiffe://cluster.local/ns/default/sa/bookinfo-productpage", "productpage.default.svc",
+			},
+			ValidFrom:      time.Date(2020, 8, 12, 9, 58, 31, 0, time.UTC),
+			ExpirationTime: time.Date(2020, 8, 13, 9, 58, 31, 0, time.UTC),
+		},
+	}
+	if !reflect.DeepEqual(certs, want) {
+		t.Fatalf("got certs %+v, want %+v", certs, want)
+	}
+}
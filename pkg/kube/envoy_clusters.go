@@ -0,0 +1,192 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// envoyClusters is the subset of the Envoy /clusters?format=json response used by this package.
+type envoyClusters struct {
+	ClusterStatuses []envoyClusterStatus `json:"cluster_statuses"`
+}
+
+type envoyClusterStatus struct {
+	Name            string `json:"name"`
+	CircuitBreakers struct {
+		Thresholds []envoyCircuitBreakerThreshold `json:"thresholds"`
+	} `json:"circuit_breakers"`
+	HostStatuses []envoyHostStatus `json:"host_statuses"`
+}
+
+type envoyCircuitBreakerThreshold struct {
+	Priority           string `json:"priority"`
+	MaxConnections     uint32 `json:"max_connections"`
+	MaxPendingRequests uint32 `json:"max_pending_requests"`
+	MaxRequests        uint32 `json:"max_requests"`
+	MaxRetries         uint32 `json:"max_retries"`
+}
+
+type envoyHostStatus struct {
+	Address struct {
+		SocketAddress struct {
+			Address   string `json:"address"`
+			PortValue uint32 `json:"port_value"`
+		} `json:"socket_address"`
+	} `json:"address"`
+	HealthStatus struct {
+		EdsHealthStatus         string `json:"eds_health_status"`
+		FailedOutlierCheck      bool   `json:"failed_outlier_check"`
+		FailedActiveHealthCheck bool   `json:"failed_active_health_check"`
+	} `json:"health_status"`
+	Weight   uint32 `json:"weight"`
+	Locality struct {
+		Region  string `json:"region"`
+		Zone    string `json:"zone"`
+		SubZone string `json:"sub_zone"`
+	} `json:"locality"`
+}
+
+func (c *client) getEnvoyClusters(ctx context.Context, podName, podNamespace string) (*envoyClusters, error) {
+	out, err := c.EnvoyDo(ctx, podName, podNamespace, "GET", "clusters?format=json", nil)
+	if err != nil {
+		return nil, err
+	}
+	clusters := &envoyClusters{}
+	if err := json.Unmarshal(out, clusters); err != nil {
+		return nil, fmt.Errorf("failed parsing clusters of %s.%s: %v", podName, podNamespace, err)
+	}
+	return clusters, nil
+}
+
+// CircuitBreakerThresholds are the circuit breaker limits of a cluster for one routing priority.
+type CircuitBreakerThresholds struct {
+	// Priority is "DEFAULT" or "HIGH".
+	Priority           string
+	MaxConnections     uint32
+	MaxPendingRequests uint32
+	MaxRequests        uint32
+	MaxRetries         uint32
+}
+
+// CircuitBreakerStatus is the circuit breaking and outlier detection state of an Envoy cluster.
+type CircuitBreakerStatus struct {
+	Cluster    string
+	Thresholds []CircuitBreakerThresholds
+	// Hosts is the number of hosts in the cluster.
+	Hosts int
+	// EjectedHosts is the number of hosts currently ejected by outlier detection.
+	EjectedHosts int
+}
+
+func (c *client) GetProxyCircuitBreakerStatus(ctx context.Context, namespace, podName string) ([]CircuitBreakerStatus, error) {
+	clusters, err := c.getEnvoyClusters(ctx, podName, namespace)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]CircuitBreakerStatus, 0, len(clusters.ClusterStatuses))
+	for _, cluster := range clusters.ClusterStatuses {
+		status := CircuitBreakerStatus{
+			Cluster: cluster.Name,
+			Hosts:   len(cluster.HostStatuses),
+		}
+		for _, t := range cluster.CircuitBreakers.Thresholds {
+			priority := t.Priority
+			if priority == "" {
+				// The default priority is omitted from the JSON output.
+				priority = "DEFAULT"
+			}
+			status.Thresholds = append(status.Thresholds, CircuitBreakerThresholds{
+				Priority:           priority,
+				MaxConnections:     t.MaxConnections,
+				MaxPendingRequests: t.MaxPendingRequests,
+				MaxRequests:        t.MaxRequests,
+				MaxRetries:         t.MaxRetries,
+			})
+		}
+		for _, host := range cluster.HostStatuses {
+			if host.HealthStatus.FailedOutlierCheck {
+				status.EjectedHosts++
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Endpoint is a host of an Envoy cluster, as currently seen by the proxy.
+type Endpoint struct {
+	Cluster string
+	// Address of the endpoint, as "host:port".
+	Address  string
+	Locality Locality
+	Weight   uint32
+	// HealthStatus is the health reported for the endpoint by EDS, such as "HEALTHY" or "DRAINING".
+	HealthStatus string
+	// FailedOutlierCheck is true if the endpoint is ejected by outlier detection.
+	FailedOutlierCheck bool
+	// FailedActiveHealthCheck is true if the endpoint fails the active health checks of the cluster.
+	FailedActiveHealthCheck bool
+}
+
+// Healthy returns true if Envoy will route requests to the endpoint. Like Envoy, an endpoint without a health
+// status from EDS, or with an UNKNOWN one, is considered healthy.
+func (e Endpoint) Healthy() bool {
+	switch e.HealthStatus {
+	case "", "UNKNOWN", "HEALTHY":
+		return !e.FailedOutlierCheck && !e.FailedActiveHealthCheck
+	default:
+		return false
+	}
+}
+
+func (c *client) GetProxyEndpoints(ctx context.Context, podName, podNamespace, clusterFilter string) ([]Endpoint, error) {
+	clusters, err := c.getEnvoyClusters(ctx, podName, podNamespace)
+	if err != nil {
+		return nil, err
+	}
+	var endpoints []Endpoint
+	found := false
+	for _, cluster := range clusters.ClusterStatuses {
+		if clusterFilter != "" && cluster.Name != clusterFilter {
+			continue
+		}
+		found = true
+		for _, host := range cluster.HostStatuses {
+			address := host.Address.SocketAddress
+			endpoints = append(endpoints, Endpoint{
+				Cluster: cluster.Name,
+				Address: net.JoinHostPort(address.Address, strconv.Itoa(int(address.PortValue))),
+				Locality: Locality{
+					Region:  host.Locality.Region,
+					Zone:    host.Locality.Zone,
+					Subzone: host.Locality.SubZone,
+				},
+				Weight:                  host.Weight,
+				HealthStatus:            host.HealthStatus.EdsHealthStatus,
+				FailedOutlierCheck:      host.HealthStatus.FailedOutlierCheck,
+				FailedActiveHealthCheck: host.HealthStatus.FailedActiveHealthCheck,
+			})
+		}
+	}
+	if clusterFilter != "" && !found {
+		return nil, fmt.Errorf("proxy %s.%s has no cluster %s", podName, podNamespace, clusterFilter)
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,143 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// withFakeClusters serves the clusters.json fixture from the admin port of the pod.
+func withFakeClusters(t *testing.T, c *client, pod string) {
+	t.Helper()
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		pod: envoyResponse("/clusters", string(readFixture(t, "clusters.json"))),
+	})
+}
+
+func TestGetProxyCircuitBreakerStatus(t *testing.T) {
+	c := newFakeClient()
+	withFakeClusters(t, c, "productpage")
+
+	got, err := c.GetProxyCircuitBreakerStatus(context.Background(), "default", "productpage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const unlimited = 4294967295
+	want := []CircuitBreakerStatus{
+		{
+			Cluster: "outbound|9080||reviews.default.svc.cluster.local",
+			Thresholds: []CircuitBreakerThresholds{
+				{Priority: "DEFAULT", MaxConnections: 100, MaxPendingRequests: 10, MaxRequests: 1024, MaxRetries: 3},
+				{Priority: "HIGH", MaxConnections: 1024, MaxPendingRequests: 1024, MaxRequests: 1024, MaxRetries: 3},
+			},
+			Hosts:        3,
+			EjectedHosts: 1,
+		},
+		{
+			Cluster: "inbound|9080|http|productpage.default.svc.cluster.local",
+			Thresholds: []CircuitBreakerThresholds{
+				{Priority: "DEFAULT", MaxConnections: unlimited, MaxPendingRequests: unlimited, MaxRequests: unlimited, MaxRetries: unlimited},
+			},
+			Hosts: 1,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestGetProxyEndpoints(t *testing.T) {
+	c := newFakeClient()
+	withFakeClusters(t, c, "productpage")
+
+	const reviews = "outbound|9080||reviews.default.svc.cluster.local"
+	got, err := c.GetProxyEndpoints(context.Background(), "productpage", "default", reviews)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Endpoint{
+		{
+			Cluster:            reviews,
+			Address:            "10.44.0.12:9080",
+			Locality:           Locality{Region: "us-east1", Zone: "us-east1-b"},
+			Weight:             1,
+			HealthStatus:       "HEALTHY",
+			FailedOutlierCheck: true,
+		},
+		{
+			Cluster:      reviews,
+			Address:      "10.44.0.13:9080",
+			Locality:     Locality{Region: "us-east1", Zone: "us-east1-c"},
+			Weight:       3,
+			HealthStatus: "HEALTHY",
+		},
+		{
+			Cluster:                 reviews,
+			Address:                 "10.44.0.14:9080",
+			Locality:                Locality{Region: "us-east1", Zone: "us-east1-d"},
+			Weight:                  1,
+			HealthStatus:            "UNHEALTHY",
+			FailedActiveHealthCheck: true,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	var healthy []bool
+	for _, ep := range got {
+		healthy = append(healthy, ep.Healthy())
+	}
+	if want := []bool{false, true, false}; !reflect.DeepEqual(healthy, want) {
+		t.Fatalf("got health %v, want %v", healthy, want)
+	}
+
+	all, err := c.GetProxyEndpoints(context.Background(), "productpage", "default", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 {
+		t.Fatalf("got %d endpoints for all the clusters, want 4", len(all))
+	}
+
+	if _, err := c.GetProxyEndpoints(context.Background(), "productpage", "default", "missing"); err == nil {
+		t.Fatal("expected an error for a missing cluster")
+	}
+}
+
+func TestEndpointHealthy(t *testing.T) {
+	cases := []struct {
+		name     string
+		endpoint Endpoint
+		want     bool
+	}{
+		{name: "healthy", endpoint: Endpoint{HealthStatus: "HEALTHY"}, want: true},
+		{name: "no health status", endpoint: Endpoint{}, want: true},
+		{name: "unknown", endpoint: Endpoint{HealthStatus: "UNKNOWN"}, want: true},
+		{name: "unknown ejected", endpoint: Endpoint{HealthStatus: "UNKNOWN", FailedOutlierCheck: true}},
+		{name: "no health status failing", endpoint: Endpoint{FailedActiveHealthCheck: true}},
+		{name: "unhealthy", endpoint: Endpoint{HealthStatus: "UNHEALTHY"}},
+		{name: "draining", endpoint: Endpoint{HealthStatus: "DRAINING"}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.endpoint.Healthy(); got != tt.want {
+				t.Fatalf("got healthy %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// volatileConfigDumpFields are the fields of a config dump which differ between proxies receiving the
+// same configuration, such as update timestamps and xDS versions. They are stripped before diffing.
+var volatileConfigDumpFields = map[string]bool{
+	"version_info":        true,
+	"last_updated":        true,
+	"last_update_attempt": true,
+}
+
+func (c *client) DiffProxyConfig(ctx context.Context, podA, namespaceA, podB, namespaceB string) (string, error) {
+	dumpA, err := c.normalizedConfigDump(ctx, podA, namespaceA)
+	if err != nil {
+		return "", err
+	}
+	dumpB, err := c.normalizedConfigDump(ctx, podB, namespaceB)
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		FromFile: namespaceA + "/" + podA,
+		A:        difflib.SplitLines(dumpA),
+		ToFile:   namespaceB + "/" + podB,
+		B:        difflib.SplitLines(dumpB),
+		Context:  3,
+	})
+}
+
+// normalizedConfigDump returns the indented config dump of the proxy in the given pod, without volatile
+// fields. Object keys are sorted so that dumps are diffed line by line.
+func (c *client) normalizedConfigDump(ctx context.Context, podName, podNamespace string) (string, error) {
+	out, err := c.EnvoyDo(ctx, podName, podNamespace, "GET", "config_dump", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed getting config dump of %s.%s: %v", podName, podNamespace, err)
+	}
+	var dump interface{}
+	if err := json.Unmarshal(out, &dump); err != nil {
+		return "", fmt.Errorf("failed parsing config dump of %s.%s: %v", podName, podNamespace, err)
+	}
+	normalized, err := json.MarshalIndent(stripVolatileFields(dump), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(normalized) + "\n", nil
+}
+
+func stripVolatileFields(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if volatileConfigDumpFields[key] {
+				delete(v, key)
+				continue
+			}
+			v[key] = stripVolatileFields(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = stripVolatileFields(value)
+		}
+	}
+	return v
+}
@@ -0,0 +1,72 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffProxyConfig(t *testing.T) {
+	c := newFakeClient(injectedPod("reviews-v1", "default"), injectedPod("reviews-v2", "default"))
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"reviews-v1": envoyResponse("/config_dump", string(readFixture(t, "config_dump_diff_a.json"))),
+		"reviews-v2": envoyResponse("/config_dump", string(readFixture(t, "config_dump_diff_b.json"))),
+	})
+
+	diff, err := c.DiffProxyConfig(context.Background(), "reviews-v1", "default", "reviews-v2", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changes []string
+	for _, line := range strings.Split(diff, "\n") {
+		if strings.HasPrefix(line, "---") || strings.HasPrefix(line, "+++") {
+			continue
+		}
+		if strings.HasPrefix(line, "-") || strings.HasPrefix(line, "+") {
+			changes = append(changes, strings.Join(strings.Fields(line), " "))
+		}
+	}
+	// The versions and timestamps differ too, but only the connect timeout of the reviews cluster is reported.
+	want := []string{`- "connect_timeout": "10s",`, `+ "connect_timeout": "1s",`}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("got changes %q, want %q in diff:\n%s", changes, want, diff)
+	}
+	if !strings.Contains(diff, "--- default/reviews-v1") || !strings.Contains(diff, "+++ default/reviews-v2") {
+		t.Fatalf("diff is missing the pod names:\n%s", diff)
+	}
+
+	diff, err = c.DiffProxyConfig(context.Background(), "reviews-v1", "default", "reviews-v1", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != "" {
+		t.Fatalf("expected no diff between the same proxy, got:\n%s", diff)
+	}
+}
+
+func TestDiffProxyConfigError(t *testing.T) {
+	c := newFakeClient(injectedPod("reviews-v1", "default"))
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"reviews-v1": envoyResponse("/config_dump", string(readFixture(t, "config_dump_diff_a.json"))),
+	})
+
+	if _, err := c.DiffProxyConfig(context.Background(), "reviews-v1", "default", "missing", "default"); err == nil {
+		t.Fatal("expected an error for a pod without a proxy")
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3" // Registers TLS contexts.
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	emptypb "github.com/golang/protobuf/ptypes/empty"
+	"github.com/hashicorp/go-multierror"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+const (
+	bootstrapConfigDumpType = "type.googleapis.com/envoy.admin.v3.BootstrapConfigDump"
+	clustersConfigDumpType  = "type.googleapis.com/envoy.admin.v3.ClustersConfigDump"
+)
+
+// lenientResolver resolves the types of Any messages in config dumps. Unknown types, such as extensions
+// of newer Envoy versions, are decoded as a placeholder instead of failing the whole dump.
+type lenientResolver struct{}
+
+func (lenientResolver) Resolve(typeURL string) (proto.Message, error) {
+	name := typeURL
+	if slash := strings.LastIndex(typeURL, "/"); slash >= 0 {
+		name = name[slash+1:]
+	}
+	// nolint: staticcheck
+	mt := proto.MessageType(name)
+	if mt == nil {
+		return &exprpb.Type{TypeKind: &exprpb.Type_Dyn{Dyn: &emptypb.Empty{}}}, nil
+	}
+	return reflect.New(mt.Elem()).Interface().(proto.Message), nil
+}
+
+// unmarshalEnvoyJSON decodes a message of an Envoy config dump. The "@type" field of messages taken out of an
+// Any is ignored.
+func unmarshalEnvoyJSON(data []byte, msg proto.Message) error {
+	u := &jsonpb.Unmarshaler{AllowUnknownFields: true, AnyResolver: lenientResolver{}}
+	return u.Unmarshal(bytes.NewReader(data), msg)
+}
+
+// getEnvoyConfigDumpSection returns the section of the proxy config dump with the given type, as raw JSON.
+// If mask is not empty, only the fields it selects are requested from the proxy, using the mask query
+// parameter of /config_dump. The mask is applied to every section, so it must select fields of this one.
+func (c *client) getEnvoyConfigDumpSection(ctx context.Context, podName, podNamespace, typeURL, mask string) ([]byte, error) {
+	path := "config_dump"
+	if mask != "" {
+		path += "?mask=" + url.QueryEscape(mask)
+	}
+	out, err := c.EnvoyDo(ctx, podName, podNamespace, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	dump := struct {
+		Configs []json.RawMessage `json:"configs"`
+	}{}
+	if err := json.Unmarshal(out, &dump); err != nil {
+		return nil, fmt.Errorf("failed parsing config dump of %s.%s: %v", podName, podNamespace, err)
+	}
+	for _, section := range dump.Configs {
+		header := struct {
+			Type string `json:"@type"`
+		}{}
+		if err := json.Unmarshal(section, &header); err != nil {
+			return nil, fmt.Errorf("failed parsing config dump of %s.%s: %v", podName, podNamespace, err)
+		}
+		if header.Type == typeURL {
+			return section, nil
+		}
+	}
+	return nil, fmt.Errorf("config dump of %s.%s has no %s", podName, podNamespace, typeURL)
+}
+
+func (c *client) GetProxyBootstrap(ctx context.Context, podName, podNamespace string) ([]byte, error) {
+	section, err := c.getEnvoyConfigDumpSection(ctx, podName, podNamespace, bootstrapConfigDumpType, "bootstrap")
+	if err != nil {
+		return nil, err
+	}
+	dump := struct {
+		Bootstrap json.RawMessage `json:"bootstrap"`
+	}{}
+	if err := json.Unmarshal(section, &dump); err != nil {
+		return nil, fmt.Errorf("failed parsing bootstrap of %s.%s: %v", podName, podNamespace, err)
+	}
+	if len(dump.Bootstrap) == 0 {
+		return nil, fmt.Errorf("config dump of %s.%s has an empty bootstrap", podName, podNamespace)
+	}
+	return dump.Bootstrap, nil
+}
+
+// getEnvoyClusterConfigs returns the raw JSON of the static and dynamic active clusters of the proxy.
+func (c *client) getEnvoyClusterConfigs(ctx context.Context, podName, podNamespace string) ([]json.RawMessage, error) {
+	section, err := c.getEnvoyConfigDumpSection(ctx, podName, podNamespace, clustersConfigDumpType, "")
+	if err != nil {
+		return nil, err
+	}
+	type clusterEntry struct {
+		Cluster json.RawMessage `json:"cluster"`
+	}
+	dump := struct {
+		StaticClusters        []clusterEntry `json:"static_clusters"`
+		DynamicActiveClusters []clusterEntry `json:"dynamic_active_clusters"`
+	}{}
+	if err := json.Unmarshal(section, &dump); err != nil {
+		return nil, fmt.Errorf("failed parsing clusters of %s.%s: %v", podName, podNamespace, err)
+	}
+	var clusters []json.RawMessage
+	for _, entries := range [][]clusterEntry{dump.StaticClusters, dump.DynamicActiveClusters} {
+		for _, entry := range entries {
+			clusters = append(clusters, entry.Cluster)
+		}
+	}
+	return clusters, nil
+}
+
+func (c *client) GetProxyInboundCluster(ctx context.Context, namespace, podName string, port int) (*clusterv3.Cluster, error) {
+	clusters, err := c.getEnvoyClusterConfigs(ctx, podName, namespace)
+	if err != nil {
+		return nil, err
+	}
+	// Inbound clusters are named "inbound|<port>|<port name>|<host>", with the port name empty in newer versions.
+	prefix := fmt.Sprintf("inbound|%d|", port)
+	for _, raw := range clusters {
+		name := struct {
+			Name string `json:"name"`
+		}{}
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return nil, fmt.Errorf("failed parsing clusters of %s.%s: %v", podName, namespace, err)
+		}
+		if !strings.HasPrefix(name.Name, prefix) {
+			continue
+		}
+		cluster := &clusterv3.Cluster{}
+		if err := unmarshalEnvoyJSON(raw, cluster); err != nil {
+			return nil, fmt.Errorf("failed parsing cluster %s of %s.%s: %v", name.Name, podName, namespace, err)
+		}
+		return cluster, nil
+	}
+	return nil, fmt.Errorf("proxy %s.%s has no inbound cluster for port %d", podName, namespace, port)
+}
+
+func (c *client) ResolveProxyCluster(ctx context.Context, podName, podNamespace, fqdn string, port int) (string, bool, error) {
+	clusters, err := c.getEnvoyClusterConfigs(ctx, podName, podNamespace)
+	if err != nil {
+		return "", false, err
+	}
+	// Outbound clusters are named "outbound|<port>|<subset>|<host>", the subset being empty for the whole service.
+	want := fmt.Sprintf("outbound|%d||%s", port, strings.TrimSuffix(fqdn, "."))
+	for _, raw := range clusters {
+		name := struct {
+			Name string `json:"name"`
+		}{}
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return "", false, fmt.Errorf("failed parsing clusters of %s.%s: %v", podName, podNamespace, err)
+		}
+		if name.Name == want {
+			return name.Name, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (c *client) GetProxyConfigDumpFiltered(ctx context.Context, podName, podNamespace, resourceType, nameRegex string) ([]byte, error) {
+	params := url.Values{}
+	if resourceType != "" {
+		params.Set("resource", resourceType)
+	}
+	if nameRegex != "" {
+		params.Set("name_regex", nameRegex)
+	}
+	path := "config_dump"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	return c.EnvoyDo(ctx, podName, podNamespace, "GET", path, nil)
+}
+
+// getEnvoyConfigDumpResources returns the entries of the given field of the config dump, as raw JSON.
+// Only that field is requested from the proxy, using the resource query parameter of /config_dump.
+func (c *client) getEnvoyConfigDumpResources(ctx context.Context, podName, podNamespace, resource string) ([]json.RawMessage, error) {
+	out, err := c.GetProxyConfigDumpFiltered(ctx, podName, podNamespace, resource, "")
+	if err != nil {
+		return nil, err
+	}
+	dump := struct {
+		Configs []json.RawMessage `json:"configs"`
+	}{}
+	if err := json.Unmarshal(out, &dump); err != nil {
+		return nil, fmt.Errorf("failed parsing %s of %s.%s: %v", resource, podName, podNamespace, err)
+	}
+	return dump.Configs, nil
+}
+
+func (c *client) GetProxyListeners(ctx context.Context, podName, podNamespace string) ([]*listenerv3.Listener, error) {
+	resources, err := c.getEnvoyConfigDumpResources(ctx, podName, podNamespace, "dynamic_listeners")
+	if err != nil {
+		return nil, err
+	}
+	listeners := make([]*listenerv3.Listener, 0, len(resources))
+	for _, raw := range resources {
+		dynamic := struct {
+			Name        string `json:"name"`
+			ActiveState *struct {
+				Listener json.RawMessage `json:"listener"`
+			} `json:"active_state"`
+		}{}
+		if err := json.Unmarshal(raw, &dynamic); err != nil {
+			return nil, fmt.Errorf("failed parsing listeners of %s.%s: %v", podName, podNamespace, err)
+		}
+		// Listeners which are still warming or failed to update have no active state.
+		if dynamic.ActiveState == nil {
+			continue
+		}
+		listener := &listenerv3.Listener{}
+		if err := unmarshalEnvoyJSON(dynamic.ActiveState.Listener, listener); err != nil {
+			return nil, fmt.Errorf("failed parsing listener %s of %s.%s: %v", dynamic.Name, podName, podNamespace, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// ListenerError is a listener update rejected by Envoy, for instance because its address is already in use.
+type ListenerError struct {
+	Name string
+	// Address the rejected listener binds, as "host:port".
+	Address string
+	// Details is the error reported by Envoy.
+	Details           string
+	LastUpdateAttempt time.Time
+}
+
+func (c *client) GetProxyListenerErrors(ctx context.Context, podName, podNamespace string) ([]ListenerError, error) {
+	resources, err := c.getEnvoyConfigDumpResources(ctx, podName, podNamespace, "dynamic_listeners")
+	if err != nil {
+		return nil, err
+	}
+	var errs []ListenerError
+	for _, raw := range resources {
+		dynamic := struct {
+			Name       string `json:"name"`
+			ErrorState *struct {
+				FailedConfiguration struct {
+					Address struct {
+						SocketAddress struct {
+							Address   string `json:"address"`
+							PortValue uint32 `json:"port_value"`
+						} `json:"socket_address"`
+					} `json:"address"`
+				} `json:"failed_configuration"`
+				LastUpdateAttempt time.Time `json:"last_update_attempt"`
+				Details           string    `json:"details"`
+			} `json:"error_state"`
+		}{}
+		if err := json.Unmarshal(raw, &dynamic); err != nil {
+			return nil, fmt.Errorf("failed parsing listeners of %s.%s: %v", podName, podNamespace, err)
+		}
+		if dynamic.ErrorState == nil {
+			continue
+		}
+		listenerErr := ListenerError{
+			Name:              dynamic.Name,
+			Details:           dynamic.ErrorState.Details,
+			LastUpdateAttempt: dynamic.ErrorState.LastUpdateAttempt,
+		}
+		if address := dynamic.ErrorState.FailedConfiguration.Address.SocketAddress; address.Address != "" {
+			listenerErr.Address = net.JoinHostPort(address.Address, strconv.Itoa(int(address.PortValue)))
+		}
+		errs = append(errs, listenerErr)
+	}
+	return errs, nil
+}
+
+func (c *client) GetProxyRoutes(ctx context.Context, podName, podNamespace string) ([]*routev3.RouteConfiguration, error) {
+	resources, err := c.getEnvoyConfigDumpResources(ctx, podName, podNamespace, "dynamic_route_configs")
+	if err != nil {
+		return nil, err
+	}
+	routes := make([]*routev3.RouteConfiguration, 0, len(resources))
+	for _, raw := range resources {
+		dynamic := struct {
+			RouteConfig json.RawMessage `json:"route_config"`
+		}{}
+		if err := json.Unmarshal(raw, &dynamic); err != nil {
+			return nil, fmt.Errorf("failed parsing routes of %s.%s: %v", podName, podNamespace, err)
+		}
+		route := &routev3.RouteConfiguration{}
+		if err := unmarshalEnvoyJSON(dynamic.RouteConfig, route); err != nil {
+			return nil, fmt.Errorf("failed parsing routes of %s.%s: %v", podName, podNamespace, err)
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func (c *client) GetAllProxyConfigDumps(ctx context.Context, namespace string) (map[string][]byte, error) {
+	injected, err := c.listInjectedPods(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	out := map[string][]byte{}
+	var mu sync.Mutex
+	var errs error
+	forEachConcurrently(len(injected), defaultConcurrency, func(i int) {
+		pod := injected[i]
+		dump, err := c.EnvoyDo(ctx, pod.Name, pod.Namespace, "GET", "config_dump", nil)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed getting config dump of %s/%s: %v", pod.Namespace, pod.Name, err))
+			return
+		}
+		out[pod.Namespace+"/"+pod.Name] = dump
+	})
+	return out, errs
+}
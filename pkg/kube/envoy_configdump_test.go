@@ -0,0 +1,265 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+)
+
+// withFakeConfigDump serves the config_dump.json fixture from the admin port of the pod.
+func withFakeConfigDump(t *testing.T, c *client, pod string) {
+	t.Helper()
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		pod: envoyResponse("/config_dump", string(readFixture(t, "config_dump.json"))),
+	})
+}
+
+func TestGetProxyInboundCluster(t *testing.T) {
+	c := newFakeClient()
+	withFakeConfigDump(t, c, "productpage")
+
+	cluster, err := c.GetProxyInboundCluster(context.Background(), "default", "productpage", 9080)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster.Name != "inbound|9080|http|productpage.default.svc.cluster.local" {
+		t.Fatalf("unexpected cluster %s", cluster.Name)
+	}
+	if cluster.GetType() != clusterv3.Cluster_STATIC || cluster.GetConnectTimeout().AsDuration() != 10*time.Second {
+		t.Fatalf("unexpected cluster config: %v", cluster)
+	}
+	if got := cluster.GetLoadAssignment().GetEndpoints()[0].GetLbEndpoints()[0].GetEndpoint().GetAddress().
+		GetSocketAddress().GetPortValue(); got != 9080 {
+		t.Fatalf("unexpected endpoint port %d", got)
+	}
+
+	if _, err := c.GetProxyInboundCluster(context.Background(), "default", "productpage", 8080); err == nil {
+		t.Fatal("expected error for port without inbound cluster")
+	}
+}
+
+// configDumpResourceHandler serves a fixture for each resource requested from /config_dump.
+func configDumpResourceHandler(t *testing.T, fixtures map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fixture, ok := fixtures[r.URL.Query().Get("resource")]
+		if r.URL.Path != "/config_dump" || !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(readFixture(t, fixture))
+	})
+}
+
+func TestResolveProxyCluster(t *testing.T) {
+	c := newFakeClient()
+	withFakeConfigDump(t, c, "productpage")
+
+	cases := []struct {
+		fqdn      string
+		port      int
+		wantName  string
+		wantFound bool
+	}{
+		{"reviews.default.svc.cluster.local", 9080, "outbound|9080||reviews.default.svc.cluster.local", true},
+		{"reviews.default.svc.cluster.local.", 9080, "outbound|9080||reviews.default.svc.cluster.local", true},
+		{"reviews.default.svc.cluster.local", 8080, "", false},
+		{"productpage.default.svc.cluster.local", 9080, "", false},
+	}
+	for _, tt := range cases {
+		name, found, err := c.ResolveProxyCluster(context.Background(), "productpage", "default", tt.fqdn, tt.port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != tt.wantName || found != tt.wantFound {
+			t.Fatalf("%s:%d: got %q %v, want %q %v", tt.fqdn, tt.port, name, found, tt.wantName, tt.wantFound)
+		}
+	}
+}
+
+func TestGetProxyListeners(t *testing.T) {
+	c := newFakeClient()
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"productpage": configDumpResourceHandler(t, map[string]string{"dynamic_listeners": "config_dump_listeners.json"}),
+	})
+
+	listeners, err := c.GetProxyListeners(context.Background(), "productpage", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, l := range listeners {
+		names = append(names, l.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"virtualOutbound", "10.44.0.11_9080"}) {
+		t.Fatalf("unexpected listeners %v", names)
+	}
+	if port := listeners[1].GetAddress().GetSocketAddress().GetPortValue(); port != 9080 {
+		t.Fatalf("unexpected listener port %d", port)
+	}
+}
+
+func TestGetProxyListenerErrors(t *testing.T) {
+	c := newFakeClient()
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"productpage": configDumpResourceHandler(t, map[string]string{"dynamic_listeners": "config_dump_listeners.json"}),
+	})
+
+	got, err := c.GetProxyListenerErrors(context.Background(), "productpage", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ListenerError{{
+		Name:              "0.0.0.0_15001",
+		Address:           "0.0.0.0:15001",
+		Details:           "error adding listener: '0.0.0.0_15001' has duplicate address '0.0.0.0:15001' as existing listener",
+		LastUpdateAttempt: time.Date(2020, 9, 1, 0, 5, 0, 0, time.UTC),
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestGetProxyRoutes(t *testing.T) {
+	c := newFakeClient()
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"productpage": configDumpResourceHandler(t, map[string]string{"dynamic_route_configs": "config_dump_routes.json"}),
+	})
+
+	routes, err := c.GetProxyRoutes(context.Background(), "productpage", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 || routes[0].Name != "9080" {
+		t.Fatalf("unexpected routes %v", routes)
+	}
+	if got := routes[0].GetVirtualHosts()[0].GetRoutes()[0].GetRoute().GetCluster(); got != "outbound|9080||reviews.default.svc.cluster.local" {
+		t.Fatalf("unexpected route cluster %s", got)
+	}
+}
+
+func TestGetProxyBootstrap(t *testing.T) {
+	var requests []string
+	bootstrapOnly := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.URL.RequestURI())
+			if r.URL.Path != "/config_dump" || r.URL.Query().Get("mask") != "bootstrap" {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write([]byte(body))
+		})
+	}
+	c := newFakeClient()
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"productpage": bootstrapOnly(string(readFixture(t, "config_dump_bootstrap.json"))),
+		"empty":       bootstrapOnly(`{"configs": []}`),
+	})
+
+	out, err := c.GetProxyBootstrap(context.Background(), "productpage", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bootstrap := struct {
+		Node struct {
+			ID string `json:"id"`
+		} `json:"node"`
+		Admin json.RawMessage `json:"admin"`
+	}{}
+	if err := json.Unmarshal(out, &bootstrap); err != nil {
+		t.Fatalf("got invalid bootstrap %s: %v", out, err)
+	}
+	if want := "sidecar~10.44.0.11~productpage-v1-7f44c4d57c-7hxsb.default~default.svc.cluster.local"; bootstrap.Node.ID != want {
+		t.Fatalf("got node %q, want %q", bootstrap.Node.ID, want)
+	}
+	if len(bootstrap.Admin) == 0 {
+		t.Fatalf("got bootstrap without admin: %s", out)
+	}
+
+	if _, err := c.GetProxyBootstrap(context.Background(), "empty", "default"); err == nil {
+		t.Fatal("expected an error for a config dump without bootstrap")
+	}
+	if want := []string{"/config_dump?mask=bootstrap", "/config_dump?mask=bootstrap"}; !reflect.DeepEqual(requests, want) {
+		t.Fatalf("got requests %q, want only the bootstrap %q", requests, want)
+	}
+}
+
+func TestGetProxyConfigDumpFiltered(t *testing.T) {
+	var rawQueries []string
+	c := newFakeClient()
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"productpage": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rawQueries = append(rawQueries, r.URL.RawQuery)
+			_, _ = w.Write([]byte(`{"configs": []}`))
+		}),
+	})
+
+	cases := []struct {
+		resourceType string
+		nameRegex    string
+		want         string
+	}{
+		{want: ""},
+		{resourceType: "dynamic_active_clusters", want: "resource=dynamic_active_clusters"},
+		{
+			resourceType: "dynamic_active_clusters",
+			nameRegex:    `outbound\|9080\|.*\.default\.svc\.cluster\.local&x=1`,
+			want: "name_regex=outbound%5C%7C9080%5C%7C.%2A%5C.default%5C.svc%5C.cluster%5C.local%26x%3D1" +
+				"&resource=dynamic_active_clusters",
+		},
+	}
+	for _, tt := range cases {
+		rawQueries = nil
+		out, err := c.GetProxyConfigDumpFiltered(context.Background(), "productpage", "default", tt.resourceType, tt.nameRegex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != `{"configs": []}` {
+			t.Fatalf("got %q, want the config dump", out)
+		}
+		if !reflect.DeepEqual(rawQueries, []string{tt.want}) {
+			t.Fatalf("got queries %q, want %q", rawQueries, tt.want)
+		}
+	}
+}
+
+func TestGetAllProxyConfigDumps(t *testing.T) {
+	uninjected := injectedPod("legacy", "default")
+	uninjected.Spec.Containers = uninjected.Spec.Containers[:1]
+	c := newFakeClient(injectedPod("productpage", "default"), injectedPod("reviews", "default"), uninjected)
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"productpage": envoyResponse("/config_dump", `{"configs": ["productpage"]}`),
+		"reviews":     envoyResponse("/config_dump", `{"configs": ["reviews"]}`),
+		"legacy":      http.NotFoundHandler(),
+	})
+
+	dumps, err := c.GetAllProxyConfigDumps(context.Background(), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]byte{
+		"default/productpage": []byte(`{"configs": ["productpage"]}`),
+		"default/reviews":     []byte(`{"configs": ["reviews"]}`),
+	}
+	if !reflect.DeepEqual(dumps, want) {
+		t.Fatalf("got config dumps %q, want %q", dumps, want)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	listenersConfigDumpType = "type.googleapis.com/envoy.admin.v3.ListenersConfigDump"
+	routesConfigDumpType    = "type.googleapis.com/envoy.admin.v3.RoutesConfigDump"
+
+	// nackedClientStatus is the client_status of the resources rejected by Envoy.
+	nackedClientStatus = "NACKED"
+)
+
+// ConfigStatus is the state of the configuration received by a proxy over CDS, LDS and RDS.
+type ConfigStatus struct {
+	Clusters  XDSStatus
+	Listeners XDSStatus
+	Routes    XDSStatus
+}
+
+// XDSStatus is the state of the configuration of a single xDS type.
+type XDSStatus struct {
+	// Version is the version of the last configuration accepted (ACKed) by the proxy.
+	Version string
+	// LastUpdated is the time the proxy last accepted a resource of this type. It is zero if no
+	// dynamic resource was accepted.
+	LastUpdated time.Time
+	// Rejected are the resources the proxy rejected (NACKed) since.
+	Rejected []RejectedResource
+}
+
+// RejectedResource is a resource update rejected by a proxy.
+type RejectedResource struct {
+	Name string
+	// Version is the version of the rejected configuration.
+	Version string
+	// Details is the error reported by Envoy.
+	Details           string
+	LastUpdateAttempt time.Time
+}
+
+// dynamicResourceStatus holds the fields common to the dynamic resources of the config dump sections.
+// DynamicListener nests its version under active_state.
+type dynamicResourceStatus struct {
+	Name         string    `json:"name"`
+	VersionInfo  string    `json:"version_info"`
+	LastUpdated  time.Time `json:"last_updated"`
+	ClientStatus string    `json:"client_status"`
+	ActiveState  *struct {
+		VersionInfo string    `json:"version_info"`
+		LastUpdated time.Time `json:"last_updated"`
+	} `json:"active_state"`
+	ErrorState *struct {
+		VersionInfo       string    `json:"version_info"`
+		LastUpdateAttempt time.Time `json:"last_update_attempt"`
+		Details           string    `json:"details"`
+	} `json:"error_state"`
+	// Older Envoy versions only report the name in the resource itself.
+	Cluster     *struct{ Name string } `json:"cluster"`
+	RouteConfig *struct{ Name string } `json:"route_config"`
+}
+
+func (r *dynamicResourceStatus) name() string {
+	switch {
+	case r.Name != "":
+		return r.Name
+	case r.Cluster != nil:
+		return r.Cluster.Name
+	case r.RouteConfig != nil:
+		return r.RouteConfig.Name
+	}
+	return ""
+}
+
+func (c *client) GetProxyConfigStatus(ctx context.Context, podName, podNamespace string) (*ConfigStatus, error) {
+	out, err := c.EnvoyDo(ctx, podName, podNamespace, "GET", "config_dump", nil)
+	if err != nil {
+		return nil, err
+	}
+	dump := struct {
+		Configs []json.RawMessage `json:"configs"`
+	}{}
+	if err := json.Unmarshal(out, &dump); err != nil {
+		return nil, fmt.Errorf("failed parsing config dump of %s.%s: %v", podName, podNamespace, err)
+	}
+	status := &ConfigStatus{}
+	for _, raw := range dump.Configs {
+		section := struct {
+			Type                   string                  `json:"@type"`
+			VersionInfo            string                  `json:"version_info"`
+			DynamicActiveClusters  []dynamicResourceStatus `json:"dynamic_active_clusters"`
+			DynamicWarmingClusters []dynamicResourceStatus `json:"dynamic_warming_clusters"`
+			DynamicListeners       []dynamicResourceStatus `json:"dynamic_listeners"`
+			DynamicRouteConfigs    []dynamicResourceStatus `json:"dynamic_route_configs"`
+		}{}
+		if err := json.Unmarshal(raw, &section); err != nil {
+			return nil, fmt.Errorf("failed parsing config dump of %s.%s: %v", podName, podNamespace, err)
+		}
+		switch section.Type {
+		case clustersConfigDumpType:
+			status.Clusters = xdsStatus(section.VersionInfo,
+				append(section.DynamicActiveClusters, section.DynamicWarmingClusters...))
+		case listenersConfigDumpType:
+			status.Listeners = xdsStatus(section.VersionInfo, section.DynamicListeners)
+		case routesConfigDumpType:
+			status.Routes = xdsStatus(section.VersionInfo, section.DynamicRouteConfigs)
+		}
+	}
+	return status, nil
+}
+
+// xdsStatus summarizes the dynamic resources of a config dump section. Sections without a version of their
+// own, such as routes, report the version of the most recently updated resource.
+func xdsStatus(version string, resources []dynamicResourceStatus) XDSStatus {
+	status := XDSStatus{Version: version}
+	for i := range resources {
+		r := &resources[i]
+		lastUpdated, resourceVersion := r.LastUpdated, r.VersionInfo
+		if r.ActiveState != nil {
+			lastUpdated, resourceVersion = r.ActiveState.LastUpdated, r.ActiveState.VersionInfo
+		}
+		if lastUpdated.After(status.LastUpdated) {
+			status.LastUpdated = lastUpdated
+			if version == "" && resourceVersion != "" {
+				status.Version = resourceVersion
+			}
+		}
+		if r.ErrorState == nil && r.ClientStatus != nackedClientStatus {
+			continue
+		}
+		rejected := RejectedResource{Name: r.name()}
+		if r.ErrorState != nil {
+			rejected.Version = r.ErrorState.VersionInfo
+			rejected.Details = r.ErrorState.Details
+			rejected.LastUpdateAttempt = r.ErrorState.LastUpdateAttempt
+		}
+		status.Rejected = append(status.Rejected, rejected)
+	}
+	return status
+}
@@ -0,0 +1,60 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetProxyConfigStatus(t *testing.T) {
+	c := newFakeClient()
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"productpage": envoyResponse("/config_dump", string(readFixture(t, "config_dump_status.json"))),
+	})
+
+	got, err := c.GetProxyConfigStatus(context.Background(), "productpage", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ConfigStatus{
+		Clusters: XDSStatus{
+			Version:     "2020-09-01T00:00:00Z/7",
+			LastUpdated: time.Date(2020, 9, 1, 0, 1, 0, 0, time.UTC),
+			Rejected: []RejectedResource{{
+				Name:    "outbound|9080||ratings.default.svc.cluster.local",
+				Version: "2020-09-01T00:05:00Z/8",
+				Details: "Proto constraint validation failed (ClusterValidationError.LbPolicy: " +
+					"value must be one of the defined enum values)",
+				LastUpdateAttempt: time.Date(2020, 9, 1, 0, 5, 0, 0, time.UTC),
+			}},
+		},
+		Listeners: XDSStatus{
+			Version:     "2020-09-01T00:00:00Z/7",
+			LastUpdated: time.Date(2020, 9, 1, 0, 0, 30, 0, time.UTC),
+		},
+		Routes: XDSStatus{
+			// The routes section has no version of its own: the most recently updated route wins.
+			Version:     "2020-09-01T00:00:00Z/7",
+			LastUpdated: time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
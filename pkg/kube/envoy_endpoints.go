@@ -0,0 +1,140 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+const endpointsConfigDumpType = "type.googleapis.com/envoy.admin.v3.EndpointsConfigDump"
+
+// envoyEndpointsConfigDump is the subset of the Envoy config dump with EDS used by this package.
+type envoyEndpointsConfigDump struct {
+	Configs []struct {
+		Type                   string                      `json:"@type"`
+		StaticEndpointConfigs  []envoyEndpointConfigStatus `json:"static_endpoint_configs"`
+		DynamicEndpointConfigs []envoyEndpointConfigStatus `json:"dynamic_endpoint_configs"`
+	} `json:"configs"`
+}
+
+type envoyEndpointConfigStatus struct {
+	EndpointConfig envoyClusterLoadAssignment `json:"endpoint_config"`
+}
+
+type envoyClusterLoadAssignment struct {
+	ClusterName string `json:"cluster_name"`
+	Endpoints   []struct {
+		Locality struct {
+			Region  string `json:"region"`
+			Zone    string `json:"zone"`
+			SubZone string `json:"sub_zone"`
+		} `json:"locality"`
+		LoadBalancingWeight *uint32 `json:"load_balancing_weight"`
+		Priority            uint32  `json:"priority"`
+		LbEndpoints         []struct {
+			Endpoint struct {
+				Address struct {
+					SocketAddress struct {
+						Address   string `json:"address"`
+						PortValue uint32 `json:"port_value"`
+					} `json:"socket_address"`
+				} `json:"address"`
+			} `json:"endpoint"`
+			HealthStatus        string  `json:"health_status"`
+			LoadBalancingWeight *uint32 `json:"load_balancing_weight"`
+		} `json:"lb_endpoints"`
+	} `json:"endpoints"`
+}
+
+// getEnvoyLoadAssignments returns the load assignments of all the clusters of the proxy, keyed by cluster name.
+func (c *client) getEnvoyLoadAssignments(ctx context.Context, podName, podNamespace string) (map[string]envoyClusterLoadAssignment, error) {
+	out, err := c.EnvoyDo(ctx, podName, podNamespace, "GET", "config_dump?include_eds", nil)
+	if err != nil {
+		return nil, err
+	}
+	dump := &envoyEndpointsConfigDump{}
+	if err := json.Unmarshal(out, dump); err != nil {
+		return nil, fmt.Errorf("failed parsing config dump of %s.%s: %v", podName, podNamespace, err)
+	}
+	assignments := map[string]envoyClusterLoadAssignment{}
+	for _, config := range dump.Configs {
+		if config.Type != endpointsConfigDumpType {
+			continue
+		}
+		for _, statuses := range [][]envoyEndpointConfigStatus{config.StaticEndpointConfigs, config.DynamicEndpointConfigs} {
+			for _, status := range statuses {
+				assignments[status.EndpointConfig.ClusterName] = status.EndpointConfig
+			}
+		}
+	}
+	return assignments, nil
+}
+
+// EndpointWeight is the load balancing configuration of an endpoint of an Envoy cluster.
+type EndpointWeight struct {
+	// Address of the endpoint, as "host:port".
+	Address  string
+	Locality Locality
+	// Priority of the locality of the endpoint. Lower values are preferred.
+	Priority uint32
+	// LocalityWeight is the weight of the locality of the endpoint, or 0 if locality weighted load balancing is off.
+	LocalityWeight uint32
+	// Weight of the endpoint within its locality.
+	Weight       uint32
+	HealthStatus string
+}
+
+func (c *client) GetProxyLoadBalancingWeights(ctx context.Context, namespace, podName, cluster string) ([]EndpointWeight, error) {
+	assignments, err := c.getEnvoyLoadAssignments(ctx, podName, namespace)
+	if err != nil {
+		return nil, err
+	}
+	assignment, ok := assignments[cluster]
+	if !ok {
+		return nil, fmt.Errorf("proxy %s.%s has no endpoints for cluster %s", podName, namespace, cluster)
+	}
+	var weights []EndpointWeight
+	for _, locality := range assignment.Endpoints {
+		var localityWeight uint32
+		if locality.LoadBalancingWeight != nil {
+			localityWeight = *locality.LoadBalancingWeight
+		}
+		for _, ep := range locality.LbEndpoints {
+			// Envoy defaults the weight of endpoints to 1.
+			weight := uint32(1)
+			if ep.LoadBalancingWeight != nil {
+				weight = *ep.LoadBalancingWeight
+			}
+			address := ep.Endpoint.Address.SocketAddress
+			weights = append(weights, EndpointWeight{
+				Address: net.JoinHostPort(address.Address, strconv.Itoa(int(address.PortValue))),
+				Locality: Locality{
+					Region:  locality.Locality.Region,
+					Zone:    locality.Locality.Zone,
+					Subzone: locality.Locality.SubZone,
+				},
+				Priority:       locality.Priority,
+				LocalityWeight: localityWeight,
+				Weight:         weight,
+				HealthStatus:   ep.HealthStatus,
+			})
+		}
+	}
+	return weights, nil
+}
@@ -0,0 +1,62 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestGetProxyLoadBalancingWeights(t *testing.T) {
+	c := newFakeClient()
+	var query string
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"productpage": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.RawQuery
+			_, _ = w.Write(readFixture(t, "config_dump_eds.json"))
+		}),
+	})
+
+	got, err := c.GetProxyLoadBalancingWeights(context.Background(), "default", "productpage",
+		"outbound|9080||reviews.default.svc.cluster.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "include_eds" {
+		t.Fatalf("config dump requested without EDS: %q", query)
+	}
+	east := Locality{Region: "us-east1", Zone: "us-east1-b"}
+	want := []EndpointWeight{
+		{Address: "10.44.0.12:9080", Locality: east, LocalityWeight: 3, Weight: 80, HealthStatus: "HEALTHY"},
+		{Address: "10.44.0.13:9080", Locality: east, LocalityWeight: 3, Weight: 20, HealthStatus: "UNHEALTHY"},
+		{
+			Address:        "10.48.0.7:9080",
+			Locality:       Locality{Region: "us-west1", Zone: "us-west1-a", Subzone: "rack-1"},
+			Priority:       1,
+			LocalityWeight: 1,
+			Weight:         1,
+			HealthStatus:   "HEALTHY",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	if _, err := c.GetProxyLoadBalancingWeights(context.Background(), "default", "productpage", "missing"); err == nil {
+		t.Fatal("expected error for unknown cluster")
+	}
+}
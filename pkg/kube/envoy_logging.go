@@ -0,0 +1,83 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// proxyLogLevels are the log levels accepted by Envoy.
+var proxyLogLevels = map[string]bool{
+	"trace":    true,
+	"debug":    true,
+	"info":     true,
+	"warning":  true,
+	"error":    true,
+	"critical": true,
+	"off":      true,
+}
+
+// parseProxyLogLevels parses the loggers listed by the Envoy /logging endpoint, such as:
+//
+//	active loggers:
+//	  admin: info
+//	  upstream: debug
+func parseProxyLogLevels(out []byte) (map[string]string, error) {
+	levels := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line == "active loggers:" {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("unexpected logger %q", line)
+		}
+		levels[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return levels, scanner.Err()
+}
+
+func (c *client) GetProxyLogLevels(ctx context.Context, podName, podNamespace string) (map[string]string, error) {
+	// The /logging endpoint changes the state of Envoy, so it only accepts POST requests, even without
+	// parameters.
+	out, err := c.envoyPost(ctx, podName, podNamespace, "logging")
+	if err != nil {
+		return nil, err
+	}
+	levels, err := parseProxyLogLevels(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing log levels of %s.%s: %v", podName, podNamespace, err)
+	}
+	return levels, nil
+}
+
+func (c *client) SetProxyLogLevel(ctx context.Context, podName, podNamespace, logger, level string) error {
+	if !proxyLogLevels[level] {
+		return fmt.Errorf("invalid log level %q, must be one of trace, debug, info, warning, error, critical or off",
+			level)
+	}
+	if logger == "" {
+		logger = "level"
+	}
+	_, err := c.envoyPost(ctx, podName, podNamespace, "logging?"+url.Values{logger: {level}}.Encode())
+	return err
+}
@@ -0,0 +1,96 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeLoggingHandler serves the Envoy /logging endpoint for the admin and upstream loggers.
+func fakeLoggingHandler(t *testing.T) http.Handler {
+	levels := map[string]string{"admin": "info", "upstream": "info"}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/logging" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		for logger, level := range r.URL.Query() {
+			if logger == "level" {
+				for name := range levels {
+					levels[name] = level[0]
+				}
+				continue
+			}
+			if _, ok := levels[logger]; !ok {
+				http.Error(w, "error: unknown logger name", http.StatusNotFound)
+				return
+			}
+			levels[logger] = level[0]
+		}
+		names := make([]string, 0, len(levels))
+		for name := range levels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		out := &strings.Builder{}
+		out.WriteString("active loggers:\n")
+		for _, name := range names {
+			fmt.Fprintf(out, "  %s: %s\n", name, levels[name])
+		}
+		_, _ = w.Write([]byte(out.String()))
+	})
+}
+
+func TestProxyLogLevels(t *testing.T) {
+	c := newFakeClient()
+	withFakeEnvoys(t, c, map[string]http.Handler{"productpage": fakeLoggingHandler(t)})
+	ctx := context.Background()
+
+	assertLevels := func(want map[string]string) {
+		t.Helper()
+		got, err := c.GetProxyLogLevels(ctx, "productpage", "default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("got log levels %v, want %v", got, want)
+		}
+	}
+
+	assertLevels(map[string]string{"admin": "info", "upstream": "info"})
+	if err := c.SetProxyLogLevel(ctx, "productpage", "default", "upstream", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	assertLevels(map[string]string{"admin": "info", "upstream": "debug"})
+	if err := c.SetProxyLogLevel(ctx, "productpage", "default", "", "warning"); err != nil {
+		t.Fatal(err)
+	}
+	assertLevels(map[string]string{"admin": "warning", "upstream": "warning"})
+
+	if err := c.SetProxyLogLevel(ctx, "productpage", "default", "upstream", "verbose"); err == nil {
+		t.Fatal("expected an error for an invalid level")
+	}
+	if err := c.SetProxyLogLevel(ctx, "productpage", "default", "missing", "debug"); err == nil {
+		t.Fatal("expected an error for an unknown logger")
+	}
+	assertLevels(map[string]string{"admin": "warning", "upstream": "warning"})
+}
@@ -0,0 +1,66 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// envoyMemory is the Envoy /memory response. The protobuf JSON encoding of uint64 values is a string.
+type envoyMemory struct {
+	Allocated          uint64 `json:"allocated,string"`
+	HeapSize           uint64 `json:"heap_size,string"`
+	PageheapUnmapped   uint64 `json:"pageheap_unmapped,string"`
+	PageheapFree       uint64 `json:"pageheap_free,string"`
+	TotalThreadCache   uint64 `json:"total_thread_cache,string"`
+	TotalPhysicalBytes uint64 `json:"total_physical_bytes,string"`
+}
+
+// MemoryStats are the memory allocation statistics of the Envoy of a proxy, in bytes.
+type MemoryStats struct {
+	// Allocated is the memory currently allocated by Envoy.
+	Allocated uint64
+	// HeapSize is the size of the heap reserved by the allocator, including its free and unmapped pages.
+	HeapSize uint64
+	// PageheapUnmapped is the memory of the heap which was released to the operating system.
+	PageheapUnmapped uint64
+	// PageheapFree is the memory of the heap which is free but still mapped.
+	PageheapFree uint64
+	// TotalThreadCache is the memory held by the caches of the threads.
+	TotalThreadCache uint64
+	// TotalPhysicalBytes is the physical memory used by the allocator.
+	TotalPhysicalBytes uint64
+}
+
+func (c *client) GetProxyMemory(ctx context.Context, podName, podNamespace string) (*MemoryStats, error) {
+	out, err := c.EnvoyDo(ctx, podName, podNamespace, "GET", "memory", nil)
+	if err != nil {
+		return nil, err
+	}
+	memory := envoyMemory{}
+	if err := json.Unmarshal(out, &memory); err != nil {
+		return nil, fmt.Errorf("failed parsing memory of %s.%s: %v", podName, podNamespace, err)
+	}
+	return &MemoryStats{
+		Allocated:          memory.Allocated,
+		HeapSize:           memory.HeapSize,
+		PageheapUnmapped:   memory.PageheapUnmapped,
+		PageheapFree:       memory.PageheapFree,
+		TotalThreadCache:   memory.TotalThreadCache,
+		TotalPhysicalBytes: memory.TotalPhysicalBytes,
+	}, nil
+}
@@ -0,0 +1,50 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestGetProxyMemory(t *testing.T) {
+	c := newFakeClient()
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"productpage": envoyResponse("/memory", string(readFixture(t, "memory.json"))),
+		"invalid":     envoyResponse("/memory", `{"allocated": "lots"}`),
+	})
+
+	got, err := c.GetProxyMemory(context.Background(), "productpage", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &MemoryStats{
+		Allocated:          6981136,
+		HeapSize:           14680064,
+		PageheapUnmapped:   458752,
+		PageheapFree:       1540096,
+		TotalThreadCache:   1983944,
+		TotalPhysicalBytes: 16678912,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	if _, err := c.GetProxyMemory(context.Background(), "invalid", "default"); err == nil {
+		t.Fatal("expected an error for an invalid response")
+	}
+}
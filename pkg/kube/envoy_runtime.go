@@ -0,0 +1,48 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// envoyRuntime is the Envoy /runtime response.
+type envoyRuntime struct {
+	// Layers are the names of the runtime layers, lowest priority first.
+	Layers  []string `json:"layers"`
+	Entries map[string]struct {
+		// LayerValues holds the value of the key in every layer, empty if the layer doesn't set it.
+		LayerValues []string `json:"layer_values"`
+		FinalValue  string   `json:"final_value"`
+	} `json:"entries"`
+}
+
+func (c *client) GetProxyRuntime(ctx context.Context, podName, podNamespace string) (map[string]string, error) {
+	out, err := c.EnvoyDo(ctx, podName, podNamespace, "GET", "runtime", nil)
+	if err != nil {
+		return nil, err
+	}
+	rt := envoyRuntime{}
+	if err := json.Unmarshal(out, &rt); err != nil {
+		return nil, fmt.Errorf("failed parsing runtime of %s.%s: %v", podName, podNamespace, err)
+	}
+	values := make(map[string]string, len(rt.Entries))
+	for key, entry := range rt.Entries {
+		values[key] = entry.FinalValue
+	}
+	return values, nil
+}
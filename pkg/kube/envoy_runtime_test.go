@@ -0,0 +1,43 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestGetProxyRuntime(t *testing.T) {
+	c := newFakeClient()
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"productpage": envoyResponse("/runtime", string(readFixture(t, "runtime.json"))),
+	})
+
+	got, err := c.GetProxyRuntime(context.Background(), "productpage", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The admin layer overrides the global config layer.
+	want := map[string]string{
+		"envoy.reloadable_features.strict_1xx_and_204_response_headers": "false",
+		"overload.global_downstream_max_connections":                    "50000",
+		"re2.max_program_size.error_level":                              "1024",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got runtime %v, want %v", got, want)
+	}
+}
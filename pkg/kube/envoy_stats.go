@@ -0,0 +1,120 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+func (c *client) GetProxyStats(ctx context.Context, podName, podNamespace string, filter string,
+	opts ...ProxyStatsOption) (map[string]float64, error) {
+	options := newProxyStatsOptions(opts)
+	path := "stats"
+	if options.prometheus {
+		path = "stats/prometheus"
+	}
+	var params []string
+	if options.usedOnly {
+		params = append(params, "usedonly")
+	}
+	if filter != "" {
+		params = append(params, "filter="+url.QueryEscape(filter))
+	}
+	if len(params) > 0 {
+		path += "?" + strings.Join(params, "&")
+	}
+	out, err := c.EnvoyDo(ctx, podName, podNamespace, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := parseProxyStats(string(out), options.prometheus)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing stats of %s.%s: %v", podName, podNamespace, err)
+	}
+	return stats, nil
+}
+
+// parseProxyStats parses the output of the Envoy /stats endpoint, in the Prometheus format if prometheus
+// is set or else in the default "name: value" text format. Histograms in the text format are skipped, as they
+// have no single value. Prometheus metrics are keyed by their name followed by their labels, as printed by Envoy.
+func parseProxyStats(body string, prometheus bool) (map[string]float64, error) {
+	stats := map[string]float64{}
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var name, value string
+		if prometheus {
+			// The value follows the labels, whose values may contain spaces.
+			split := strings.LastIndex(line, "}") + 1
+			if split == 0 {
+				split = strings.Index(line, " ")
+			}
+			if split <= 0 {
+				return nil, fmt.Errorf("invalid metric %q", line)
+			}
+			fields := strings.Fields(line[split:])
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("metric %q has no value", line)
+			}
+			name, value = line[:split], fields[0]
+		} else {
+			split := strings.Index(line, ": ")
+			if split < 0 {
+				return nil, fmt.Errorf("invalid stat %q", line)
+			}
+			name, value = line[:split], line[split+2:]
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			if prometheus {
+				return nil, fmt.Errorf("invalid value of metric %q: %v", name, err)
+			}
+			// Histograms, such as "P0(nan,1) P25(nan,1.025) ...".
+			continue
+		}
+		stats[name] = v
+	}
+	return stats, nil
+}
+
+// connectionStatsFilter selects the active connections of the listeners and clusters of the proxy.
+const connectionStatsFilter = `^(listener\..*\.downstream_cx_active|cluster\..*\.upstream_cx_active)$`
+
+func (c *client) GetProxyConnections(ctx context.Context, podName, podNamespace string) (int64, int64, error) {
+	stats, err := c.GetProxyStats(ctx, podName, podNamespace, connectionStatsFilter)
+	if err != nil {
+		return 0, 0, err
+	}
+	var downstream, upstream int64
+	for name, value := range stats {
+		switch {
+		case strings.HasPrefix(name, "cluster."):
+			upstream += int64(value)
+		case strings.HasPrefix(name, "listener.admin."):
+			// Connections to the admin, such as this request.
+		case strings.Contains(name, ".worker_"):
+			// The connections of each worker thread, already counted by their listener.
+		default:
+			downstream += int64(value)
+		}
+	}
+	return downstream, upstream, nil
+}
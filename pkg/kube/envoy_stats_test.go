@@ -0,0 +1,154 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// statsHandler serves the stats fixture, applying the filter query parameter like Envoy does.
+func statsHandler(t *testing.T, fixture string) http.Handler {
+	stats := string(readFixture(t, fixture))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter, err := regexp.Compile(r.URL.Query().Get("filter"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, line := range strings.Split(stats, "\n") {
+			if filter.MatchString(strings.SplitN(line, ":", 2)[0]) {
+				_, _ = w.Write([]byte(line + "\n"))
+			}
+		}
+	})
+}
+
+func TestGetProxyStats(t *testing.T) {
+	c := newFakeClient()
+	withFakeEnvoys(t, c, map[string]http.Handler{"productpage": statsHandler(t, "stats.txt")})
+
+	got, err := c.GetProxyStats(context.Background(), "productpage", "default", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 6 || got["server.uptime"] != 3600 || got["listener_manager.total_listeners_active"] != 25 {
+		t.Fatalf("unexpected stats: %v", got)
+	}
+
+	got, err = c.GetProxyStats(context.Background(), "productpage", "default", `upstream_cx_(active|total)$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{
+		"cluster.outbound|9080||reviews.default.svc.cluster.local.upstream_cx_active": 2,
+		"cluster.outbound|9080||reviews.default.svc.cluster.local.upstream_cx_total":  17,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestGetProxyStatsOptions(t *testing.T) {
+	var requests []string
+	prometheus := readFixture(t, "stats_prometheus.txt")
+	c := newFakeClient()
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"productpage": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.URL.RequestURI())
+			if r.URL.Path == "/stats/prometheus" {
+				_, _ = w.Write(prometheus)
+				return
+			}
+			_, _ = w.Write([]byte("server.live: 1\n"))
+		}),
+	})
+
+	got, err := c.GetProxyStats(context.Background(), "productpage", "default", "", WithPrometheusFormat())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 6 || got[`envoy_server_live{}`] != 1 {
+		t.Fatalf("unexpected Prometheus stats: %v", got)
+	}
+	got, err = c.GetProxyStats(context.Background(), "productpage", "default", "server", WithUsedOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, map[string]float64{"server.live": 1}) {
+		t.Fatalf("unexpected stats: %v", got)
+	}
+	if _, err := c.GetProxyStats(context.Background(), "productpage", "default", "cx_active",
+		WithPrometheusFormat(), WithUsedOnly()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/stats/prometheus", "/stats?usedonly&filter=server", "/stats/prometheus?usedonly&filter=cx_active"}
+	if !reflect.DeepEqual(requests, want) {
+		t.Fatalf("got requests %q, want %q", requests, want)
+	}
+}
+
+func TestGetProxyConnections(t *testing.T) {
+	c := newFakeClient()
+	withFakeEnvoys(t, c, map[string]http.Handler{"productpage": statsHandler(t, "stats_connections.txt")})
+
+	downstream, upstream, err := c.GetProxyConnections(context.Background(), "productpage", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The admin listener, per-worker and HTTP connection manager stats are not counted.
+	if downstream != 9 || upstream != 6 {
+		t.Fatalf("got %d downstream and %d upstream connections, want 9 and 6", downstream, upstream)
+	}
+}
+
+func TestParseProxyStatsPrometheus(t *testing.T) {
+	body := string(readFixture(t, "stats_prometheus.txt"))
+	got, err := parseProxyStats(body, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{
+		`envoy_cluster_upstream_cx_active{cluster_name="outbound|9080||reviews.default.svc.cluster.local"}`: 2,
+		`envoy_cluster_upstream_cx_total{cluster_name="outbound|9080||reviews.default.svc.cluster.local"}`:  17,
+		`envoy_server_live{}`: 1,
+		`envoy_cluster_upstream_rq_time_bucket{cluster_name="outbound|9080||reviews.default.svc.cluster.local",le="0.5"}`:  0,
+		`envoy_cluster_upstream_rq_time_bucket{cluster_name="outbound|9080||reviews.default.svc.cluster.local",le="+Inf"}`: 12,
+		`envoy_cluster_upstream_rq_time_sum{cluster_name="outbound|9080||reviews.default.svc.cluster.local"}`:              54.5,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// The format is the requested one, even without any TYPE line.
+	var untyped []string
+	for _, line := range strings.Split(body, "\n") {
+		if !strings.HasPrefix(line, "#") {
+			untyped = append(untyped, line)
+		}
+	}
+	got, err = parseProxyStats(strings.Join(untyped, "\n"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v without TYPE lines, want %v", got, want)
+	}
+}
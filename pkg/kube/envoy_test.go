@@ -0,0 +1,537 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// podNames returns the sorted names of the pods.
+func podNames(pods []kubeApiCore.Pod) []string {
+	names := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func injectedPod(name, namespace string) *kubeApiCore.Pod {
+	return &kubeApiCore.Pod{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: kubeApiCore.PodSpec{
+			Containers: []kubeApiCore.Container{{Name: "app"}, {Name: proxyContainerName}},
+		},
+		Status: kubeApiCore.PodStatus{Phase: kubeApiCore.PodRunning},
+	}
+}
+
+// envoyResponse returns a handler serving body for the given admin path.
+func envoyResponse(path, body string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(body))
+	})
+	return mux
+}
+
+func serverInfo(version string) string {
+	return fmt.Sprintf(`{"version": "73f240a29bece92a8882a36893ccce07b4a54664/%s/Clean/RELEASE/BoringSSL", "state": "LIVE"}`, version)
+}
+
+func TestListPodsByProxyVersion(t *testing.T) {
+	c := newFakeClient(
+		injectedPod("old-1", "default"),
+		injectedPod("old-2", "default"),
+		injectedPod("new-1", "default"),
+		&kubeApiCore.Pod{
+			ObjectMeta: kubeApiMeta.ObjectMeta{Name: "uninjected", Namespace: "default"},
+			Spec:       kubeApiCore.PodSpec{Containers: []kubeApiCore.Container{{Name: "app"}}},
+		},
+	)
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"old-1": envoyResponse("/server_info", serverInfo("1.14.1")),
+		"old-2": envoyResponse("/server_info", serverInfo("1.14.1")),
+		"new-1": envoyResponse("/server_info", serverInfo("1.15.0-dev")),
+	})
+
+	pods, err := c.ListPodsByProxyVersion(context.Background(), "default", "1.14.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := podNames(pods); !reflect.DeepEqual(got, []string{"old-1", "old-2"}) {
+		t.Fatalf("unexpected pods: %v", got)
+	}
+}
+
+func TestEnvoyDoWithHeaders(t *testing.T) {
+	c := newFakeClient()
+	var got http.Header
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"pod": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header
+		}),
+	})
+
+	if _, err := c.EnvoyDo(context.Background(), "pod", "default", "GET", "stats", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("Authorization") != "" {
+		t.Fatalf("unexpected Authorization header by default: %v", got)
+	}
+
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer token")
+	headers.Set("X-B3-Sampled", "1")
+	if _, err := c.EnvoyDoWithOptions(context.Background(), "pod", "default", "GET", "stats", nil,
+		WithHeaders(headers)); err != nil {
+		t.Fatal(err)
+	}
+	if got.Get("Authorization") != "Bearer token" || got.Get("X-B3-Sampled") != "1" {
+		t.Fatalf("custom headers not sent: %v", got)
+	}
+}
+
+func TestEnvoyDoGzip(t *testing.T) {
+	const configDump = `{"configs": []}`
+	c := newFakeClient()
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"pod": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Accept-Encoding") != "gzip" {
+				_, _ = w.Write([]byte(configDump))
+				return
+			}
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			_, _ = gz.Write([]byte(configDump))
+			_ = gz.Close()
+		}),
+	})
+
+	out, err := c.EnvoyDo(context.Background(), "pod", "default", "GET", "config_dump", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != configDump {
+		t.Fatalf("got %q, want the decompressed %q", out, configDump)
+	}
+
+	out, err = c.EnvoyDoWithOptions(context.Background(), "pod", "default", "GET", "config_dump", nil, WithoutCompression())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != configDump {
+		t.Fatalf("got %q, want the uncompressed %q", out, configDump)
+	}
+}
+
+func TestEnvoyDoForwardRetry(t *testing.T) {
+	c := newFakeClient()
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"productpage": envoyResponse("/server_info", `{"state": "LIVE"}`),
+	})
+	fakeForwarders := c.forwarderFactory
+	var forwards int
+	// Every other port forward drops.
+	c.forwarderFactory = func(config *rest.Config, podName, ns, localAddress string, localPort, podPort int) (PortForwarder, error) {
+		forwards++
+		fw, err := fakeForwarders(config, podName, ns, localAddress, localPort, podPort)
+		if err != nil {
+			return nil, err
+		}
+		if forwards%2 == 1 {
+			fw.(*fakeForwarder).startErr = errors.New("an error occurred forwarding 15000 -> 15000: " +
+				"read tcp4 127.0.0.1:15000->127.0.0.1:53016: read: connection reset by peer")
+		}
+		return fw, nil
+	}
+
+	out, err := c.EnvoyDo(context.Background(), "productpage", "default", "GET", "server_info", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"state": "LIVE"}` || forwards != 2 {
+		t.Fatalf("got %q after %d port forwards, want the response after 2", out, forwards)
+	}
+
+	forwards = 0
+	if _, err := c.EnvoyDoWithOptions(context.Background(), "productpage", "default", "GET", "server_info", nil,
+		WithForwardAttempts(1)); err == nil {
+		t.Fatal("expected an error without retries")
+	}
+	if forwards != 1 {
+		t.Fatalf("got %d port forwards without retries, want 1", forwards)
+	}
+
+	// Other errors are not retried.
+	forwards = 0
+	if _, err := c.EnvoyDo(context.Background(), "missing", "default", "GET", "server_info", nil); err == nil {
+		t.Fatal("expected an error for a missing pod")
+	}
+	if forwards != 1 {
+		t.Fatalf("got %d port forwards for a missing pod, want 1", forwards)
+	}
+}
+
+func TestEnvoyDoExecFallback(t *testing.T) {
+	c := newFakeClient()
+	// No port forward can be established to the pod.
+	withFakeEnvoys(t, c, nil)
+	withFakeExec(t, c)
+	var commands [][]string
+	c.executorFactory = func(_ *rest.Config, _ string, u *url.URL) (remotecommand.Executor, error) {
+		if container := u.Query().Get("container"); container != "istio-proxy" {
+			t.Errorf("got exec into container %q, want istio-proxy", container)
+		}
+		commands = append(commands, u.Query()["command"])
+		return execFunc(func(opts remotecommand.StreamOptions) error {
+			_, _ = opts.Stdout.Write([]byte(`{"state": "LIVE"}`))
+			return nil
+		}), nil
+	}
+
+	if _, err := c.EnvoyDo(context.Background(), "pod", "default", "GET", "server_info", nil); err == nil {
+		t.Fatal("expected an error without the exec fallback")
+	}
+	if len(commands) != 0 {
+		t.Fatalf("unexpected exec without the exec fallback: %v", commands)
+	}
+
+	cases := []struct {
+		adminSocket string
+		want        []string
+	}{
+		{want: []string{"pilot-agent", "request", "GET", "server_info"}},
+		{
+			adminSocket: "/etc/istio/proxy/admin.sock",
+			want:        []string{"curl", "-sS", "-X", "GET", "--unix-socket", "/etc/istio/proxy/admin.sock", "http://localhost/server_info"},
+		},
+	}
+	for _, tt := range cases {
+		commands = nil
+		out, err := c.EnvoyDoWithOptions(context.Background(), "pod", "default", "GET", "server_info", nil,
+			WithExecFallback(tt.adminSocket))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != `{"state": "LIVE"}` {
+			t.Fatalf("got %q, want the exec output", out)
+		}
+		if !reflect.DeepEqual(commands, [][]string{tt.want}) {
+			t.Fatalf("got commands %v, want %v", commands, tt.want)
+		}
+	}
+}
+
+func TestEnvoyDoExecFallbackRequest(t *testing.T) {
+	c := newFakeClient()
+	withFakeEnvoys(t, c, nil)
+	withFakeExec(t, c)
+	var commands [][]string
+	var stdin []byte
+	c.executorFactory = func(_ *rest.Config, _ string, u *url.URL) (remotecommand.Executor, error) {
+		commands = append(commands, u.Query()["command"])
+		return execFunc(func(opts remotecommand.StreamOptions) error {
+			if opts.Stdin != nil {
+				stdin, _ = ioutil.ReadAll(opts.Stdin)
+			}
+			_, _ = opts.Stdout.Write([]byte("OK\n"))
+			return nil
+		}), nil
+	}
+
+	headers := http.Header{"X-B": {"2"}, "X-A": {"1"}}
+	_, err := c.EnvoyDoWithOptions(context.Background(), "pod", "default", "POST", "logging?level=debug", []byte("body"),
+		WithHeaders(headers), WithExecFallback("/etc/istio/proxy/admin.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"curl", "-sS", "-X", "POST", "--unix-socket", "/etc/istio/proxy/admin.sock",
+		"-H", "X-A: 1", "-H", "X-B: 2", "--data-binary", "@-", "http://localhost/logging?level=debug"}}
+	if !reflect.DeepEqual(commands, want) {
+		t.Fatalf("got commands %v, want %v", commands, want)
+	}
+	if string(stdin) != "body" {
+		t.Fatalf("got stdin %q, want the request body", stdin)
+	}
+
+	// pilot-agent can't send the body or headers.
+	commands = nil
+	if _, err := c.EnvoyDoWithOptions(context.Background(), "pod", "default", "POST", "logging", []byte("body"),
+		WithExecFallback("")); err == nil {
+		t.Fatal("expected pilot-agent to reject the body")
+	}
+	if _, err := c.EnvoyDoWithOptions(context.Background(), "pod", "default", "POST", "logging", nil,
+		WithHeaders(headers), WithExecFallback("")); err == nil {
+		t.Fatal("expected pilot-agent to reject the headers")
+	}
+	if len(commands) != 0 {
+		t.Fatalf("unexpected exec of pilot-agent: %v", commands)
+	}
+}
+
+func TestEnvoyDoExecFallbackNotSent(t *testing.T) {
+	c := newFakeClient()
+	withFakeExec(t, c)
+	var commands [][]string
+	c.executorFactory = func(_ *rest.Config, _ string, u *url.URL) (remotecommand.Executor, error) {
+		commands = append(commands, u.Query()["command"])
+		return execFunc(func(remotecommand.StreamOptions) error { return nil }), nil
+	}
+
+	// The request reached Envoy, which dropped the connection before answering.
+	var requests int32
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"pod": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = conn.Close()
+		}),
+	})
+	if _, err := c.EnvoyDoWithOptions(context.Background(), "pod", "default", "POST", "healthcheck/fail", nil,
+		WithForwardAttempts(1), WithExecFallback("")); err == nil {
+		t.Fatal("expected an error for the dropped connection")
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Fatalf("got %d requests, want 1", requests)
+	}
+
+	// The port forward can't be set up, but ctx is done.
+	withFakeEnvoys(t, c, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.EnvoyDoWithOptions(ctx, "pod", "default", "POST", "healthcheck/fail", nil,
+		WithExecFallback("")); err == nil {
+		t.Fatal("expected an error for the cancelled context")
+	}
+	if len(commands) != 0 {
+		t.Fatalf("unexpected exec fallback: %v", commands)
+	}
+}
+
+func TestProxyAdminRequest(t *testing.T) {
+	c := newFakeClient()
+	withFakeExec(t, c)
+	var commands [][]string
+	c.executorFactory = func(_ *rest.Config, _ string, u *url.URL) (remotecommand.Executor, error) {
+		if container := u.Query().Get("container"); container != "istio-proxy" {
+			t.Errorf("got exec into container %q, want istio-proxy", container)
+		}
+		commands = append(commands, u.Query()["command"])
+		return execFunc(func(opts remotecommand.StreamOptions) error {
+			_, _ = opts.Stdout.Write([]byte("LIVE\n"))
+			return nil
+		}), nil
+	}
+
+	out, err := c.ProxyAdminRequest(context.Background(), "productpage", "default", "GET", "ready")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "LIVE\n" {
+		t.Fatalf("got output %q, want %q", out, "LIVE\n")
+	}
+	if want := [][]string{{"pilot-agent", "request", "GET", "ready"}}; !reflect.DeepEqual(commands, want) {
+		t.Fatalf("got commands %v, want %v", commands, want)
+	}
+
+	c.executorFactory = func(_ *rest.Config, _ string, _ *url.URL) (remotecommand.Executor, error) {
+		return execFunc(func(opts remotecommand.StreamOptions) error {
+			_, _ = opts.Stderr.Write([]byte("no such file or directory"))
+			return errors.New("command terminated with exit code 1")
+		}), nil
+	}
+	if _, err := c.ProxyAdminRequest(context.Background(), "productpage", "default", "GET", "ready"); err == nil {
+		t.Fatal("expected an error for a failed command")
+	}
+}
+
+func TestIsProxyReady(t *testing.T) {
+	c := newFakeClient()
+	var ports []int
+	var paths []string
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"ready": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.Path)
+			_, _ = w.Write([]byte("LIVE\n"))
+		}),
+		"starting": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.Path)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("PRE_INITIALIZING\n"))
+		}),
+	})
+	forward := c.forwarderFactory
+	c.forwarderFactory = func(config *rest.Config, podName, ns, localAddress string, localPort, podPort int) (PortForwarder, error) {
+		ports = append(ports, podPort)
+		return forward(config, podName, ns, localAddress, localPort, podPort)
+	}
+
+	cases := []struct {
+		pod       string
+		opts      []EnvoyDoOption
+		wantReady bool
+		wantBody  string
+		wantPort  int
+		wantPath  string
+	}{
+		{pod: "ready", wantReady: true, wantBody: "LIVE", wantPort: 15021, wantPath: "/healthz/ready"},
+		{pod: "starting", wantBody: "PRE_INITIALIZING", wantPort: 15021, wantPath: "/healthz/ready"},
+		{pod: "ready", opts: []EnvoyDoOption{WithProxyPort(15000)}, wantReady: true, wantBody: "LIVE", wantPort: 15000, wantPath: "/ready"},
+	}
+	for _, tt := range cases {
+		ports, paths = nil, nil
+		ready, body, err := c.IsProxyReady(context.Background(), tt.pod, "default", tt.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ready != tt.wantReady || body != tt.wantBody {
+			t.Fatalf("%s: got ready=%v body=%q, want ready=%v body=%q", tt.pod, ready, body, tt.wantReady, tt.wantBody)
+		}
+		if !reflect.DeepEqual(ports, []int{tt.wantPort}) || !reflect.DeepEqual(paths, []string{tt.wantPath}) {
+			t.Fatalf("%s: got requests to ports %v paths %v, want %d %s", tt.pod, ports, paths, tt.wantPort, tt.wantPath)
+		}
+	}
+}
+
+func TestGetProxyServerInfo(t *testing.T) {
+	c := newFakeClient()
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"live":             envoyResponse("/server_info", string(readFixture(t, "server_info.json"))),
+		"draining":         envoyResponse("/server_info", `{"state": "DRAINING"}`),
+		"pre-initializing": envoyResponse("/server_info", `{"state": "PRE_INITIALIZING"}`),
+		"unknown":          envoyResponse("/server_info", `{"state": "BROKEN"}`),
+	})
+
+	got, err := c.GetProxyServerInfo(context.Background(), "live", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ServerInfo{
+		Version:            "73f240a29bece92a8882a36893ccce07b4a54664/1.15.0-dev/Clean/RELEASE/BoringSSL",
+		State:              ServerStateLive,
+		HotRestartVersion:  "11.104",
+		UptimeCurrentEpoch: 30 * time.Minute,
+		UptimeAllEpochs:    90*time.Minute + 500*time.Millisecond,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	for pod, want := range map[string]ServerState{"draining": ServerStateDraining, "pre-initializing": ServerStatePreInitializing} {
+		got, err := c.GetProxyServerInfo(context.Background(), pod, "default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.State != want {
+			t.Fatalf("got state %s for %s, want %s", got.State, pod, want)
+		}
+	}
+
+	if _, err := c.GetProxyServerInfo(context.Background(), "unknown", "default"); err == nil {
+		t.Fatal("expected an error for an unknown state")
+	}
+}
+
+func TestGetProxyRestartEpoch(t *testing.T) {
+	c := newFakeClient()
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"restarted": envoyResponse("/server_info", string(readFixture(t, "server_info.json"))),
+		"fresh":     envoyResponse("/server_info", `{"state": "LIVE", "command_line_options": {"restart_epoch": 0}}`),
+		"stuck":     envoyResponse("/server_info", `{"state": "DRAINING", "command_line_options": {"restart_epoch": 3}}`),
+		"invalid":   envoyResponse("/server_info", `not json`),
+	})
+
+	for pod, want := range map[string]int{"restarted": 1, "fresh": 0, "stuck": 3} {
+		got, err := c.GetProxyRestartEpoch(context.Background(), pod, "default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("got restart epoch %d for %s, want %d", got, pod, want)
+		}
+	}
+	if _, err := c.GetProxyRestartEpoch(context.Background(), "invalid", "default"); err == nil {
+		t.Fatal("expected an error for an invalid server_info")
+	}
+}
+
+func TestProxyShutdown(t *testing.T) {
+	c := newFakeClient()
+	var requests []string
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"productpage": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			_, _ = w.Write([]byte("OK\n"))
+		}),
+		"refused": http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "admin is read only", http.StatusForbidden)
+		}),
+	})
+
+	if err := c.DrainProxy(context.Background(), "productpage", "default"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.QuitProxy(context.Background(), "productpage", "default"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"POST /drain_listeners", "POST /quitquitquit"}; !reflect.DeepEqual(requests, want) {
+		t.Fatalf("got requests %v, want %v", requests, want)
+	}
+
+	if err := c.DrainProxy(context.Background(), "refused", "default"); err == nil {
+		t.Fatal("expected an error for a refused drain")
+	}
+	if err := c.QuitProxy(context.Background(), "refused", "default"); err == nil {
+		t.Fatal("expected an error for a refused quit")
+	}
+}
+
+func TestEnvoyDoBody(t *testing.T) {
+	c := newFakeClient()
+	var got []byte
+	withFakeEnvoys(t, c, map[string]http.Handler{
+		"productpage": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, _ = ioutil.ReadAll(r.Body)
+		}),
+	})
+
+	if _, err := c.EnvoyDo(context.Background(), "productpage", "default", "POST", "runtime_modify", []byte("a=b")); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "a=b" {
+		t.Fatalf("got body %q, want %q", got, "a=b")
+	}
+}
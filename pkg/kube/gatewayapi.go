@@ -0,0 +1,64 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	kubeApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ErrGatewayAPINotInstalled is returned when the Kubernetes Gateway API CRDs are not installed in the cluster.
+var ErrGatewayAPINotInstalled = errors.New("the Kubernetes Gateway API is not installed")
+
+var (
+	gatewayAPIGatewayGVR = schema.GroupVersionResource{
+		Group:    "gateway.networking.k8s.io",
+		Version:  "v1alpha1",
+		Resource: "gateways",
+	}
+	httpRouteGVR = schema.GroupVersionResource{
+		Group:    "gateway.networking.k8s.io",
+		Version:  "v1alpha1",
+		Resource: "httproutes",
+	}
+)
+
+func (c *client) ListGatewayAPIGateways(ctx context.Context, namespace string) ([]unstructured.Unstructured, error) {
+	return c.listGatewayAPIResources(ctx, gatewayAPIGatewayGVR, namespace)
+}
+
+func (c *client) ListHTTPRoutes(ctx context.Context, namespace string) ([]unstructured.Unstructured, error) {
+	return c.listGatewayAPIResources(ctx, httpRouteGVR, namespace)
+}
+
+// listGatewayAPIResources lists the Gateway API resources in the namespace, returning
+// ErrGatewayAPINotInstalled if the API server does not serve them.
+func (c *client) listGatewayAPIResources(ctx context.Context, gvr schema.GroupVersionResource,
+	namespace string) ([]unstructured.Unstructured, error) {
+	list, err := c.Dynamic().Resource(gvr).Namespace(namespace).List(ctx, kubeApiMeta.ListOptions{})
+	if err != nil {
+		if kubeApiErrors.IsNotFound(err) {
+			return nil, ErrGatewayAPINotInstalled
+		}
+		return nil, fmt.Errorf("unable to list %s in namespace %q: %v", gvr.Resource, namespace, err)
+	}
+	return list.Items, nil
+}
@@ -0,0 +1,97 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	kubeApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+func gatewayAPIObject(kind, name, namespace string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1alpha1",
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+	}}
+}
+
+func TestListGatewayAPIResources(t *testing.T) {
+	c := newFakeClient(
+		gatewayAPIObject("Gateway", "bookinfo", "default"),
+		gatewayAPIObject("Gateway", "ingress", "istio-system"),
+		gatewayAPIObject("HTTPRoute", "reviews", "default"),
+		gatewayAPIObject("HTTPRoute", "ratings", "default"),
+		// An Istio Gateway is not a Gateway API Gateway.
+		&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "networking.istio.io/v1beta1",
+			"kind":       "Gateway",
+			"metadata":   map[string]interface{}{"name": "istio-bookinfo", "namespace": "default"},
+		}},
+	)
+	names := func(items []unstructured.Unstructured) []string {
+		var out []string
+		for _, item := range items {
+			out = append(out, item.GetName())
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	gateways, err := c.ListGatewayAPIGateways(context.Background(), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(gateways), []string{"bookinfo"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got gateways %v, want %v", got, want)
+	}
+	gateways, err = c.ListGatewayAPIGateways(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(gateways), []string{"bookinfo", "ingress"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got gateways in all namespaces %v, want %v", got, want)
+	}
+	routes, err := c.ListHTTPRoutes(context.Background(), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(routes), []string{"ratings", "reviews"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got routes %v, want %v", got, want)
+	}
+}
+
+func TestListGatewayAPIResourcesNotInstalled(t *testing.T) {
+	c := newFakeClient()
+	c.Dynamic().(*dynamicfake.FakeDynamicClient).PrependReactor("list", "*",
+		func(action k8sTesting.Action) (bool, runtime.Object, error) {
+			return true, nil, kubeApiErrors.NewNotFound(action.GetResource().GroupResource(), "")
+		})
+
+	if _, err := c.ListGatewayAPIGateways(context.Background(), "default"); !errors.Is(err, ErrGatewayAPINotInstalled) {
+		t.Fatalf("ListGatewayAPIGateways: got error %v, want ErrGatewayAPINotInstalled", err)
+	}
+	if _, err := c.ListHTTPRoutes(context.Background(), "default"); !errors.Is(err, ErrGatewayAPINotInstalled) {
+		t.Fatalf("ListHTTPRoutes: got error %v, want ErrGatewayAPINotInstalled", err)
+	}
+}
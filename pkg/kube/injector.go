@@ -0,0 +1,60 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	injectorConfigMapName = "istio-sidecar-injector"
+	injectorConfigMapKey  = "config"
+
+	// sidecarTemplateName is the template injected into pods in the templates of newer injector configs.
+	sidecarTemplateName = "sidecar"
+)
+
+func (c *client) GetInjectionTemplate(ctx context.Context, namespace, revision string) (string, error) {
+	name := injectorConfigMapName
+	if revision != "" && revision != "default" {
+		name += "-" + revision
+	}
+	cm, err := c.CoreV1().ConfigMaps(namespace).Get(ctx, name, kubeApiMeta.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("unable to read injector config %s/%s: %v", namespace, name, err)
+	}
+	configYAML, ok := cm.Data[injectorConfigMapKey]
+	if !ok {
+		return "", fmt.Errorf("injector config %s/%s has no %q key", namespace, name, injectorConfigMapKey)
+	}
+	config := struct {
+		Template  string            `json:"template"`
+		Templates map[string]string `json:"templates"`
+	}{}
+	if err := yaml.Unmarshal([]byte(configYAML), &config); err != nil {
+		return "", fmt.Errorf("invalid injector config %s/%s: %v", namespace, name, err)
+	}
+	if config.Template != "" {
+		return config.Template, nil
+	}
+	if template, ok := config.Templates[sidecarTemplateName]; ok {
+		return template, nil
+	}
+	return "", fmt.Errorf("injector config %s/%s has no sidecar template", namespace, name)
+}
@@ -0,0 +1,59 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"testing"
+
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetInjectionTemplate(t *testing.T) {
+	injectorConfigMap := func(name, config string) *kubeApiCore.ConfigMap {
+		return &kubeApiCore.ConfigMap{
+			ObjectMeta: kubeApiMeta.ObjectMeta{Name: name, Namespace: "istio-system"},
+			Data:       map[string]string{"config": config, "values": "{}"},
+		}
+	}
+	c := newFakeClient(
+		injectorConfigMap("istio-sidecar-injector", "policy: enabled\ntemplate: |\n  containers:\n  - name: istio-proxy\n"),
+		injectorConfigMap("istio-sidecar-injector-canary",
+			"policy: enabled\ntemplates:\n  sidecar: |\n    containers:\n    - name: istio-proxy-canary\n"),
+		injectorConfigMap("istio-sidecar-injector-broken", "policy: enabled\n"),
+	)
+
+	cases := []struct {
+		revision string
+		want     string
+		wantErr  bool
+	}{
+		{revision: "", want: "containers:\n- name: istio-proxy\n"},
+		{revision: "default", want: "containers:\n- name: istio-proxy\n"},
+		{revision: "canary", want: "containers:\n- name: istio-proxy-canary\n"},
+		{revision: "broken", wantErr: true},
+		{revision: "missing", wantErr: true},
+	}
+	for _, tt := range cases {
+		got, err := c.GetInjectionTemplate(context.Background(), "istio-system", tt.revision)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("revision %q: got error %v, want error %v", tt.revision, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Fatalf("revision %q: got template %q, want %q", tt.revision, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Labels used to determine the locality of a proxy. These match the ones used by istiod.
+const (
+	localityLabel       = "istio-locality"
+	nodeRegionLabel     = "failure-domain.beta.kubernetes.io/region"
+	nodeZoneLabel       = "failure-domain.beta.kubernetes.io/zone"
+	nodeRegionLabelGA   = "topology.kubernetes.io/region"
+	nodeZoneLabelGA     = "topology.kubernetes.io/zone"
+	istioSubzoneLabel   = "topology.istio.io/subzone"
+	istioMetaJSONLabels = "ISTIO_METAJSON_LABELS"
+)
+
+// Locality is the region/zone/subzone reported by a proxy.
+type Locality struct {
+	Region  string
+	Zone    string
+	Subzone string
+}
+
+// String returns the locality in the "region/zone/subzone" format.
+func (l Locality) String() string {
+	return l.Region + "/" + l.Zone + "/" + l.Subzone
+}
+
+func (c *client) GetProxyLocality(ctx context.Context, namespace, podName string) (Locality, error) {
+	pod, err := c.CoreV1().Pods(namespace).Get(ctx, podName, kubeApiMeta.GetOptions{})
+	if err != nil {
+		return Locality{}, err
+	}
+
+	// An explicit istio-locality label, passed to the proxy through its metadata, takes precedence.
+	if l := podLocalityLabel(pod); l != "" {
+		return parseLocality(l), nil
+	}
+
+	if pod.Spec.NodeName == "" {
+		return Locality{}, fmt.Errorf("pod %s/%s is not scheduled to a node", namespace, podName)
+	}
+	node, err := c.CoreV1().Nodes().Get(ctx, pod.Spec.NodeName, kubeApiMeta.GetOptions{})
+	if err != nil {
+		return Locality{}, fmt.Errorf("unable to get node %s of pod %s/%s: %v", pod.Spec.NodeName, namespace, podName, err)
+	}
+	return Locality{
+		Region:  labelValue(node.Labels, nodeRegionLabelGA, nodeRegionLabel),
+		Zone:    labelValue(node.Labels, nodeZoneLabelGA, nodeZoneLabel),
+		Subzone: labelValue(node.Labels, istioSubzoneLabel),
+	}, nil
+}
+
+// podLocalityLabel returns the istio-locality label of the pod, or the one passed in the proxy metadata.
+func podLocalityLabel(pod *kubeApiCore.Pod) string {
+	if l := pod.Labels[localityLabel]; l != "" {
+		return l
+	}
+	for _, container := range pod.Spec.Containers {
+		if container.Name != proxyContainerName {
+			continue
+		}
+		for _, env := range container.Env {
+			if env.Name != istioMetaJSONLabels {
+				continue
+			}
+			metaLabels := map[string]string{}
+			if err := json.Unmarshal([]byte(env.Value), &metaLabels); err == nil {
+				return metaLabels[localityLabel]
+			}
+		}
+	}
+	return ""
+}
+
+// parseLocality parses a locality label, which is either "/" or "." separated.
+func parseLocality(label string) Locality {
+	sep := "/"
+	if !strings.Contains(label, sep) {
+		sep = "."
+	}
+	parts := strings.SplitN(label, sep, 3)
+	l := Locality{Region: parts[0]}
+	if len(parts) > 1 {
+		l.Zone = parts[1]
+	}
+	if len(parts) > 2 {
+		l.Subzone = parts[2]
+	}
+	return l
+}
+
+// labelValue returns the value of the first of the given labels that is set.
+func labelValue(labels map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if v := labels[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
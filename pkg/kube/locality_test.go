@@ -0,0 +1,61 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"testing"
+
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetProxyLocality(t *testing.T) {
+	node := &kubeApiCore.Node{
+		ObjectMeta: kubeApiMeta.ObjectMeta{
+			Name: "node-1",
+			Labels: map[string]string{
+				nodeRegionLabelGA: "us-central1",
+				nodeZoneLabelGA:   "us-central1-a",
+				nodeZoneLabel:     "legacy-zone",
+				istioSubzoneLabel: "rack-1",
+			},
+		},
+	}
+	scheduled := injectedPod("scheduled", "default")
+	scheduled.Spec.NodeName = node.Name
+	overridden := injectedPod("overridden", "default")
+	overridden.Spec.NodeName = node.Name
+	overridden.Spec.Containers[1].Env = []kubeApiCore.EnvVar{
+		{Name: istioMetaJSONLabels, Value: `{"app":"foo","istio-locality":"eu-west1.eu-west1-b.rack-2"}`},
+	}
+
+	c := newFakeClient(node, scheduled, overridden)
+	cases := map[string]Locality{
+		"scheduled":  {Region: "us-central1", Zone: "us-central1-a", Subzone: "rack-1"},
+		"overridden": {Region: "eu-west1", Zone: "eu-west1-b", Subzone: "rack-2"},
+	}
+	for pod, want := range cases {
+		t.Run(pod, func(t *testing.T) {
+			got, err := c.GetProxyLocality(context.Background(), "default", pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+
+	"istio.io/istio/pkg/config/mesh"
+)
+
+const (
+	meshConfigMapName = "istio"
+	meshConfigMapKey  = "mesh"
+)
+
+// meshConfigMapNameForRevision returns the name of the mesh ConfigMap used by the given control plane revision.
+func meshConfigMapNameForRevision(revision string) string {
+	if revision == "" {
+		return meshConfigMapName
+	}
+	return meshConfigMapName + "-" + revision
+}
+
+// getMeshConfigYAML returns the raw mesh config of the client's revision, read from the control plane namespace.
+func (c *client) getMeshConfigYAML(ctx context.Context, istioNamespace string) (string, error) {
+	name := meshConfigMapNameForRevision(c.revision)
+	cm, err := c.CoreV1().ConfigMaps(istioNamespace).Get(ctx, name, kubeApiMeta.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("unable to read mesh config %s/%s: %v", istioNamespace, name, err)
+	}
+	meshYAML, ok := cm.Data[meshConfigMapKey]
+	if !ok {
+		return "", fmt.Errorf("mesh config %s/%s has no %q key", istioNamespace, name, meshConfigMapKey)
+	}
+	return meshYAML, nil
+}
+
+// getMeshConfig returns the mesh config of the client's revision, with defaults applied.
+func (c *client) getMeshConfig(ctx context.Context, istioNamespace string) (*meshconfig.MeshConfig, error) {
+	meshYAML, err := c.getMeshConfigYAML(ctx, istioNamespace)
+	if err != nil {
+		return nil, err
+	}
+	mc, err := mesh.ApplyMeshConfigDefaults(meshYAML)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mesh config in %s: %v", istioNamespace, err)
+	}
+	return mc, nil
+}
+
+// ExtensionProvider is an entry of the extensionProviders list of the mesh config.
+type ExtensionProvider struct {
+	Name string
+	// Type of the provider, which is the key of its settings in the mesh config, e.g. "zipkin" or "opentelemetry".
+	Type string
+	// Service and Port are the address of the provider backend. They are empty for providers without one.
+	Service string
+	Port    uint32
+}
+
+// The MeshConfig API vendored here predates extensionProviders, so they are parsed from the raw mesh config.
+type meshExtensionProviders struct {
+	ExtensionProviders []map[string]json.RawMessage `json:"extensionProviders"`
+}
+
+type extensionProviderAddress struct {
+	Service string `json:"service"`
+	Port    uint32 `json:"port"`
+}
+
+func (c *client) GetExtensionProviders(ctx context.Context, namespace string) ([]ExtensionProvider, error) {
+	meshYAML, err := c.getMeshConfigYAML(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return parseExtensionProviders(meshYAML)
+}
+
+func parseExtensionProviders(meshYAML string) ([]ExtensionProvider, error) {
+	mc := &meshExtensionProviders{}
+	if err := yaml.Unmarshal([]byte(meshYAML), mc); err != nil {
+		return nil, fmt.Errorf("invalid mesh config: %v", err)
+	}
+	providers := make([]ExtensionProvider, 0, len(mc.ExtensionProviders))
+	for i, raw := range mc.ExtensionProviders {
+		provider := ExtensionProvider{}
+		if name, ok := raw["name"]; ok {
+			if err := json.Unmarshal(name, &provider.Name); err != nil {
+				return nil, fmt.Errorf("invalid name of extension provider %d: %v", i, err)
+			}
+		}
+		var types []string
+		for key := range raw {
+			if key != "name" {
+				types = append(types, key)
+			}
+		}
+		if len(types) != 1 {
+			sort.Strings(types)
+			return nil, fmt.Errorf("extension provider %q must have exactly one provider type, found %v", provider.Name, types)
+		}
+		provider.Type = types[0]
+		address := extensionProviderAddress{}
+		if err := json.Unmarshal(raw[provider.Type], &address); err != nil {
+			return nil, fmt.Errorf("invalid %s settings of extension provider %q: %v", provider.Type, provider.Name, err)
+		}
+		provider.Service, provider.Port = address.Service, address.Port
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
@@ -0,0 +1,67 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestGetExtensionProviders(t *testing.T) {
+	c := newFakeClient(meshConfigMap("istio-system", `
+defaultConfig:
+  tracing:
+    sampling: 10
+extensionProviders:
+- name: otel
+  opentelemetry:
+    service: opentelemetry-collector.istio-system.svc.cluster.local
+    port: 4317
+- name: zipkin
+  zipkin:
+    service: zipkin.istio-system.svc.cluster.local
+    port: 9411
+- name: envoy
+  envoyFileAccessLog:
+    path: /dev/stdout
+`))
+
+	got, err := c.GetExtensionProviders(context.Background(), "istio-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ExtensionProvider{
+		{Name: "otel", Type: "opentelemetry", Service: "opentelemetry-collector.istio-system.svc.cluster.local", Port: 4317},
+		{Name: "zipkin", Type: "zipkin", Service: "zipkin.istio-system.svc.cluster.local", Port: 9411},
+		{Name: "envoy", Type: "envoyFileAccessLog"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseExtensionProvidersInvalid(t *testing.T) {
+	if _, err := parseExtensionProviders(`
+extensionProviders:
+- name: both
+  zipkin:
+    service: zipkin
+  lightstep:
+    service: lightstep
+`); err == nil {
+		t.Fatal("expected error for provider with two types")
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	kubeApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ErrNotOpenShift is returned when the cluster does not serve the OpenShift APIs.
+var ErrNotOpenShift = errors.New("the cluster is not an OpenShift cluster")
+
+var openShiftRouteGVR = schema.GroupVersionResource{
+	Group:    "route.openshift.io",
+	Version:  "v1",
+	Resource: "routes",
+}
+
+func (c *client) ListOpenShiftRoutes(ctx context.Context, namespace string) ([]unstructured.Unstructured, error) {
+	list, err := c.Dynamic().Resource(openShiftRouteGVR).Namespace(namespace).List(ctx, kubeApiMeta.ListOptions{})
+	if err != nil {
+		if kubeApiErrors.IsNotFound(err) {
+			return nil, ErrNotOpenShift
+		}
+		return nil, fmt.Errorf("unable to list routes in namespace %q: %v", namespace, err)
+	}
+	return list.Items, nil
+}
@@ -0,0 +1,63 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	kubeApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+func TestListOpenShiftRoutes(t *testing.T) {
+	c := newFakeClient(&unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "route.openshift.io/v1",
+		"kind":       "Route",
+		"metadata":   map[string]interface{}{"name": "istio-ingressgateway", "namespace": "istio-system"},
+		"spec": map[string]interface{}{
+			"host": "bookinfo.apps.example.com",
+			"to":   map[string]interface{}{"kind": "Service", "name": "istio-ingressgateway"},
+		},
+	}})
+
+	routes, err := c.ListOpenShiftRoutes(context.Background(), "istio-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 || routes[0].GetName() != "istio-ingressgateway" {
+		t.Fatalf("unexpected routes %v", routes)
+	}
+	if host, _, _ := unstructured.NestedString(routes[0].Object, "spec", "host"); host != "bookinfo.apps.example.com" {
+		t.Fatalf("got route host %q, want bookinfo.apps.example.com", host)
+	}
+}
+
+func TestListOpenShiftRoutesNotOpenShift(t *testing.T) {
+	c := newFakeClient()
+	// The API server of a cluster without the Route CRD answers not found.
+	c.Dynamic().(*dynamicfake.FakeDynamicClient).PrependReactor("list", "routes",
+		func(action k8sTesting.Action) (bool, runtime.Object, error) {
+			return true, nil, kubeApiErrors.NewNotFound(action.GetResource().GroupResource(), "")
+		})
+
+	if _, err := c.ListOpenShiftRoutes(context.Background(), "istio-system"); !errors.Is(err, ErrNotOpenShift) {
+		t.Fatalf("got error %v, want ErrNotOpenShift", err)
+	}
+}
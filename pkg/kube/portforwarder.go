@@ -21,11 +21,22 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/portforward"
 	"k8s.io/client-go/transport/spdy"
+
+	"istio.io/pkg/log"
 )
 
 // PortForwarder manages the forwarding of a single port.
@@ -45,18 +56,25 @@ type PortForwarder interface {
 
 var _ PortForwarder = &forwarder{}
 
+// portForwarderFactory creates a PortForwarder for the given pod.
+type portForwarderFactory func(restConfig *rest.Config, podName, ns, localAddress string,
+	localPort, podPort int) (PortForwarder, error)
+
 type forwarder struct {
 	forwarder *portforward.PortForwarder
 	stopCh    chan struct{}
 	readyCh   <-chan struct{}
 	address   string
 	output    *bytes.Buffer
+	// doneCh is closed when the port forward stops, such as when the connection to the pod is lost.
+	doneCh chan struct{}
 }
 
 func (f *forwarder) Start() error {
 	errCh := make(chan error, 1)
 	go func() {
 		errCh <- f.forwarder.ForwardPorts()
+		close(f.doneCh)
 	}()
 
 	select {
@@ -79,7 +97,29 @@ func (f *forwarder) Close() {
 }
 
 func (f *forwarder) WaitForStop() {
-	<-f.stopCh
+	select {
+	case <-f.stopCh:
+	case <-f.doneCh:
+	}
+}
+
+// validateLocalAddress checks that the local address to forward from is an IP address or a host name, so
+// that an invalid address fails early rather than when the forwarder starts listening. An empty address
+// means defaultLocalAddress. Binding to all interfaces is allowed, but exposes the pod to the network.
+func validateLocalAddress(localAddress string) error {
+	if localAddress == "" {
+		return nil
+	}
+	if ip := net.ParseIP(localAddress); ip != nil {
+		if ip.IsUnspecified() {
+			log.Warnf("port forwarding on %s exposes the pod to every host which can reach this machine", localAddress)
+		}
+		return nil
+	}
+	if errs := validation.IsDNS1123Subdomain(strings.ToLower(localAddress)); len(errs) > 0 {
+		return fmt.Errorf("invalid local address %q: must be an IP address or a host name", localAddress)
+	}
+	return nil
 }
 
 func newPortForwarder(restConfig *rest.Config, podName, ns, localAddress string, localPort, podPort int) (PortForwarder, error) {
@@ -140,11 +180,240 @@ func newPortForwarder(restConfig *rest.Config, podName, ns, localAddress string,
 		forwarder: fw,
 		stopCh:    stopCh,
 		readyCh:   readyCh,
+		doneCh:    make(chan struct{}),
 		output:    output,
-		address:   fmt.Sprintf("%s:%d", defaultLocalAddress, localPort),
+		address:   net.JoinHostPort(dialAddress(localAddress), strconv.Itoa(localPort)),
 	}, nil
 }
 
+// dialAddress returns the address to connect to a forwarder listening on localAddress. A forwarder
+// listening on all interfaces is reached through defaultLocalAddress.
+func dialAddress(localAddress string) string {
+	if ip := net.ParseIP(localAddress); ip != nil && ip.IsUnspecified() {
+		return defaultLocalAddress
+	}
+	return localAddress
+}
+
+func (c *client) NewServicePortForwarder(serviceName, ns, localAddress string, localPort, servicePort int,
+	opts ...PortForwarderOption) (PortForwarder, error) {
+	if err := validateLocalAddress(localAddress); err != nil {
+		return nil, err
+	}
+	dial := func(localPort int) (PortForwarder, error) {
+		podName, podPort, err := c.resolveServicePort(context.TODO(), serviceName, ns, servicePort)
+		if err != nil {
+			return nil, err
+		}
+		return c.forwarderFactory(c.config, podName, ns, localAddress, localPort, podPort)
+	}
+	options := newPortForwarderOptions(opts)
+	if !options.reconnect {
+		return dial(localPort)
+	}
+	return newReconnectingForwarder(localPort, options, dial), nil
+}
+
+var _ PortForwarder = &reconnectingForwarder{}
+
+// reconnectingForwarder is a PortForwarder which establishes a new port forward when the current one stops.
+type reconnectingForwarder struct {
+	// dial creates a port forward from the local port.
+	dial      func(localPort int) (PortForwarder, error)
+	localPort int
+	options   portForwarderOptions
+
+	mu      sync.Mutex
+	current PortForwarder
+
+	stopCh    chan struct{}
+	closeOnce sync.Once
+}
+
+func newReconnectingForwarder(localPort int, options portForwarderOptions,
+	dial func(localPort int) (PortForwarder, error)) *reconnectingForwarder {
+	return &reconnectingForwarder{
+		dial:      dial,
+		localPort: localPort,
+		options:   options,
+		stopCh:    make(chan struct{}),
+	}
+}
+
+func (f *reconnectingForwarder) Start() error {
+	fw, err := f.connect()
+	if err != nil {
+		return err
+	}
+	// Reconnect on the port selected by the first forward, so that the address does not change.
+	if _, port, err := net.SplitHostPort(fw.Address()); err == nil {
+		f.localPort, _ = strconv.Atoi(port)
+	}
+	f.mu.Lock()
+	f.current = fw
+	f.mu.Unlock()
+	go f.watch()
+	return nil
+}
+
+// connect establishes a new port forward.
+func (f *reconnectingForwarder) connect() (PortForwarder, error) {
+	fw, err := f.dial(f.localPort)
+	if err != nil {
+		return nil, err
+	}
+	if err := fw.Start(); err != nil {
+		fw.Close()
+		return nil, err
+	}
+	return fw, nil
+}
+
+// watch waits for the current port forward to stop and replaces it, until the forwarder is closed. Failed
+// reconnections are attempted again after the reconnect interval.
+func (f *reconnectingForwarder) watch() {
+	for {
+		f.mu.Lock()
+		current := f.current
+		f.mu.Unlock()
+		if current != nil {
+			// WaitForStop returns once the connection to the pod is lost, or the forwarder is closed.
+			current.WaitForStop()
+			f.mu.Lock()
+			select {
+			case <-f.stopCh:
+				f.mu.Unlock()
+				return
+			default:
+			}
+			current.Close()
+			f.current = nil
+			f.mu.Unlock()
+		} else {
+			select {
+			case <-f.stopCh:
+				return
+			case <-time.After(f.options.reconnectInterval):
+			}
+		}
+
+		fw, err := f.connect()
+		f.mu.Lock()
+		select {
+		case <-f.stopCh:
+			// Closed while reconnecting.
+			f.mu.Unlock()
+			if fw != nil {
+				fw.Close()
+			}
+			return
+		default:
+		}
+		f.current = fw
+		f.mu.Unlock()
+		if f.options.onReconnect != nil {
+			f.options.onReconnect(err)
+		}
+	}
+}
+
+func (f *reconnectingForwarder) Address() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.current == nil {
+		return ""
+	}
+	return f.current.Address()
+}
+
+func (f *reconnectingForwarder) Close() {
+	f.closeOnce.Do(func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		close(f.stopCh)
+		if f.current != nil {
+			f.current.Close()
+		}
+	})
+}
+
+func (f *reconnectingForwarder) WaitForStop() {
+	<-f.stopCh
+}
+
+// resolveServicePort returns a ready pod backing the service, and the container port its servicePort targets.
+func (c *client) resolveServicePort(ctx context.Context, serviceName, ns string, servicePort int) (string, int, error) {
+	svc, err := c.CoreV1().Services(ns).Get(ctx, serviceName, metav1.GetOptions{})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed retrieving service %s/%s: %v", ns, serviceName, err)
+	}
+	var port *v1.ServicePort
+	for i := range svc.Spec.Ports {
+		if int(svc.Spec.Ports[i].Port) == servicePort {
+			port = &svc.Spec.Ports[i]
+			break
+		}
+	}
+	if port == nil {
+		return "", 0, fmt.Errorf("service %s/%s has no port %d", ns, serviceName, servicePort)
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return "", 0, fmt.Errorf("service %s/%s has no pod selector", ns, serviceName)
+	}
+
+	pods, err := c.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed listing pods of service %s/%s: %v", ns, serviceName, err)
+	}
+	items := pods.Items
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	for i := range items {
+		pod := &items[i]
+		if !isPodReady(pod) {
+			continue
+		}
+		if podPort, ok := targetContainerPort(pod, *port); ok {
+			return pod.Name, podPort, nil
+		}
+	}
+	return "", 0, fmt.Errorf("no ready pod of service %s/%s serves port %d", ns, serviceName, servicePort)
+}
+
+// targetContainerPort returns the container port of the pod targeted by the service port, resolving named
+// target ports from the ports declared by the containers.
+func targetContainerPort(pod *v1.Pod, port v1.ServicePort) (int, bool) {
+	switch {
+	case port.TargetPort.Type == intstr.String:
+		for _, container := range pod.Spec.Containers {
+			for _, containerPort := range container.Ports {
+				if containerPort.Name == port.TargetPort.StrVal {
+					return int(containerPort.ContainerPort), true
+				}
+			}
+		}
+		return 0, false
+	case port.TargetPort.IntVal != 0:
+		return int(port.TargetPort.IntVal), true
+	default:
+		// The target port defaults to the service port.
+		return int(port.Port), true
+	}
+}
+
+func isPodReady(pod *v1.Pod) bool {
+	if pod.Status.Phase != v1.PodRunning {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == v1.PodReady {
+			return cond.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
 func availablePort(localAddr string) (int, error) {
 	addr, err := net.ResolveTCPAddr("tcp", localAddr+":0")
 	if err != nil {
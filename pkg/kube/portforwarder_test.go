@@ -0,0 +1,216 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/rest"
+)
+
+func TestNewServicePortForwarder(t *testing.T) {
+	gatewayPod := func(name string, ready kubeApiCore.ConditionStatus) *kubeApiCore.Pod {
+		return &kubeApiCore.Pod{
+			ObjectMeta: kubeApiMeta.ObjectMeta{
+				Name:      name,
+				Namespace: "istio-system",
+				Labels:    map[string]string{"istio": "ingressgateway"},
+			},
+			Spec: kubeApiCore.PodSpec{
+				Containers: []kubeApiCore.Container{{
+					Name: "istio-proxy",
+					Ports: []kubeApiCore.ContainerPort{
+						{Name: "http2", ContainerPort: 8080},
+						{Name: "https", ContainerPort: 8443},
+					},
+				}},
+			},
+			Status: kubeApiCore.PodStatus{
+				Phase:      kubeApiCore.PodRunning,
+				Conditions: []kubeApiCore.PodCondition{{Type: kubeApiCore.PodReady, Status: ready}},
+			},
+		}
+	}
+	c := newFakeClient(
+		&kubeApiCore.Service{
+			ObjectMeta: kubeApiMeta.ObjectMeta{Name: "istio-ingressgateway", Namespace: "istio-system"},
+			Spec: kubeApiCore.ServiceSpec{
+				Selector: map[string]string{"istio": "ingressgateway"},
+				Ports: []kubeApiCore.ServicePort{
+					{Name: "http2", Port: 80, TargetPort: intstr.FromInt(8080)},
+					{Name: "https", Port: 443, TargetPort: intstr.FromString("https")},
+					{Name: "status-port", Port: 15021},
+				},
+			},
+		},
+		gatewayPod("istio-ingressgateway-a", kubeApiCore.ConditionFalse),
+		gatewayPod("istio-ingressgateway-b", kubeApiCore.ConditionTrue),
+	)
+	var gotPod string
+	var gotPort int
+	c.forwarderFactory = func(_ *rest.Config, podName, _, _ string, _, podPort int) (PortForwarder, error) {
+		gotPod, gotPort = podName, podPort
+		return &fakeForwarder{}, nil
+	}
+
+	cases := []struct {
+		servicePort int
+		wantPort    int
+	}{
+		{servicePort: 443, wantPort: 8443},
+		{servicePort: 80, wantPort: 8080},
+		{servicePort: 15021, wantPort: 15021},
+	}
+	for _, tt := range cases {
+		if _, err := c.NewServicePortForwarder("istio-ingressgateway", "istio-system", "", 0, tt.servicePort); err != nil {
+			t.Fatal(err)
+		}
+		if gotPod != "istio-ingressgateway-b" || gotPort != tt.wantPort {
+			t.Fatalf("service port %d: got forward to %s:%d, want the ready pod istio-ingressgateway-b:%d",
+				tt.servicePort, gotPod, gotPort, tt.wantPort)
+		}
+	}
+
+	if _, err := c.NewServicePortForwarder("istio-ingressgateway", "istio-system", "", 0, 8080); err == nil {
+		t.Fatal("expected an error for a port not exposed by the service")
+	}
+}
+
+func TestNewPortForwarderLocalAddress(t *testing.T) {
+	c := newFakeClient()
+	var gotAddress string
+	c.forwarderFactory = func(_ *rest.Config, _, _, localAddress string, _, _ int) (PortForwarder, error) {
+		gotAddress = localAddress
+		return &fakeForwarder{}, nil
+	}
+
+	for _, address := range []string{"", "localhost", "127.0.0.1", "::1", "0.0.0.0"} {
+		gotAddress = "unset"
+		if _, err := c.NewPortForwarder("istiod-1", "istio-system", address, 0, 15014); err != nil {
+			t.Fatalf("local address %q: %v", address, err)
+		}
+		if gotAddress != address {
+			t.Fatalf("got local address %q, want %q", gotAddress, address)
+		}
+	}
+
+	_, err := c.NewPortForwarder("istiod-1", "istio-system", "local host:8080", 0, 15014)
+	if err == nil || !strings.Contains(err.Error(), `invalid local address "local host:8080"`) {
+		t.Fatalf("got error %v, want an invalid local address error", err)
+	}
+}
+
+func TestDialAddress(t *testing.T) {
+	cases := map[string]string{
+		"localhost": "localhost",
+		"10.0.0.1":  "10.0.0.1",
+		"0.0.0.0":   defaultLocalAddress,
+		"::":        defaultLocalAddress,
+	}
+	for localAddress, want := range cases {
+		if got := dialAddress(localAddress); got != want {
+			t.Errorf("dialAddress(%q) = %q, want %q", localAddress, got, want)
+		}
+	}
+}
+
+// droppableForwarder is a fake PortForwarder whose connection to the pod can be dropped.
+type droppableForwarder struct {
+	fakeForwarder
+	stopCh    chan struct{}
+	closeOnce sync.Once
+}
+
+func newDroppableForwarder(address string) *droppableForwarder {
+	return &droppableForwarder{fakeForwarder: fakeForwarder{address: address}, stopCh: make(chan struct{})}
+}
+
+func (f *droppableForwarder) Close() {
+	f.closeOnce.Do(func() { close(f.stopCh) })
+}
+
+func (f *droppableForwarder) WaitForStop() {
+	<-f.stopCh
+}
+
+func TestAutoReconnect(t *testing.T) {
+	first, second := newDroppableForwarder("127.0.0.1:15001"), newDroppableForwarder("127.0.0.1:15002")
+
+	c := newFakeClient()
+	var mu sync.Mutex
+	var localPorts []int
+	c.forwarderFactory = func(_ *rest.Config, _, _, _ string, localPort, _ int) (PortForwarder, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		localPorts = append(localPorts, localPort)
+		switch len(localPorts) {
+		case 1:
+			return first, nil
+		case 2:
+			return nil, errors.New("pod is not running")
+		default:
+			return second, nil
+		}
+	}
+
+	reconnected := make(chan error, 2)
+	fw, err := c.NewPortForwarder("istiod-1", "istio-system", "", 0, 15014,
+		WithAutoReconnect(func(err error) { reconnected <- err }), WithReconnectInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer fw.Close()
+	if fw.Address() != first.Address() {
+		t.Fatalf("got address %s, want %s", fw.Address(), first.Address())
+	}
+
+	// Drop the forward: the first reconnection fails, and is attempted again.
+	first.Close()
+	for i, wantErr := range []bool{true, false} {
+		select {
+		case err := <-reconnected:
+			if (err != nil) != wantErr {
+				t.Fatalf("reconnection %d: got error %v, want error %v", i, err, wantErr)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the forwarder to reconnect")
+		}
+	}
+	if fw.Address() != second.Address() {
+		t.Fatalf("got address %s after reconnecting, want %s", fw.Address(), second.Address())
+	}
+
+	fw.Close()
+	select {
+	case <-second.stopCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the current forward was not closed with the forwarder")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(localPorts) != 3 || localPorts[1] != 15001 || localPorts[2] != 15001 {
+		t.Fatalf("got forwards from local ports %v, want reconnections from port 15001", localPorts)
+	}
+}
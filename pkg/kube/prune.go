@@ -0,0 +1,95 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	kubeApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// appliedObjects records the objects applied by kubectl across files, so that the others can be pruned.
+type appliedObjects struct {
+	uids       sets.String
+	namespaces sets.String
+}
+
+func newAppliedObjects() *appliedObjects {
+	return &appliedObjects{uids: sets.NewString(), namespaces: sets.NewString()}
+}
+
+// validatePrune returns an error if the prune options of opts can't be applied.
+func validatePrune(opts ApplyOptions) error {
+	if opts.PruneSelector == "" {
+		return nil
+	}
+	if len(opts.PruneAllowlist) == 0 {
+		return errors.New("pruning requires an allowlist of the kinds to prune")
+	}
+	return nil
+}
+
+// pruneObjects deletes the objects of the allowlisted kinds matching selector which were not applied. Namespaced
+// kinds are pruned in the namespaces of the applied objects only, like `kubectl apply --prune` does.
+// kubectl's own pruning can't be restricted to given kinds from outside its package in the client-go version
+// in use, hence this.
+func (c *client) pruneObjects(ctx context.Context, mapper meta.RESTMapper, selector string,
+	allowlist []schema.GroupVersionKind, applied *appliedObjects, dryRun bool, out io.Writer) error {
+	deleteOpts := kubeApiMeta.DeleteOptions{}
+	if dryRun {
+		deleteOpts.DryRun = []string{kubeApiMeta.DryRunAll}
+	}
+	var errs error
+	for _, gvk := range allowlist {
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("unable to prune %s: %v", gvk, err))
+			continue
+		}
+		namespaces := []string{kubeApiMeta.NamespaceNone}
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			namespaces = applied.namespaces.List()
+		}
+		resources := c.Dynamic().Resource(mapping.Resource)
+		for _, ns := range namespaces {
+			list, err := resources.Namespace(ns).List(ctx, kubeApiMeta.ListOptions{LabelSelector: selector})
+			if err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("unable to list %s to prune: %v", mapping.Resource.Resource, err))
+				continue
+			}
+			for _, item := range list.Items {
+				if applied.uids.Has(string(item.GetUID())) {
+					continue
+				}
+				err := resources.Namespace(ns).Delete(ctx, item.GetName(), deleteOpts)
+				if err != nil && !kubeApiErrors.IsNotFound(err) {
+					errs = multierror.Append(errs, fmt.Errorf("unable to prune %s %s: %v", mapping.Resource.Resource, item.GetName(), err))
+					continue
+				}
+				_, _ = fmt.Fprintf(out, "%s/%s pruned\n", strings.ToLower(gvk.Kind), item.GetName())
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,98 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestPruneObjects(t *testing.T) {
+	object := func(kind, name, uid string, objLabels map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"name": name, "namespace": "istio-system", "uid": uid, "labels": objLabels,
+			},
+		}}
+	}
+	owned := map[string]interface{}{"install.operator.istio.io/owning-resource": "installed-state"}
+	c := newFakeClient(
+		object("ConfigMap", "applied", "1", owned),
+		object("ConfigMap", "stale", "2", owned),
+		object("ConfigMap", "unlabeled", "3", nil),
+		object("Secret", "stale-secret", "4", owned),
+	)
+	configMapGVK := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	secretGVK := schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}})
+	mapper.Add(configMapGVK, meta.RESTScopeNamespace)
+	mapper.Add(secretGVK, meta.RESTScopeNamespace)
+	applied := &appliedObjects{uids: sets.NewString("1"), namespaces: sets.NewString("istio-system")}
+
+	out := &bytes.Buffer{}
+	err := c.pruneObjects(context.Background(), mapper, "install.operator.istio.io/owning-resource=installed-state",
+		[]schema.GroupVersionKind{configMapGVK}, applied, false, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "configmap/stale pruned\n"; got != want {
+		t.Fatalf("got output %q, want %q", got, want)
+	}
+
+	var remaining []string
+	for _, gvr := range []schema.GroupVersionResource{
+		{Version: "v1", Resource: "configmaps"}, {Version: "v1", Resource: "secrets"},
+	} {
+		list, err := c.Dynamic().Resource(gvr).Namespace("istio-system").List(context.Background(), kubeApiMeta.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range list.Items {
+			remaining = append(remaining, item.GetName())
+		}
+	}
+	sort.Strings(remaining)
+	// The labeled Secret is not allowlisted, so it survives.
+	if want := []string{"applied", "stale-secret", "unlabeled"}; !reflect.DeepEqual(remaining, want) {
+		t.Fatalf("got remaining objects %v, want %v", remaining, want)
+	}
+}
+
+func TestValidatePrune(t *testing.T) {
+	if err := validatePrune(ApplyOptions{}); err != nil {
+		t.Fatalf("unexpected error without pruning: %v", err)
+	}
+	if err := validatePrune(ApplyOptions{PruneSelector: "app=istio"}); err == nil {
+		t.Fatal("expected an error for pruning without an allowlist")
+	}
+	err := validatePrune(ApplyOptions{
+		PruneSelector:  "app=istio",
+		PruneAllowlist: []schema.GroupVersionKind{{Version: "v1", Kind: "ConfigMap"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// reachabilityTimeoutSeconds bounds the time the request of PodReachability may take in the source pod.
+const reachabilityTimeoutSeconds = "10"
+
+// errCommandNotFound is returned when the command exec'd in a pod is not installed in its container.
+var errCommandNotFound = errors.New("command not found")
+
+func (c *client) PodReachability(ctx context.Context, srcPod, srcNamespace, container,
+	targetURL string) (int, string, error) {
+	if container == "" {
+		pod, err := c.GetPod(ctx, srcNamespace, srcPod)
+		if err != nil {
+			return 0, "", err
+		}
+		container = defaultContainer(pod)
+	}
+
+	status, body, err := c.curlFromPod(ctx, srcPod, srcNamespace, container, targetURL)
+	if errors.Is(err, errCommandNotFound) {
+		status, body, err = c.wgetFromPod(ctx, srcPod, srcNamespace, container, targetURL)
+	}
+	if errors.Is(err, errCommandNotFound) {
+		return 0, "", fmt.Errorf("neither curl nor wget is available in the %s container of %s/%s",
+			container, srcNamespace, srcPod)
+	}
+	if err != nil {
+		return status, body, fmt.Errorf("unable to reach %s from %s/%s: %v", targetURL, srcNamespace, srcPod, err)
+	}
+	return status, body, nil
+}
+
+// execInPod runs the command in the container, returning errCommandNotFound if it is not installed.
+func (c *client) execInPod(ctx context.Context, podName, podNamespace, container string,
+	command []string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	err := c.podExecStream(ctx, podName, podNamespace, container, command, nil, &stdout, &stderr)
+	if err != nil && isCommandNotFound(err, stderr.String()) {
+		return "", "", fmt.Errorf("%s: %w", command[0], errCommandNotFound)
+	}
+	return stdout.String(), stderr.String(), err
+}
+
+// isCommandNotFound returns true if the exec error or output reports that the command is not installed.
+func isCommandNotFound(err error, stderr string) bool {
+	for _, msg := range []string{err.Error(), stderr} {
+		if strings.Contains(msg, "executable file not found") || strings.Contains(msg, "exit code 127") {
+			return true
+		}
+	}
+	return false
+}
+
+// curlFromPod requests the URL with curl, which writes the status code on the last line of the body.
+func (c *client) curlFromPod(ctx context.Context, podName, podNamespace, container, targetURL string) (int, string, error) {
+	stdout, stderr, err := c.execInPod(ctx, podName, podNamespace, container, []string{
+		"curl", "-sS", "--max-time", reachabilityTimeoutSeconds, "-w", "\n%{http_code}", targetURL,
+	})
+	if errors.Is(err, errCommandNotFound) {
+		return 0, "", err
+	}
+	if err != nil {
+		return 0, "", execError(err, stderr)
+	}
+	i := strings.LastIndex(stdout, "\n")
+	if i < 0 {
+		return 0, "", fmt.Errorf("unexpected curl output %q", stdout)
+	}
+	status, err := strconv.Atoi(stdout[i+1:])
+	if err != nil {
+		return 0, "", fmt.Errorf("unexpected curl output %q", stdout)
+	}
+	return status, stdout[:i], nil
+}
+
+// wgetFromPod requests the URL with wget, which prints the response headers on stderr. wget fails for
+// error statuses, which are still reported. The status of the last response wins, following redirects.
+func (c *client) wgetFromPod(ctx context.Context, podName, podNamespace, container, targetURL string) (int, string, error) {
+	stdout, stderr, err := c.execInPod(ctx, podName, podNamespace, container, []string{
+		"wget", "-q", "-S", "-O", "-", "-T", reachabilityTimeoutSeconds, targetURL,
+	})
+	if errors.Is(err, errCommandNotFound) {
+		return 0, "", err
+	}
+	status := 0
+	for _, line := range strings.Split(stderr, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "HTTP/") {
+			continue
+		}
+		if code, convErr := strconv.Atoi(fields[1]); convErr == nil {
+			status = code
+		}
+	}
+	if status != 0 {
+		return status, stdout, nil
+	}
+	if err != nil {
+		return 0, "", execError(err, stderr)
+	}
+	return 0, "", fmt.Errorf("no HTTP status in wget output %q", stderr)
+}
+
+// execError adds the output of the failed command to its error.
+func execError(err error, stderr string) error {
+	if stderr = strings.TrimSpace(stderr); stderr != "" {
+		return fmt.Errorf("%v: %s", err, stderr)
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// execResult is the output of a command exec'd in a pod.
+type execResult struct {
+	stdout, stderr string
+	err            error
+}
+
+func TestPodReachability(t *testing.T) {
+	const target = "http://reviews.default:9080/"
+	cases := []struct {
+		name       string
+		curl, wget *execResult
+		wantStatus int
+		wantBody   string
+		wantErr    string
+	}{
+		{
+			name:       "ok",
+			curl:       &execResult{stdout: "reviews-v1\n200"},
+			wantStatus: 200,
+			wantBody:   "reviews-v1",
+		},
+		{
+			name:       "error status",
+			curl:       &execResult{stdout: "no healthy upstream\n503"},
+			wantStatus: 503,
+			wantBody:   "no healthy upstream",
+		},
+		{
+			name: "connection refused",
+			curl: &execResult{
+				stdout: "\n000",
+				stderr: "curl: (7) Failed to connect to reviews.default port 9080: Connection refused\n",
+				err:    errors.New("command terminated with exit code 7"),
+			},
+			wantErr: "Connection refused",
+		},
+		{
+			name:       "wget fallback",
+			wget:       &execResult{stdout: "reviews-v1", stderr: "  HTTP/1.1 200 OK\n  content-type: text/plain\n"},
+			wantStatus: 200,
+			wantBody:   "reviews-v1",
+		},
+		{
+			name: "wget error status",
+			wget: &execResult{
+				stderr: "  HTTP/1.1 404 Not Found\nwget: server returned error: HTTP/1.1 404 Not Found\n",
+				err:    errors.New("command terminated with exit code 1"),
+			},
+			wantStatus: 404,
+		},
+		{
+			name:    "no client",
+			wantErr: "neither curl nor wget",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClient()
+			withFakeExec(t, c)
+			c.executorFactory = func(_ *rest.Config, _ string, u *url.URL) (remotecommand.Executor, error) {
+				command := u.Query()["command"]
+				return execFunc(func(opts remotecommand.StreamOptions) error {
+					if command[len(command)-1] != target {
+						t.Fatalf("unexpected command %v", command)
+					}
+					result := map[string]*execResult{"curl": tt.curl, "wget": tt.wget}[command[0]]
+					if result == nil {
+						return errors.New(`exec: "` + command[0] + `": executable file not found in $PATH`)
+					}
+					_, _ = io.WriteString(opts.Stdout, result.stdout)
+					_, _ = io.WriteString(opts.Stderr, result.stderr)
+					return result.err
+				}), nil
+			}
+
+			status, body, err := c.PodReachability(context.Background(), "productpage", "default", "istio-proxy", target)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != tt.wantStatus || body != tt.wantBody {
+				t.Fatalf("got %d %q, want %d %q", status, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	kubeApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
+)
+
+// RetryPolicy controls how requests to Istio components are retried on transient failures.
+type RetryPolicy struct {
+	// Attempts is the total number of attempts, including the first one. Values <= 1 disable retries.
+	Attempts int
+
+	// InitialBackoff is the delay before the first retry. It is doubled after every attempt.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between attempts. Zero means no cap.
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is the RetryPolicy used when none is configured on the client.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:       3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+}
+
+// do runs fn until it succeeds, returns an error rejected by retryable, runs out of attempts
+// or the context is done. The last error returned by fn is returned.
+func (p RetryPolicy) do(ctx context.Context, retryable func(error) bool, fn func() error) error {
+	backoff := p.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.Attempts || !retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+// retryOnConflict runs fn again when it fails with a conflict, caused by a concurrent modification of the
+// object it changes. fn must read the latest version of the object before changing it, and return the
+// errors of the API server unwrapped so that conflicts are recognized.
+func retryOnConflict(fn func() error) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, fn)
+}
+
+// isRetryableProxyError returns true if err is a connection failure, a timeout or a 5xx response.
+func isRetryableProxyError(err error) bool {
+	var status kubeApiErrors.APIStatus
+	if errors.As(err, &status) {
+		code := int(status.Status().Code)
+		return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests ||
+			kubeApiErrors.IsTimeout(err) || kubeApiErrors.IsServerTimeout(err)
+	}
+	// Transport failures (connection refused/reset, dial and read timeouts) surface as net.Error.
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,189 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Name and keys of the secret holding the plugged-in CA certificates used by istiod.
+const (
+	caCertsSecretName   = "cacerts"
+	caCertKey           = "ca-cert.pem"
+	caKeyKey            = "ca-key.pem"
+	caRootCertKey       = "root-cert.pem"
+	caCertChainKey      = "cert-chain.pem"
+	pemCertificateBlock = "CERTIFICATE"
+)
+
+func (c *client) GetSecret(ctx context.Context, namespace, name string) (*kubeApiCore.Secret, error) {
+	secret, err := c.CoreV1().Secrets(namespace).Get(ctx, name, kubeApiMeta.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get secret %s/%s: %v", namespace, name, err)
+	}
+	return secret, nil
+}
+
+func (c *client) GetCertFromSecret(ctx context.Context, namespace, name, key string) (*x509.Certificate, error) {
+	secret, err := c.GetSecret(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s has no key %q", namespace, name, key)
+	}
+	// Some tools store the PEM base64 encoded once more on top of the encoding of the secret data itself.
+	if decoded, err := base64.StdEncoding.DecodeString(string(data)); err == nil {
+		data = decoded
+	}
+	certs, err := parseCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("key %q of secret %s/%s does not hold a certificate: %v", key, namespace, name, err)
+	}
+	return certs[0], nil
+}
+
+func (c *client) RotateCACert(ctx context.Context, namespace string, newCert, newKey, newRoot []byte,
+	restartIstiod bool) error {
+	if err := validateCACert(newCert, newKey, newRoot); err != nil {
+		return fmt.Errorf("invalid CA certificate: %v", err)
+	}
+	data := map[string][]byte{
+		caCertKey:      newCert,
+		caKeyKey:       newKey,
+		caRootCertKey:  newRoot,
+		caCertChainKey: newCert,
+	}
+
+	secrets := c.CoreV1().Secrets(namespace)
+	err := retryOnConflict(func() error {
+		secret, err := secrets.Get(ctx, caCertsSecretName, kubeApiMeta.GetOptions{})
+		if kubeApiErrors.IsNotFound(err) {
+			_, err = secrets.Create(ctx, &kubeApiCore.Secret{
+				ObjectMeta: kubeApiMeta.ObjectMeta{Name: caCertsSecretName, Namespace: namespace},
+				Type:       kubeApiCore.SecretTypeOpaque,
+				Data:       data,
+			}, kubeApiMeta.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		for k, v := range data {
+			secret.Data[k] = v
+		}
+		_, err = secrets.Update(ctx, secret, kubeApiMeta.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to write secret %s/%s: %v", namespace, caCertsSecretName, err)
+	}
+	if !restartIstiod {
+		return nil
+	}
+	return c.restartIstiodDeployments(ctx, namespace)
+}
+
+// restartIstiodDeployments restarts the istiod deployments of every revision in the namespace.
+func (c *client) restartIstiodDeployments(ctx context.Context, namespace string) error {
+	deployments, err := c.AppsV1().Deployments(namespace).List(ctx, kubeApiMeta.ListOptions{
+		LabelSelector: "app=istiod",
+	})
+	if err != nil {
+		return fmt.Errorf("unable to list istiod deployments in %s: %v", namespace, err)
+	}
+	if len(deployments.Items) == 0 {
+		return fmt.Errorf("no istiod deployment to restart in %s", namespace)
+	}
+	for _, d := range deployments.Items {
+		if err := c.RestartDeployment(ctx, namespace, d.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateCACert checks that certPEM is a CA certificate (optionally followed by its intermediates) matching
+// keyPEM and chaining up to rootPEM.
+func validateCACert(certPEM, keyPEM, rootPEM []byte) error {
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		return fmt.Errorf("certificate and key do not match: %v", err)
+	}
+	chain, err := parseCertificates(certPEM)
+	if err != nil {
+		return err
+	}
+	if !chain[0].IsCA {
+		return errors.New("certificate is not a CA certificate")
+	}
+	roots, err := parseCertificates(rootPEM)
+	if err != nil {
+		return fmt.Errorf("invalid root certificate: %v", err)
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, root := range roots {
+		opts.Roots.AddCert(root)
+	}
+	for _, intermediate := range chain[1:] {
+		opts.Intermediates.AddCert(intermediate)
+	}
+	if _, err := chain[0].Verify(opts); err != nil {
+		return fmt.Errorf("certificate does not chain to the root certificate: %v", err)
+	}
+	return nil
+}
+
+// parseCertificates parses all the PEM encoded certificates in data.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != pemCertificateBlock {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+	return certs, nil
+}
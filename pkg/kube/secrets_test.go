@@ -0,0 +1,189 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert creates a certificate signed by parent, or a self-signed one if parent is nil.
+func newTestCert(t *testing.T, cn string, isCA bool, notAfter time.Time, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"cluster.local"}},
+		DNSNames:              []string{cn},
+		NotBefore:             notAfter.Add(-24 * time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: pemCertificateBlock, Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func TestRotateCACert(t *testing.T) {
+	expiry := time.Now().Add(365 * 24 * time.Hour)
+	root := newTestCert(t, "root", true, expiry, nil)
+	intermediate := newTestCert(t, "intermediate", true, expiry, root)
+	otherRoot := newTestCert(t, "other-root", true, expiry, nil)
+
+	cases := []struct {
+		name    string
+		cert    []byte
+		key     []byte
+		root    []byte
+		wantErr bool
+	}{
+		{name: "valid", cert: intermediate.certPEM, key: intermediate.keyPEM, root: root.certPEM},
+		{name: "mismatched key", cert: intermediate.certPEM, key: otherRoot.keyPEM, root: root.certPEM, wantErr: true},
+		{name: "wrong root", cert: intermediate.certPEM, key: intermediate.keyPEM, root: otherRoot.certPEM, wantErr: true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClient()
+			err := c.RotateCACert(context.Background(), "istio-system", tt.cert, tt.key, tt.root, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RotateCACert() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			secret, getErr := c.CoreV1().Secrets("istio-system").Get(context.Background(), caCertsSecretName, kubeApiMeta.GetOptions{})
+			if tt.wantErr {
+				if getErr == nil {
+					t.Fatalf("secret must not be written for invalid input: %v", secret.Data)
+				}
+				return
+			}
+			if getErr != nil {
+				t.Fatal(getErr)
+			}
+			if !bytes.Equal(secret.Data[caCertKey], tt.cert) || !bytes.Equal(secret.Data[caKeyKey], tt.key) ||
+				!bytes.Equal(secret.Data[caRootCertKey], tt.root) || !bytes.Equal(secret.Data[caCertChainKey], tt.cert) {
+				t.Fatalf("unexpected secret data: %v", secret.Data)
+			}
+		})
+	}
+}
+
+func TestRotateCACertRestartIstiod(t *testing.T) {
+	expiry := time.Now().Add(365 * 24 * time.Hour)
+	root := newTestCert(t, "root", true, expiry, nil)
+	intermediate := newTestCert(t, "intermediate", true, expiry, root)
+
+	c := newFakeClient(istiodDeployment("istiod", "istio-system"), istiodDeployment("istiod-canary", "istio-system"),
+		istiodDeployment("istiod", "istio-other"))
+	if err := c.RotateCACert(context.Background(), "istio-system", intermediate.certPEM, intermediate.keyPEM,
+		root.certPEM, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []struct{ namespace, name string }{
+		{"istio-system", "istiod"}, {"istio-system", "istiod-canary"}, {"istio-other", "istiod"},
+	} {
+		got, err := c.AppsV1().Deployments(d.namespace).Get(context.Background(), d.name, kubeApiMeta.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		restarted := got.Spec.Template.Annotations[restartedAtAnnotation] != ""
+		if want := d.namespace == "istio-system"; restarted != want {
+			t.Errorf("deployment %s/%s: got restarted %v, want %v", d.namespace, d.name, restarted, want)
+		}
+	}
+
+	// The secret is written, but there is no istiod to restart.
+	c = newFakeClient()
+	if err := c.RotateCACert(context.Background(), "istio-system", intermediate.certPEM, intermediate.keyPEM,
+		root.certPEM, true); err == nil {
+		t.Fatal("expected an error without an istiod deployment")
+	}
+}
+
+func TestGetCertFromSecret(t *testing.T) {
+	cert := newTestCert(t, "istio-ca", true, time.Now().Add(24*time.Hour), nil)
+	c := newFakeClient(&kubeApiCore.Secret{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: "istio-ca-secret", Namespace: "istio-system"},
+		Data: map[string][]byte{
+			caCertKey:   cert.certPEM,
+			"ca-b64":    []byte(base64.StdEncoding.EncodeToString(cert.certPEM)),
+			"not-a-pem": []byte("garbage"),
+		},
+	})
+
+	for _, key := range []string{caCertKey, "ca-b64"} {
+		got, err := c.GetCertFromSecret(context.Background(), "istio-system", "istio-ca-secret", key)
+		if err != nil {
+			t.Fatalf("key %s: %v", key, err)
+		}
+		if !got.Equal(cert.cert) {
+			t.Fatalf("key %s: got certificate for %q, want %q", key, got.Subject.CommonName, cert.cert.Subject.CommonName)
+		}
+	}
+
+	for _, tt := range []struct{ name, secret, key string }{
+		{name: "missing secret", secret: "missing", key: caCertKey},
+		{name: "missing key", secret: "istio-ca-secret", key: "tls.crt"},
+		{name: "not a certificate", secret: "istio-ca-secret", key: "not-a-pem"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := c.GetCertFromSecret(context.Background(), "istio-system", tt.secret, tt.key); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
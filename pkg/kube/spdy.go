@@ -18,12 +18,26 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	spdyStream "k8s.io/apimachinery/pkg/util/httpstream/spdy"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
 	"k8s.io/client-go/transport/spdy"
 )
 
+// executorFactory creates an executor for the exec request at the given URL.
+type executorFactory func(restConfig *rest.Config, method string, url *url.URL) (remotecommand.Executor, error)
+
+// newSPDYExecutor creates an executor streaming over SPDY.
+func newSPDYExecutor(restConfig *rest.Config, method string, url *url.URL) (remotecommand.Executor, error) {
+	wrapper, upgrader, err := roundTripperFor(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	return remotecommand.NewSPDYExecutorForTransports(wrapper, upgrader, method, url)
+}
+
 // roundTripperFor creates a SPDY upgrader that will work over custom transports.
 func roundTripperFor(restConfig *rest.Config) (http.RoundTripper, spdy.Upgrader, error) {
 	// Get the TLS config.
@@ -0,0 +1,144 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	kubeApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"istio.io/api/annotation"
+
+	"istio.io/istio/pkg/config/mesh"
+)
+
+// defaultTraceSampling is the sampling percentage used by istiod when nothing else is configured.
+// See PILOT_TRACE_SAMPLING.
+const defaultTraceSampling = 1.0
+
+var telemetryGVR = schema.GroupVersionResource{
+	Group:    "telemetry.istio.io",
+	Version:  "v1alpha1",
+	Resource: "telemetries",
+}
+
+func (c *client) GetEffectiveSamplingRate(ctx context.Context, namespace, podName string) (float64, error) {
+	pod, err := c.CoreV1().Pods(namespace).Get(ctx, podName, kubeApiMeta.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+	istioNamespace, err := c.DiscoverIstioNamespace(ctx)
+	if err != nil {
+		return 0, err
+	}
+	meshConfig, err := c.getMeshConfig(ctx, istioNamespace)
+	if err != nil {
+		return 0, err
+	}
+
+	// Telemetry resources take precedence over the proxy config, from the most to the least specific:
+	// a workload selector in the pod namespace, the pod namespace, then the root namespace.
+	rate, found, err := c.telemetrySamplingRate(ctx, namespace, pod.Labels)
+	if err != nil || found {
+		return rate, err
+	}
+	if meshConfig.RootNamespace != namespace {
+		rate, found, err = c.telemetrySamplingRate(ctx, meshConfig.RootNamespace, nil)
+		if err != nil || found {
+			return rate, err
+		}
+	}
+
+	proxyConfig := meshConfig.DefaultConfig
+	if override, ok := pod.Annotations[annotation.ProxyConfig.Name]; ok {
+		mc, err := mesh.ApplyProxyConfig(override, *meshConfig)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s annotation on %s/%s: %v", annotation.ProxyConfig.Name, namespace, podName, err)
+		}
+		proxyConfig = mc.DefaultConfig
+	}
+	if sampling := proxyConfig.GetTracing().GetSampling(); sampling != 0 {
+		return sampling, nil
+	}
+	return defaultTraceSampling, nil
+}
+
+// telemetrySamplingRate returns the sampling percentage set by the Telemetry resources in the namespace.
+// Resources with a selector matching podLabels win over namespace-wide ones; a nil podLabels only considers
+// namespace-wide resources. Ties are broken by the oldest resource.
+func (c *client) telemetrySamplingRate(ctx context.Context, namespace string, podLabels map[string]string) (float64, bool, error) {
+	list, err := c.Dynamic().Resource(telemetryGVR).Namespace(namespace).List(ctx, kubeApiMeta.ListOptions{})
+	if err != nil {
+		if kubeApiErrors.IsNotFound(err) {
+			// Telemetry API is not installed.
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("unable to list Telemetry resources in %s: %v", namespace, err)
+	}
+
+	items := list.Items
+	sort.SliceStable(items, func(i, j int) bool {
+		ti, tj := items[i].GetCreationTimestamp(), items[j].GetCreationTimestamp()
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		return items[i].GetName() < items[j].GetName()
+	})
+
+	var namespaceRate *float64
+	for i := range items {
+		rate, ok := telemetrySampling(&items[i])
+		if !ok {
+			continue
+		}
+		selector, hasSelector, _ := unstructured.NestedStringMap(items[i].Object, "spec", "selector", "matchLabels")
+		switch {
+		case !hasSelector || len(selector) == 0:
+			if namespaceRate == nil {
+				namespaceRate = &rate
+			}
+		case podLabels != nil && labels.SelectorFromSet(selector).Matches(labels.Set(podLabels)):
+			return rate, true, nil
+		}
+	}
+	if namespaceRate != nil {
+		return *namespaceRate, true, nil
+	}
+	return 0, false, nil
+}
+
+// telemetrySampling returns the first randomSamplingPercentage set in the tracing config of a Telemetry resource.
+func telemetrySampling(telemetry *unstructured.Unstructured) (float64, bool) {
+	tracing, _, _ := unstructured.NestedSlice(telemetry.Object, "spec", "tracing")
+	for _, t := range tracing {
+		tm, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch v := tm["randomSamplingPercentage"].(type) {
+		case float64:
+			return v, true
+		case int64:
+			return float64(v), true
+		}
+	}
+	return 0, false
+}
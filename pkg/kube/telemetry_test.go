@@ -0,0 +1,108 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"testing"
+
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func meshConfigMap(namespace, meshYAML string) *kubeApiCore.ConfigMap {
+	return &kubeApiCore.ConfigMap{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: meshConfigMapName, Namespace: namespace},
+		Data:       map[string]string{meshConfigMapKey: meshYAML},
+	}
+}
+
+func telemetry(name, namespace string, selector map[string]interface{}, sampling float64) *unstructured.Unstructured {
+	spec := map[string]interface{}{
+		"tracing": []interface{}{
+			map[string]interface{}{"randomSamplingPercentage": sampling},
+		},
+	}
+	if selector != nil {
+		spec["selector"] = map[string]interface{}{"matchLabels": selector}
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "telemetry.istio.io/v1alpha1",
+		"kind":       "Telemetry",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"spec":       spec,
+	}}
+}
+
+func TestGetEffectiveSamplingRate(t *testing.T) {
+	pod := &kubeApiCore.Pod{
+		ObjectMeta: kubeApiMeta.ObjectMeta{
+			Name:      "productpage",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "productpage"},
+		},
+	}
+	base := []runtime.Object{
+		pod,
+		istiodDeployment("istiod", "istio-system"),
+		meshConfigMap("istio-system", "defaultConfig:\n  tracing:\n    sampling: 5\n"),
+	}
+	cases := []struct {
+		name    string
+		objects []runtime.Object
+		want    float64
+	}{
+		{
+			name: "mesh default",
+			want: 5,
+		},
+		{
+			name:    "root namespace telemetry",
+			objects: []runtime.Object{telemetry("mesh-default", "istio-system", nil, 20)},
+			want:    20,
+		},
+		{
+			name: "namespace telemetry overrides root",
+			objects: []runtime.Object{
+				telemetry("mesh-default", "istio-system", nil, 20),
+				telemetry("namespace", "default", nil, 30),
+			},
+			want: 30,
+		},
+		{
+			name: "workload telemetry overrides namespace",
+			objects: []runtime.Object{
+				telemetry("namespace", "default", nil, 30),
+				telemetry("workload", "default", map[string]interface{}{"app": "productpage"}, 75),
+				telemetry("other-workload", "default", map[string]interface{}{"app": "reviews"}, 90),
+			},
+			want: 75,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClient(append(append([]runtime.Object{}, base...), tt.objects...)...)
+			got, err := c.GetEffectiveSamplingRate(context.Background(), "default", "productpage")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got sampling %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"net/http"
+	"time"
+)
+
+// RequestInfo describes a completed HTTP request made by a Client.
+type RequestInfo struct {
+	Method string
+	// Path is the URL path of the request, without the query.
+	Path     string
+	Duration time.Duration
+	// StatusCode of the response, or 0 if no response was received.
+	StatusCode int
+	// Err is the transport error of the request, if any.
+	Err error
+}
+
+// RequestLogger is called once for every request made by a Client to the API server or to an Envoy admin.
+type RequestLogger func(RequestInfo)
+
+// loggingRoundTripper reports each round trip of the wrapped transport to a RequestLogger.
+type loggingRoundTripper struct {
+	next   http.RoundTripper
+	logger RequestLogger
+}
+
+func newLoggingRoundTripper(next http.RoundTripper, logger RequestLogger) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &loggingRoundTripper{next: next, logger: logger}
+}
+
+func (t *loggingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	info := RequestInfo{
+		Method:   req.Method,
+		Path:     req.URL.Path,
+		Duration: time.Since(start),
+		Err:      err,
+	}
+	if resp != nil {
+		info.StatusCode = resp.StatusCode
+	}
+	t.logger(info)
+	return resp, err
+}
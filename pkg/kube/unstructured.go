@@ -0,0 +1,111 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func (c *client) GetUnstructured(ctx context.Context, gvr schema.GroupVersionResource,
+	namespace, name string) (*unstructured.Unstructured, error) {
+	obj, err := c.Dynamic().Resource(gvr).Namespace(namespace).Get(ctx, name, kubeApiMeta.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get %s %s/%s: %v", gvr.Resource, namespace, name, err)
+	}
+	return obj, nil
+}
+
+func (c *client) ListUnstructured(ctx context.Context, gvr schema.GroupVersionResource,
+	namespace string, opts kubeApiMeta.ListOptions) (*unstructured.UnstructuredList, error) {
+	list, err := c.Dynamic().Resource(gvr).Namespace(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list %s in namespace %q: %v", gvr.Resource, namespace, err)
+	}
+	return list, nil
+}
+
+func (c *client) ApplyUnstructured(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	mapper, err := c.clientFactory.ToRESTMapper()
+	if err != nil {
+		return nil, err
+	}
+	gvk := obj.GroupVersionKind()
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve the resource of %s: %v", gvk, err)
+	}
+	namespace := ""
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		namespace = obj.GetNamespace()
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	force := true
+	applied, err := c.Dynamic().Resource(mapping.Resource).Namespace(namespace).Patch(ctx, obj.GetName(),
+		types.ApplyPatchType, data, kubeApiMeta.PatchOptions{
+			FieldManager: fieldManager,
+			Force:        &force,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("unable to apply %s %s: %v", gvk.Kind, obj.GetName(), err)
+	}
+	return applied, nil
+}
+
+func (c *client) ListIstioResources(ctx context.Context, kind, namespace string) ([]unstructured.Unstructured, error) {
+	mapper, err := c.clientFactory.ToRESTMapper()
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := istioResourceMapping(mapper, kind)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		namespace = ""
+	}
+	list, err := c.ListUnstructured(ctx, mapping.Resource, namespace, kubeApiMeta.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// istioResourceMapping resolves a kind, such as VirtualService, to the mapping of the Istio resource of that
+// kind. The kind is matched case-insensitively, and Istio groups win over other groups serving the same kind,
+// such as the Kubernetes Gateway API.
+func istioResourceMapping(mapper meta.RESTMapper, kind string) (*meta.RESTMapping, error) {
+	kinds, err := mapper.KindsFor(schema.GroupVersionResource{Resource: strings.ToLower(kind)})
+	if err != nil {
+		return nil, fmt.Errorf("unknown kind %q: %v", kind, err)
+	}
+	for _, gvk := range kinds {
+		if gvk.Group == "istio.io" || strings.HasSuffix(gvk.Group, ".istio.io") {
+			return mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		}
+	}
+	return nil, fmt.Errorf("%q is not an Istio kind", kind)
+}
@@ -0,0 +1,170 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+var configMapsGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+func unstructuredConfigMap(name string, cmLabels map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "istio-system", "labels": cmLabels},
+	}}
+}
+
+func TestGetUnstructured(t *testing.T) {
+	c := newFakeClient(unstructuredConfigMap("istio", nil))
+
+	obj, err := c.GetUnstructured(context.Background(), configMapsGVR, "istio-system", "istio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetName() != "istio" || obj.GetKind() != "ConfigMap" {
+		t.Fatalf("got %s %s, want ConfigMap istio", obj.GetKind(), obj.GetName())
+	}
+	if _, err := c.GetUnstructured(context.Background(), configMapsGVR, "istio-system", "missing"); err == nil {
+		t.Fatal("expected an error for a missing resource")
+	}
+}
+
+func TestListUnstructured(t *testing.T) {
+	c := newFakeClient(
+		unstructuredConfigMap("istio", map[string]interface{}{"istio.io/rev": "default"}),
+		unstructuredConfigMap("istio-canary", map[string]interface{}{"istio.io/rev": "canary"}),
+	)
+
+	list, err := c.ListUnstructured(context.Background(), configMapsGVR, "istio-system",
+		kubeApiMeta.ListOptions{LabelSelector: "istio.io/rev=canary"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, item := range list.Items {
+		names = append(names, item.GetName())
+	}
+	if want := []string{"istio-canary"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got config maps %v, want %v", names, want)
+	}
+}
+
+func TestApplyUnstructured(t *testing.T) {
+	c := newFakeClient()
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}})
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	c.clientFactory.(*fakeFactory).mapper = mapper
+
+	// The fake dynamic client does not support server-side apply, so the patch is answered by a reactor.
+	var patches []k8sTesting.PatchActionImpl
+	c.Dynamic().(*dynamicfake.FakeDynamicClient).PrependReactor("patch", "configmaps",
+		func(action k8sTesting.Action) (bool, runtime.Object, error) {
+			patch := action.(k8sTesting.PatchActionImpl)
+			patches = append(patches, patch)
+			obj := &unstructured.Unstructured{}
+			return true, obj, json.Unmarshal(patch.GetPatch(), obj)
+		})
+
+	applied, err := c.ApplyUnstructured(context.Background(), unstructuredConfigMap("istio", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied.GetName() != "istio" {
+		t.Fatalf("got applied object %s, want istio", applied.GetName())
+	}
+	if len(patches) != 1 {
+		t.Fatalf("got %d patches, want 1", len(patches))
+	}
+	if patch := patches[0]; patch.GetPatchType() != types.ApplyPatchType ||
+		patch.GetNamespace() != "istio-system" || patch.GetName() != "istio" {
+		t.Fatalf("got %s patch of %s/%s, want an apply patch of istio-system/istio",
+			patch.GetPatchType(), patch.GetNamespace(), patch.GetName())
+	}
+
+	unknown := unstructuredConfigMap("istio", nil)
+	unknown.SetKind("Unknown")
+	if _, err := c.ApplyUnstructured(context.Background(), unknown); err == nil {
+		t.Fatal("expected an error for an unknown kind")
+	}
+}
+
+func TestListIstioResources(t *testing.T) {
+	istioObject := func(apiVersion, kind, name, namespace string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		}}
+	}
+	c := newFakeClient(
+		istioObject("networking.istio.io/v1beta1", "VirtualService", "reviews", "default"),
+		istioObject("networking.istio.io/v1beta1", "VirtualService", "ratings", "default"),
+		istioObject("networking.istio.io/v1beta1", "VirtualService", "istiod", "istio-system"),
+		istioObject("networking.istio.io/v1beta1", "Gateway", "bookinfo", "default"),
+		istioObject("gateway.networking.k8s.io/v1alpha1", "Gateway", "k8s-bookinfo", "default"),
+	)
+	networking := schema.GroupVersion{Group: "networking.istio.io", Version: "v1beta1"}
+	gatewayAPI := schema.GroupVersion{Group: "gateway.networking.k8s.io", Version: "v1alpha1"}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{gatewayAPI, networking})
+	mapper.Add(gatewayAPI.WithKind("Gateway"), meta.RESTScopeNamespace)
+	mapper.Add(networking.WithKind("VirtualService"), meta.RESTScopeNamespace)
+	mapper.Add(networking.WithKind("Gateway"), meta.RESTScopeNamespace)
+	c.clientFactory.(*fakeFactory).mapper = mapper
+
+	names := func(items []unstructured.Unstructured) []string {
+		var out []string
+		for _, item := range items {
+			out = append(out, item.GetName())
+		}
+		sort.Strings(out)
+		return out
+	}
+	cases := []struct {
+		kind string
+		want []string
+	}{
+		{kind: "VirtualService", want: []string{"ratings", "reviews"}},
+		{kind: "virtualservice", want: []string{"ratings", "reviews"}},
+		{kind: "Gateway", want: []string{"bookinfo"}},
+	}
+	for _, tt := range cases {
+		items, err := c.ListIstioResources(context.Background(), tt.kind, "default")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.kind, err)
+		}
+		if got := names(items); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s: got %v, want %v", tt.kind, got, tt.want)
+		}
+	}
+
+	if _, err := c.ListIstioResources(context.Background(), "DestinationRule", "default"); err == nil {
+		t.Fatal("expected an error for a kind which is not served")
+	}
+}
@@ -62,12 +62,14 @@ func BuildClientCmd(kubeconfig, context string) clientcmd.ClientConfig {
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
 	loadingRules.DefaultClientConfig = &clientcmd.DefaultClientConfig
 	loadingRules.ExplicitPath = kubeconfig
-	configOverrides := &clientcmd.ConfigOverrides{
+	configOverrides := clientcmd.ConfigOverrides{
 		ClusterDefaults: clientcmd.ClusterDefaults,
 		CurrentContext:  context,
 	}
 
-	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
+	return newOverridableClientConfig(configOverrides, func(overrides *clientcmd.ConfigOverrides) clientcmd.ClientConfig {
+		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+	})
 }
 
 // CreateClientset is a helper function that builds a kubernetes Clienset from a kubeconfig
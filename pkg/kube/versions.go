@@ -0,0 +1,100 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"istio.io/pkg/version"
+)
+
+// DefaultMaxMinorVersionSkew is the number of minor versions the client and the control plane are supported to
+// differ by.
+const DefaultMaxMinorVersionSkew = 1
+
+// VersionMismatch is a component of the control plane whose version is too far from the version of the client.
+type VersionMismatch struct {
+	// Component is the value of the istio label of the pods of the component, such as "pilot".
+	Component     string
+	ClientVersion string
+	ServerVersion string
+	// MinorVersionSkew is the number of minor versions the server is ahead of the client, negative if
+	// it is behind. It is zero if the major versions differ.
+	MinorVersionSkew int
+}
+
+func (c *client) CheckVersionCompatibility(ctx context.Context, namespace string, maxMinorSkew int) ([]VersionMismatch, error) {
+	if maxMinorSkew < 0 {
+		return nil, fmt.Errorf("invalid maximum minor version skew %d", maxMinorSkew)
+	}
+	clientMajor, clientMinor, ok := majorMinorVersion(version.Info.Version)
+	if !ok {
+		return nil, fmt.Errorf("unable to parse the client version %q", version.Info.Version)
+	}
+	servers, err := c.GetIstioVersions(ctx, namespace)
+	if servers == nil {
+		return nil, err
+	}
+
+	var mismatches []VersionMismatch
+	for _, server := range *servers {
+		major, minor, ok := majorMinorVersion(server.Info.Version)
+		if !ok {
+			// Development builds without a release version can't be compared.
+			continue
+		}
+		mismatch := VersionMismatch{
+			Component:     server.Component,
+			ClientVersion: version.Info.Version,
+			ServerVersion: server.Info.Version,
+		}
+		if major == clientMajor {
+			mismatch.MinorVersionSkew = minor - clientMinor
+			if abs(mismatch.MinorVersionSkew) <= maxMinorSkew {
+				continue
+			}
+		}
+		mismatches = append(mismatches, mismatch)
+	}
+	// The versions which could be retrieved are checked even if some components failed to report theirs.
+	return mismatches, err
+}
+
+// majorMinorVersion parses the major and minor version numbers of versions such as "1.7.0" or "1.8-alpha.1".
+func majorMinorVersion(v string) (int, int, bool) {
+	parts := strings.SplitN(v, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err := strconv.Atoi(strings.SplitN(parts[1], "-", 2)[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,93 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"istio.io/pkg/version"
+)
+
+func TestCheckVersionCompatibility(t *testing.T) {
+	clientVersion := version.Info.Version
+	version.Info.Version = "1.20.0"
+	t.Cleanup(func() { version.Info.Version = clientVersion })
+
+	versions := map[string]string{
+		"istiod-1":             "1.18.2-9c900ba74d10a1affe7c23557ef0eebd6103b03c-Clean",
+		"istiod-2":             "1.19.0-9c900ba74d10a1affe7c23557ef0eebd6103b03c-Clean",
+		"istio-ingressgateway": "1.20.1-9c900ba74d10a1affe7c23557ef0eebd6103b03c-Clean",
+	}
+	c := newTestServerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/namespaces/istio-system/pods" {
+			writeJSON(t, w, podList(
+				istioPod("istiod-1", "istio-system", "pilot"),
+				istioPod("istiod-2", "istio-system", "pilot"),
+				istioPod("istio-ingressgateway", "istio-system", "ingressgateway"),
+			))
+			return
+		}
+		for pod, v := range versions {
+			if r.URL.Path == "/api/v1/namespaces/istio-system/pods/"+pod+":15014/proxy/version" {
+				_, _ = w.Write([]byte(v))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+
+	mismatch := func(component, serverVersion string, skew int) VersionMismatch {
+		return VersionMismatch{
+			Component:        component,
+			ClientVersion:    "1.20.0",
+			ServerVersion:    serverVersion,
+			MinorVersionSkew: skew,
+		}
+	}
+	cases := []struct {
+		maxSkew int
+		want    []VersionMismatch
+	}{
+		{
+			maxSkew: 0,
+			want:    []VersionMismatch{mismatch("pilot", "1.18.2", -2), mismatch("pilot", "1.19.0", -1)},
+		},
+		{
+			maxSkew: DefaultMaxMinorVersionSkew,
+			want:    []VersionMismatch{mismatch("pilot", "1.18.2", -2)},
+		},
+		{
+			maxSkew: 2,
+		},
+	}
+	for _, tt := range cases {
+		mismatches, err := c.CheckVersionCompatibility(context.Background(), "istio-system", tt.maxSkew)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].ServerVersion < mismatches[j].ServerVersion })
+		if !reflect.DeepEqual(mismatches, tt.want) {
+			t.Errorf("maximum skew %d: got mismatches %+v, want %+v", tt.maxSkew, mismatches, tt.want)
+		}
+	}
+
+	if _, err := c.CheckVersionCompatibility(context.Background(), "istio-system", -1); err == nil {
+		t.Fatal("expected an error for a negative skew")
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func (c *client) WatchPods(ctx context.Context, namespace, labelSelector string,
+	onEvent func(watch.EventType, *kubeApiCore.Pod)) error {
+	resourceVersion := ""
+	for {
+		w, err := c.CoreV1().Pods(namespace).Watch(ctx, kubeApiMeta.ListOptions{
+			LabelSelector:   labelSelector,
+			ResourceVersion: resourceVersion,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("unable to watch pods in %s: %v", namespace, err)
+		}
+		resourceVersion, err = consumePodWatch(ctx, w, resourceVersion, onEvent)
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// consumePodWatch passes the pod events of w to onEvent until w is closed by the server or ctx is cancelled.
+// It returns the resource version to resume watching from.
+func consumePodWatch(ctx context.Context, w watch.Interface, resourceVersion string,
+	onEvent func(watch.EventType, *kubeApiCore.Pod)) (string, error) {
+	defer w.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return resourceVersion, nil
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				// The watch expired, it is re-established from the last seen version.
+				return resourceVersion, nil
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified, watch.Deleted:
+				pod, ok := event.Object.(*kubeApiCore.Pod)
+				if !ok {
+					continue
+				}
+				resourceVersion = pod.ResourceVersion
+				onEvent(event.Type, pod)
+			case watch.Error:
+				err := kubeApiErrors.FromObject(event.Object)
+				if kubeApiErrors.IsResourceExpired(err) || kubeApiErrors.IsGone(err) {
+					// The last seen version is too old. Restarting without one replays the current pods as Added.
+					return "", nil
+				}
+				return resourceVersion, fmt.Errorf("error watching pods: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+func TestWatchPods(t *testing.T) {
+	c := newFakeClient()
+	first, second := watch.NewFake(), watch.NewFake()
+	watchers := make(chan *watch.FakeWatcher, 2)
+	watchers <- first
+	watchers <- second
+	resourceVersions := make(chan string, 2)
+	c.Interface.(*fake.Clientset).PrependWatchReactor("pods", func(action k8sTesting.Action) (bool, watch.Interface, error) {
+		restrictions := action.(k8sTesting.WatchActionImpl).WatchRestrictions
+		if restrictions.Labels.String() != "app=istiod" {
+			return true, nil, fmt.Errorf("unexpected selector %q", restrictions.Labels)
+		}
+		resourceVersions <- restrictions.ResourceVersion
+		return true, <-watchers, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var got []string
+	done := make(chan error)
+	go func() {
+		done <- c.WatchPods(ctx, "istio-system", "app=istiod", func(event watch.EventType, pod *kubeApiCore.Pod) {
+			got = append(got, fmt.Sprintf("%s %s@%s", event, pod.Name, pod.ResourceVersion))
+			if event == watch.Deleted {
+				cancel()
+			}
+		})
+	}()
+
+	pod := func(rv string) *kubeApiCore.Pod {
+		return &kubeApiCore.Pod{ObjectMeta: kubeApiMeta.ObjectMeta{Name: "istiod-1", Namespace: "istio-system", ResourceVersion: rv}}
+	}
+	first.Add(pod("1"))
+	first.Modify(pod("2"))
+	// Expire the first watch, WatchPods must resume from the last seen version.
+	first.Stop()
+	second.Delete(pod("3"))
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ADDED istiod-1@1", "MODIFIED istiod-1@2", "DELETED istiod-1@3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got events %v, want %v", got, want)
+	}
+	if rv := []string{<-resourceVersions, <-resourceVersions}; !reflect.DeepEqual(rv, []string{"", "2"}) {
+		t.Fatalf("got watches from resource versions %v, want [\"\" 2]", rv)
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	kubeApiAdmission "k8s.io/api/admissionregistration/v1beta1"
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+
+	"istio.io/api/label"
+)
+
+const (
+	// sidecarInjectorSelector selects the MutatingWebhookConfigurations installed for each control plane revision.
+	sidecarInjectorSelector = "app=sidecar-injector"
+	// defaultRevision is the istio.io/rev label value of the control plane installed without a revision.
+	defaultRevision = "default"
+	// injectionLabel is the legacy namespace label enabling or disabling injection by the default revision.
+	injectionLabel = "istio-injection"
+)
+
+// WebhookMatch is a mutating webhook that would be invoked for a pod.
+type WebhookMatch struct {
+	// Configuration is the name of the MutatingWebhookConfiguration declaring the webhook.
+	Configuration string
+	// Name of the webhook within the configuration.
+	Name string
+	// ReinvocationPolicy is "IfNeeded" if the webhook is called again after later webhooks modify the pod.
+	ReinvocationPolicy string
+}
+
+// InjectionStatus describes how the labels of a namespace configure sidecar injection.
+type InjectionStatus struct {
+	// Enabled is true if pods created in the namespace are injected.
+	Enabled bool
+	// Revision is the control plane revision injecting the pods, empty if injection is not enabled.
+	Revision string
+	// Label is the namespace label deciding the status, empty if the namespace has neither injection label.
+	Label string
+}
+
+func (c *client) GetNamespaceLabels(ctx context.Context, namespace string) (map[string]string, error) {
+	ns, err := c.CoreV1().Namespaces().Get(ctx, namespace, kubeApiMeta.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get namespace %s: %v", namespace, err)
+	}
+	return ns.Labels, nil
+}
+
+func (c *client) AddNamespaceLabel(ctx context.Context, namespace, key, value string) error {
+	return c.patchNamespaceLabel(ctx, namespace, key, &value)
+}
+
+func (c *client) RemoveNamespaceLabel(ctx context.Context, namespace, key string) error {
+	return c.patchNamespaceLabel(ctx, namespace, key, nil)
+}
+
+// patchNamespaceLabel sets a single label of the namespace with a strategic merge patch, leaving the other labels
+// untouched. A nil value removes the label.
+func (c *client) patchNamespaceLabel(ctx context.Context, namespace, key string, value *string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]*string{key: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.CoreV1().Namespaces().Patch(ctx, namespace, types.StrategicMergePatchType, patch,
+		kubeApiMeta.PatchOptions{FieldManager: fieldManager})
+	if err != nil {
+		return fmt.Errorf("unable to patch labels of namespace %s: %v", namespace, err)
+	}
+	return nil
+}
+
+func (c *client) GetInjectionStatus(ctx context.Context, namespace string) (InjectionStatus, error) {
+	nsLabels, err := c.GetNamespaceLabels(ctx, namespace)
+	if err != nil {
+		return InjectionStatus{}, err
+	}
+	return injectionStatus(nsLabels), nil
+}
+
+// injectionStatus applies the selectors of the sidecar injector webhooks: the istio-injection label takes
+// precedence over istio.io/rev, and only its "enabled" value enables injection, by the default revision.
+func injectionStatus(nsLabels map[string]string) InjectionStatus {
+	if value, ok := nsLabels[injectionLabel]; ok {
+		if value != "enabled" {
+			return InjectionStatus{Label: injectionLabel}
+		}
+		return InjectionStatus{Enabled: true, Revision: defaultRevision, Label: injectionLabel}
+	}
+	if revision, ok := nsLabels[label.IstioRev]; ok {
+		return InjectionStatus{Enabled: true, Revision: revision, Label: label.IstioRev}
+	}
+	return InjectionStatus{}
+}
+
+func (c *client) CreateNamespaceWithInjection(ctx context.Context, name, revision string) error {
+	// istio-injection takes precedence over istio.io/rev, so only one of them is set.
+	setLabels := func(ns *kubeApiCore.Namespace) {
+		if ns.Labels == nil {
+			ns.Labels = map[string]string{}
+		}
+		if revision == "" {
+			ns.Labels[injectionLabel] = "enabled"
+			delete(ns.Labels, label.IstioRev)
+		} else {
+			ns.Labels[label.IstioRev] = revision
+			delete(ns.Labels, injectionLabel)
+		}
+	}
+
+	namespaces := c.CoreV1().Namespaces()
+	ns := &kubeApiCore.Namespace{ObjectMeta: kubeApiMeta.ObjectMeta{Name: name}}
+	setLabels(ns)
+	_, err := namespaces.Create(ctx, ns, kubeApiMeta.CreateOptions{FieldManager: fieldManager})
+	if err == nil {
+		return nil
+	}
+	if !kubeApiErrors.IsAlreadyExists(err) {
+		return fmt.Errorf("unable to create namespace %s: %v", name, err)
+	}
+
+	var getErr error
+	err = retryOnConflict(func() error {
+		ns, err := namespaces.Get(ctx, name, kubeApiMeta.GetOptions{})
+		if err != nil {
+			getErr = err
+			return err
+		}
+		setLabels(ns)
+		_, err = namespaces.Update(ctx, ns, kubeApiMeta.UpdateOptions{FieldManager: fieldManager})
+		return err
+	})
+	if getErr != nil {
+		return fmt.Errorf("unable to get namespace %s: %v", name, getErr)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to label namespace %s: %v", name, err)
+	}
+	return nil
+}
+
+func (c *client) GetMutatingWebhookOrder(ctx context.Context, namespace string, podLabels map[string]string) ([]WebhookMatch, error) {
+	ns, err := c.CoreV1().Namespaces().Get(ctx, namespace, kubeApiMeta.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get namespace %s: %v", namespace, err)
+	}
+	configs, err := c.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().List(ctx, kubeApiMeta.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list mutating webhook configurations: %v", err)
+	}
+
+	// The API server calls configurations ordered by name, and webhooks in the order they are declared.
+	items := configs.Items
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+
+	var matches []WebhookMatch
+	for _, config := range items {
+		for _, wh := range config.Webhooks {
+			matched, err := webhookMatchesPod(wh, ns.Labels, podLabels)
+			if err != nil {
+				return nil, fmt.Errorf("invalid selector in webhook %s/%s: %v", config.Name, wh.Name, err)
+			}
+			if !matched {
+				continue
+			}
+			policy := string(kubeApiAdmission.NeverReinvocationPolicy)
+			if wh.ReinvocationPolicy != nil {
+				policy = string(*wh.ReinvocationPolicy)
+			}
+			matches = append(matches, WebhookMatch{
+				Configuration:      config.Name,
+				Name:               wh.Name,
+				ReinvocationPolicy: policy,
+			})
+		}
+	}
+	return matches, nil
+}
+
+func (c *client) ResolveInjectingRevision(ctx context.Context, namespace string) (string, error) {
+	ns, err := c.CoreV1().Namespaces().Get(ctx, namespace, kubeApiMeta.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("unable to get namespace %s: %v", namespace, err)
+	}
+	configs, err := c.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().List(ctx, kubeApiMeta.ListOptions{
+		LabelSelector: sidecarInjectorSelector,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to list sidecar injector webhooks: %v", err)
+	}
+
+	found := map[string]struct{}{}
+	for _, config := range configs.Items {
+		for _, wh := range config.Webhooks {
+			// Pod labels are unknown, so the injector is evaluated for a pod without any.
+			matched, err := webhookMatchesPod(wh, ns.Labels, nil)
+			if err != nil {
+				return "", fmt.Errorf("invalid selector in webhook %s/%s: %v", config.Name, wh.Name, err)
+			}
+			if !matched {
+				continue
+			}
+			revision := config.Labels[label.IstioRev]
+			if revision == "" {
+				revision = defaultRevision
+			}
+			found[revision] = struct{}{}
+		}
+	}
+
+	revisions := make([]string, 0, len(found))
+	for revision := range found {
+		revisions = append(revisions, revision)
+	}
+	sort.Strings(revisions)
+	switch len(revisions) {
+	case 0:
+		return "", fmt.Errorf("pods in namespace %s are not injected by any revision", namespace)
+	case 1:
+		return revisions[0], nil
+	default:
+		return "", fmt.Errorf("pods in namespace %s are injected by multiple revisions: %v", namespace, revisions)
+	}
+}
+
+// webhookMatchesPod reports whether wh intercepts the creation of a pod with the given labels.
+func webhookMatchesPod(wh kubeApiAdmission.MutatingWebhook, namespaceLabels, podLabels map[string]string) (bool, error) {
+	if !rulesMatchPodCreate(wh.Rules) {
+		return false, nil
+	}
+	for _, s := range []struct {
+		selector *kubeApiMeta.LabelSelector
+		labels   map[string]string
+	}{
+		{wh.NamespaceSelector, namespaceLabels},
+		{wh.ObjectSelector, podLabels},
+	} {
+		// An unset selector matches everything.
+		if s.selector == nil {
+			continue
+		}
+		selector, err := kubeApiMeta.LabelSelectorAsSelector(s.selector)
+		if err != nil {
+			return false, err
+		}
+		if !selector.Matches(labels.Set(s.labels)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (c *client) GetInjectionWebhook(ctx context.Context, revision string) (*kubeApiAdmission.MutatingWebhookConfiguration, error) {
+	if revision == "" {
+		revision = defaultRevision
+	}
+	configs, err := c.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().List(ctx, kubeApiMeta.ListOptions{
+		LabelSelector: sidecarInjectorSelector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list sidecar injector webhooks: %v", err)
+	}
+
+	var matches []*kubeApiAdmission.MutatingWebhookConfiguration
+	for i := range configs.Items {
+		configRevision := configs.Items[i].Labels[label.IstioRev]
+		if configRevision == "" {
+			configRevision = defaultRevision
+		}
+		if configRevision == revision {
+			matches = append(matches, &configs.Items[i])
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no sidecar injector webhook found for revision %s", revision)
+	case 1:
+		return matches[0], nil
+	default:
+		names := make([]string, 0, len(matches))
+		for _, config := range matches {
+			names = append(names, config.Name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("multiple sidecar injector webhooks found for revision %s: %v", revision, names)
+	}
+}
+
+func (c *client) PreviewInjection(ctx context.Context, namespace string, podTemplate kubeApiCore.PodTemplateSpec) (*kubeApiCore.PodSpec, error) {
+	// A dry run create goes through admission, including the injection webhook, without persisting the pod.
+	pod := &kubeApiCore.Pod{
+		ObjectMeta: *podTemplate.ObjectMeta.DeepCopy(),
+		Spec:       *podTemplate.Spec.DeepCopy(),
+	}
+	pod.Namespace = namespace
+	if pod.Name == "" && pod.GenerateName == "" {
+		pod.GenerateName = "injection-preview-"
+	}
+	injected, err := c.CoreV1().Pods(namespace).Create(ctx, pod, kubeApiMeta.CreateOptions{
+		DryRun: []string{kubeApiMeta.DryRunAll},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("dry run of pod creation in namespace %s failed: %v", namespace, err)
+	}
+	return &injected.Spec, nil
+}
+
+func rulesMatchPodCreate(rules []kubeApiAdmission.RuleWithOperations) bool {
+	for _, rule := range rules {
+		if containsAny(rule.APIGroups, "") && containsAny(rule.APIVersions, "v1") &&
+			containsAny(rule.Resources, "pods") && operationsInclude(rule.Operations, kubeApiAdmission.Create) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAny reports whether values contains value or the "*" wildcard.
+func containsAny(values []string, value string) bool {
+	for _, v := range values {
+		if v == value || v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func operationsInclude(ops []kubeApiAdmission.OperationType, op kubeApiAdmission.OperationType) bool {
+	for _, o := range ops {
+		if o == op || o == kubeApiAdmission.OperationAll {
+			return true
+		}
+	}
+	return false
+}
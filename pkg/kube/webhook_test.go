@@ -0,0 +1,359 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	kubeApiAdmission "k8s.io/api/admissionregistration/v1beta1"
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+func mutatingWebhook(name string, nsSelector, objSelector *kubeApiMeta.LabelSelector) kubeApiAdmission.MutatingWebhook {
+	reinvoke := kubeApiAdmission.IfNeededReinvocationPolicy
+	return kubeApiAdmission.MutatingWebhook{
+		Name: name,
+		Rules: []kubeApiAdmission.RuleWithOperations{{
+			Operations: []kubeApiAdmission.OperationType{kubeApiAdmission.Create},
+			Rule: kubeApiAdmission.Rule{
+				APIGroups:   []string{""},
+				APIVersions: []string{"v1"},
+				Resources:   []string{"pods"},
+			},
+		}},
+		NamespaceSelector:  nsSelector,
+		ObjectSelector:     objSelector,
+		ReinvocationPolicy: &reinvoke,
+	}
+}
+
+func TestCreateNamespaceWithInjection(t *testing.T) {
+	cases := []struct {
+		name     string
+		existing *kubeApiCore.Namespace
+		revision string
+		want     map[string]string
+	}{
+		{name: "legacy label", want: map[string]string{"istio-injection": "enabled"}},
+		{name: "revision label", revision: "canary", want: map[string]string{"istio.io/rev": "canary"}},
+		{
+			name: "existing namespace switched to revision",
+			existing: &kubeApiCore.Namespace{ObjectMeta: kubeApiMeta.ObjectMeta{
+				Name:   "test",
+				Labels: map[string]string{"istio-injection": "enabled", "team": "bookinfo"},
+			}},
+			revision: "canary",
+			want:     map[string]string{"istio.io/rev": "canary", "team": "bookinfo"},
+		},
+		{
+			name: "existing namespace switched to legacy",
+			existing: &kubeApiCore.Namespace{ObjectMeta: kubeApiMeta.ObjectMeta{
+				Name:   "test",
+				Labels: map[string]string{"istio.io/rev": "canary"},
+			}},
+			want: map[string]string{"istio-injection": "enabled"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if tt.existing != nil {
+				objects = append(objects, tt.existing)
+			}
+			c := newFakeClient(objects...)
+			if err := c.CreateNamespaceWithInjection(context.Background(), "test", tt.revision); err != nil {
+				t.Fatal(err)
+			}
+			ns, err := c.CoreV1().Namespaces().Get(context.Background(), "test", kubeApiMeta.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ns.Labels, tt.want) {
+				t.Fatalf("got labels %v, want %v", ns.Labels, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMutatingWebhookOrder(t *testing.T) {
+	c := newFakeClient(
+		&kubeApiCore.Namespace{ObjectMeta: kubeApiMeta.ObjectMeta{
+			Name:   "default",
+			Labels: map[string]string{"istio-injection": "enabled"},
+		}},
+		&kubeApiAdmission.MutatingWebhookConfiguration{
+			ObjectMeta: kubeApiMeta.ObjectMeta{Name: "vault-agent-injector"},
+			Webhooks: []kubeApiAdmission.MutatingWebhook{
+				mutatingWebhook("vault.hashicorp.com", nil, &kubeApiMeta.LabelSelector{
+					MatchLabels: map[string]string{"vault": "true"},
+				}),
+			},
+		},
+		&kubeApiAdmission.MutatingWebhookConfiguration{
+			ObjectMeta: kubeApiMeta.ObjectMeta{Name: "istio-sidecar-injector"},
+			Webhooks: []kubeApiAdmission.MutatingWebhook{
+				mutatingWebhook("sidecar-injector.istio.io", &kubeApiMeta.LabelSelector{
+					MatchLabels: map[string]string{"istio-injection": "enabled"},
+				}, nil),
+				mutatingWebhook("rev.sidecar-injector.istio.io", &kubeApiMeta.LabelSelector{
+					MatchLabels: map[string]string{"istio.io/rev": "canary"},
+				}, nil),
+			},
+		},
+	)
+
+	got, err := c.GetMutatingWebhookOrder(context.Background(), "default", map[string]string{"app": "foo", "vault": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []WebhookMatch{
+		{Configuration: "istio-sidecar-injector", Name: "sidecar-injector.istio.io", ReinvocationPolicy: "IfNeeded"},
+		{Configuration: "vault-agent-injector", Name: "vault.hashicorp.com", ReinvocationPolicy: "IfNeeded"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func sidecarInjector(revision string, nsSelector *kubeApiMeta.LabelSelector) *kubeApiAdmission.MutatingWebhookConfiguration {
+	name := "istio-sidecar-injector"
+	if revision != defaultRevision {
+		name += "-" + revision
+	}
+	return &kubeApiAdmission.MutatingWebhookConfiguration{
+		ObjectMeta: kubeApiMeta.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"app": "sidecar-injector", "istio.io/rev": revision},
+		},
+		Webhooks: []kubeApiAdmission.MutatingWebhook{mutatingWebhook("sidecar-injector.istio.io", nsSelector, nil)},
+	}
+}
+
+func TestResolveInjectingRevision(t *testing.T) {
+	namespace := func(name string, labels map[string]string) *kubeApiCore.Namespace {
+		return &kubeApiCore.Namespace{ObjectMeta: kubeApiMeta.ObjectMeta{Name: name, Labels: labels}}
+	}
+	c := newFakeClient(
+		namespace("legacy", map[string]string{"istio-injection": "enabled"}),
+		namespace("canary", map[string]string{"istio.io/rev": "canary"}),
+		namespace("both", map[string]string{"istio-injection": "enabled", "istio.io/rev": "canary"}),
+		namespace("none", nil),
+		sidecarInjector(defaultRevision, &kubeApiMeta.LabelSelector{
+			MatchLabels: map[string]string{"istio-injection": "enabled"},
+		}),
+		sidecarInjector("canary", &kubeApiMeta.LabelSelector{
+			MatchExpressions: []kubeApiMeta.LabelSelectorRequirement{
+				{Key: "istio-injection", Operator: kubeApiMeta.LabelSelectorOpDoesNotExist},
+				{Key: "istio.io/rev", Operator: kubeApiMeta.LabelSelectorOpIn, Values: []string{"canary"}},
+			},
+		}),
+		// Not a sidecar injector, must be ignored.
+		&kubeApiAdmission.MutatingWebhookConfiguration{
+			ObjectMeta: kubeApiMeta.ObjectMeta{Name: "other"},
+			Webhooks:   []kubeApiAdmission.MutatingWebhook{mutatingWebhook("other.example.com", nil, nil)},
+		},
+	)
+
+	cases := []struct {
+		namespace string
+		want      string
+		wantErr   bool
+	}{
+		{namespace: "legacy", want: defaultRevision},
+		{namespace: "canary", want: "canary"},
+		{namespace: "both", want: defaultRevision},
+		{namespace: "none", wantErr: true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.namespace, func(t *testing.T) {
+			got, err := c.ResolveInjectingRevision(context.Background(), tt.namespace)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveInjectingRevision() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("got revision %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetInjectionWebhook(t *testing.T) {
+	unlabeled := sidecarInjector(defaultRevision, nil)
+	delete(unlabeled.Labels, "istio.io/rev")
+	c := newFakeClient(
+		unlabeled,
+		sidecarInjector("canary", nil),
+		sidecarInjector("stable", nil),
+		&kubeApiAdmission.MutatingWebhookConfiguration{ObjectMeta: kubeApiMeta.ObjectMeta{
+			Name:   "other-injector",
+			Labels: map[string]string{"istio.io/rev": "canary"},
+		}},
+	)
+
+	cases := []struct {
+		revision string
+		want     string
+	}{
+		{revision: "", want: "istio-sidecar-injector"},
+		{revision: "default", want: "istio-sidecar-injector"},
+		{revision: "canary", want: "istio-sidecar-injector-canary"},
+		{revision: "stable", want: "istio-sidecar-injector-stable"},
+	}
+	for _, tt := range cases {
+		config, err := c.GetInjectionWebhook(context.Background(), tt.revision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Name != tt.want {
+			t.Fatalf("revision %q: got webhook %s, want %s", tt.revision, config.Name, tt.want)
+		}
+	}
+
+	if _, err := c.GetInjectionWebhook(context.Background(), "missing"); err == nil {
+		t.Fatal("expected an error for a revision without webhook")
+	}
+}
+
+func TestPreviewInjection(t *testing.T) {
+	c := newFakeClient()
+	c.Interface.(*fake.Clientset).PrependReactor("create", "pods", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		// Stand in for the sidecar injector called during admission.
+		pod := action.(k8sTesting.CreateAction).GetObject().(*kubeApiCore.Pod).DeepCopy()
+		if pod.Namespace != "default" {
+			t.Errorf("got pod created in namespace %q, want default", pod.Namespace)
+		}
+		pod.Spec.InitContainers = append(pod.Spec.InitContainers, kubeApiCore.Container{Name: "istio-init"})
+		pod.Spec.Containers = append(pod.Spec.Containers, kubeApiCore.Container{Name: "istio-proxy"})
+		return true, pod, nil
+	})
+
+	spec, err := c.PreviewInjection(context.Background(), "default", kubeApiCore.PodTemplateSpec{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Labels: map[string]string{"app": "productpage"}},
+		Spec: kubeApiCore.PodSpec{
+			Containers: []kubeApiCore.Container{{Name: "productpage", Image: "productpage:v1"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, container := range spec.Containers {
+		names = append(names, container.Name)
+	}
+	if want := []string{"productpage", "istio-proxy"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got containers %v, want %v", names, want)
+	}
+	if len(spec.InitContainers) != 1 || spec.InitContainers[0].Name != "istio-init" {
+		t.Fatalf("got init containers %v, want istio-init", spec.InitContainers)
+	}
+}
+
+func TestGetInjectionStatus(t *testing.T) {
+	namespace := func(name string, nsLabels map[string]string) *kubeApiCore.Namespace {
+		return &kubeApiCore.Namespace{ObjectMeta: kubeApiMeta.ObjectMeta{Name: name, Labels: nsLabels}}
+	}
+	c := newFakeClient(
+		namespace("enabled", map[string]string{"istio-injection": "enabled"}),
+		namespace("disabled", map[string]string{"istio-injection": "disabled"}),
+		namespace("revision", map[string]string{"istio.io/rev": "canary"}),
+		namespace("both", map[string]string{"istio-injection": "disabled", "istio.io/rev": "canary"}),
+		namespace("unlabeled", nil),
+	)
+
+	cases := []struct {
+		namespace string
+		want      InjectionStatus
+	}{
+		{"enabled", InjectionStatus{Enabled: true, Revision: "default", Label: "istio-injection"}},
+		{"disabled", InjectionStatus{Label: "istio-injection"}},
+		{"revision", InjectionStatus{Enabled: true, Revision: "canary", Label: "istio.io/rev"}},
+		{"both", InjectionStatus{Label: "istio-injection"}},
+		{"unlabeled", InjectionStatus{}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.namespace, func(t *testing.T) {
+			got, err := c.GetInjectionStatus(context.Background(), tt.namespace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := c.GetInjectionStatus(context.Background(), "missing"); err == nil {
+		t.Fatal("expected an error for a missing namespace")
+	}
+}
+
+func TestNamespaceLabels(t *testing.T) {
+	c := newFakeClient(&kubeApiCore.Namespace{ObjectMeta: kubeApiMeta.ObjectMeta{
+		Name:   "default",
+		Labels: map[string]string{"team": "bookinfo", "istio-injection": "enabled"},
+	}})
+	ctx := context.Background()
+
+	cases := []struct {
+		name   string
+		change func() error
+		want   map[string]string
+	}{
+		{
+			name:   "add",
+			change: func() error { return c.AddNamespaceLabel(ctx, "default", "istio.io/rev", "canary") },
+			want:   map[string]string{"team": "bookinfo", "istio-injection": "enabled", "istio.io/rev": "canary"},
+		},
+		{
+			name:   "overwrite",
+			change: func() error { return c.AddNamespaceLabel(ctx, "default", "istio.io/rev", "stable") },
+			want:   map[string]string{"team": "bookinfo", "istio-injection": "enabled", "istio.io/rev": "stable"},
+		},
+		{
+			name:   "remove",
+			change: func() error { return c.RemoveNamespaceLabel(ctx, "default", "istio-injection") },
+			want:   map[string]string{"team": "bookinfo", "istio.io/rev": "stable"},
+		},
+		{
+			name:   "remove missing",
+			change: func() error { return c.RemoveNamespaceLabel(ctx, "default", "istio-injection") },
+			want:   map[string]string{"team": "bookinfo", "istio.io/rev": "stable"},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.change(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := c.GetNamespaceLabels(ctx, "default")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got labels %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if err := c.AddNamespaceLabel(ctx, "missing", "istio.io/rev", "canary"); err == nil {
+		t.Fatal("expected an error for a missing namespace")
+	}
+}
@@ -16,14 +16,27 @@ package kube
 
 import (
 	"context"
+	"crypto/x509"
 	"fmt"
+	"io"
 
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	listenerv3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"k8s.io/api/admissionregistration/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	kubeVersion "k8s.io/apimachinery/pkg/version"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/kubectl/pkg/cmd/util"
 
 	"istio.io/pkg/version"
 
@@ -44,10 +57,125 @@ type MockClient struct {
 	IstioVersions    *version.MeshInfo
 }
 
+func (c MockClient) GetProxyServerInfo(_ context.Context, _, _ string) (*kube.ServerInfo, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement proxy server info")
+}
+
+func (c MockClient) DrainProxy(_ context.Context, _, _ string) error {
+	return fmt.Errorf("TODO MockClient doesn't implement proxy shutdown")
+}
+
+func (c MockClient) QuitProxy(_ context.Context, _, _ string) error {
+	return fmt.Errorf("TODO MockClient doesn't implement proxy shutdown")
+}
+
+func (c MockClient) GetProxyLogLevels(_ context.Context, _, _ string) (map[string]string, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement proxy log levels")
+}
+
+func (c MockClient) SetProxyLogLevel(_ context.Context, _, _, _, _ string) error {
+	return fmt.Errorf("TODO MockClient doesn't implement proxy log levels")
+}
+
+func (c MockClient) GetProxyRuntime(_ context.Context, _, _ string) (map[string]string, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement proxy runtime")
+}
+
+func (c MockClient) GetProxyMemory(_ context.Context, _, _ string) (*kube.MemoryStats, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement proxy memory")
+}
+
+func (c MockClient) ProxyAdminRequest(_ context.Context, _, _, _, _ string) ([]byte, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement proxy admin requests")
+}
+
+func (c MockClient) GetUnstructured(_ context.Context, _ schema.GroupVersionResource,
+	_, _ string) (*unstructured.Unstructured, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement GetUnstructured")
+}
+
+func (c MockClient) ListUnstructured(_ context.Context, _ schema.GroupVersionResource,
+	_ string, _ metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement ListUnstructured")
+}
+
+func (c MockClient) ApplyUnstructured(_ context.Context, _ *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement ApplyUnstructured")
+}
+
+func (c MockClient) ListIstioResources(_ context.Context, _, _ string) ([]unstructured.Unstructured, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement ListIstioResources")
+}
+
+func (c MockClient) GetProxyConfigStatus(_ context.Context, _, _ string) (*kube.ConfigStatus, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement GetProxyConfigStatus")
+}
+
+func (c MockClient) GetProxyConnections(_ context.Context, _, _ string) (int64, int64, error) {
+	return 0, 0, fmt.Errorf("TODO MockClient doesn't implement GetProxyConnections")
+}
+
+func (c MockClient) GetInjectionTemplate(_ context.Context, _, _ string) (string, error) {
+	return "", fmt.Errorf("TODO MockClient doesn't implement GetInjectionTemplate")
+}
+
+func (c MockClient) GetProxyRestartEpoch(_ context.Context, _, _ string) (int, error) {
+	return 0, fmt.Errorf("TODO MockClient doesn't implement GetProxyRestartEpoch")
+}
+
+func (c MockClient) ListGatewayAPIGateways(_ context.Context, _ string) ([]unstructured.Unstructured, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement ListGatewayAPIGateways")
+}
+
+func (c MockClient) ListHTTPRoutes(_ context.Context, _ string) ([]unstructured.Unstructured, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement ListHTTPRoutes")
+}
+
+func (c MockClient) ListOpenShiftRoutes(_ context.Context, _ string) ([]unstructured.Unstructured, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement ListOpenShiftRoutes")
+}
+
+func (c MockClient) IsProxyReady(_ context.Context, _, _ string, _ ...kube.EnvoyDoOption) (bool, string, error) {
+	return false, "", fmt.Errorf("TODO MockClient doesn't implement proxy readiness")
+}
+
+func (c MockClient) DiscoveryDo(_ context.Context, pilotName, _, _ string) ([]byte, error) {
+	res, ok := c.Results[pilotName]
+	if !ok {
+		return nil, fmt.Errorf("unable to find Pilot %s", pilotName)
+	}
+	return res, nil
+}
+
 func (c MockClient) AllDiscoveryDo(_ context.Context, _, _ string) (map[string][]byte, error) {
 	return c.Results, nil
 }
 
+func (c MockClient) DiscoverIstioNamespace(_ context.Context) (string, error) {
+	return "", fmt.Errorf("TODO MockClient doesn't implement namespace discovery")
+}
+
+func (c MockClient) CheckIstiodConsistency(_ context.Context, _ string) (bool, map[string]string, error) {
+	return false, nil, fmt.Errorf("TODO MockClient doesn't implement istiod consistency checks")
+}
+
+func (c MockClient) GetProxySyncStatus(_ context.Context, _ string) ([]kube.SyncStatus, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement sync status")
+}
+
+func (c MockClient) WatchProxySyncStatus(_ context.Context, _ string, _ func([]kube.SyncStatus),
+	_ ...kube.SyncStatusWatchOption) error {
+	return fmt.Errorf("TODO MockClient doesn't implement sync status watches")
+}
+
+func (c MockClient) FindProxyController(_ context.Context, _, _ string) (string, error) {
+	return "", fmt.Errorf("TODO MockClient doesn't implement FindProxyController")
+}
+
+func (c MockClient) GetDeltaXDSStats(_ context.Context, _ string) ([]kube.DeltaXDSStat, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement delta xDS stats")
+}
+
 func (c MockClient) EnvoyDo(_ context.Context, podName, _, _, _ string, _ []byte) ([]byte, error) {
 	results, ok := c.Results[podName]
 	if !ok {
@@ -56,6 +184,11 @@ func (c MockClient) EnvoyDo(_ context.Context, podName, _, _, _ string, _ []byte
 	return results, nil
 }
 
+func (c MockClient) EnvoyDoWithOptions(ctx context.Context, podName, podNamespace, method, path string, body []byte,
+	_ ...kube.EnvoyDoOption) ([]byte, error) {
+	return c.EnvoyDo(ctx, podName, podNamespace, method, path, body)
+}
+
 func (c MockClient) RESTConfig() *rest.Config {
 	return c.ConfigValue
 }
@@ -64,6 +197,37 @@ func (c MockClient) GetIstioVersions(_ context.Context, _ string) (*version.Mesh
 	return c.IstioVersions, nil
 }
 
+func (c MockClient) GetIstioPodVersions(_ context.Context, _ string) ([]kube.PodVersion, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement IstioPodVersions")
+}
+
+func (c MockClient) CheckVersionCompatibility(_ context.Context, _ string, _ int) ([]kube.VersionMismatch, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement version compatibility")
+}
+
+func (c MockClient) GetEffectiveSamplingRate(_ context.Context, _, _ string) (float64, error) {
+	return 0, fmt.Errorf("TODO MockClient doesn't implement sampling rates")
+}
+
+func (c MockClient) ListPodsByProxyVersion(_ context.Context, _, _ string) ([]v1.Pod, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement proxy versions")
+}
+
+func (c MockClient) GetProxyLocality(_ context.Context, _, _ string) (kube.Locality, error) {
+	return kube.Locality{}, fmt.Errorf("TODO MockClient doesn't implement proxy locality")
+}
+
+func (c MockClient) GetPod(_ context.Context, namespace, name string) (*v1.Pod, error) {
+	for _, pods := range c.DiscoverablePods[namespace] {
+		for i := range pods.Items {
+			if pods.Items[i].Name == name {
+				return &pods.Items[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("pod %s/%s not found", namespace, name)
+}
+
 func (c MockClient) PodsForSelector(_ context.Context, namespace string, labelSelectors ...string) (*v1.PodList, error) {
 	podsForNamespace, ok := c.DiscoverablePods[namespace]
 	if !ok {
@@ -90,14 +254,163 @@ func (c MockClient) REST() rest.Interface {
 	panic("not implemented by mock")
 }
 
+func (c MockClient) RESTClientFor(_ schema.GroupVersion) (rest.Interface, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement REST clients")
+}
+
+func (c MockClient) GetProxyStats(_ context.Context, _, _ string, _ string,
+	_ ...kube.ProxyStatsOption) (map[string]float64, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement proxy stats")
+}
+
+func (c MockClient) GetProxyEndpoints(_ context.Context, _, _, _ string) ([]kube.Endpoint, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement proxy endpoints")
+}
+
+func (c MockClient) GetProxyLoadBalancingWeights(_ context.Context, _, _, _ string) ([]kube.EndpointWeight, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement load balancing weights")
+}
+
+func (c MockClient) GetProxyListeners(_ context.Context, _, _ string) ([]*listenerv3.Listener, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement proxy listeners")
+}
+
+func (c MockClient) GetProxyListenerErrors(_ context.Context, _, _ string) ([]kube.ListenerError, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement proxy listener errors")
+}
+
+func (c MockClient) ResolveProxyCluster(_ context.Context, _, _, _ string, _ int) (string, bool, error) {
+	return "", false, fmt.Errorf("TODO MockClient doesn't implement proxy clusters")
+}
+
+func (c MockClient) GetProxyRoutes(_ context.Context, _, _ string) ([]*routev3.RouteConfiguration, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement proxy routes")
+}
+
+func (c MockClient) GetProxyCerts(_ context.Context, _, _ string) ([]kube.ProxyCert, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement proxy certs")
+}
+
+func (c MockClient) GetProxyBootstrap(_ context.Context, _, _ string) ([]byte, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement bootstrap")
+}
+
+func (c MockClient) GetProxyConfigDumpFiltered(_ context.Context, _, _, _, _ string) ([]byte, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement config dumps")
+}
+
+func (c MockClient) GetAllProxyConfigDumps(_ context.Context, _ string) (map[string][]byte, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement config dumps")
+}
+
+func (c MockClient) DiffProxyConfig(_ context.Context, _, _, _, _ string) (string, error) {
+	return "", fmt.Errorf("TODO MockClient doesn't implement DiffProxyConfig")
+}
+
+func (c MockClient) GetProxyInboundCluster(_ context.Context, _, _ string, _ int) (*clusterv3.Cluster, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement inbound clusters")
+}
+
+func (c MockClient) GetProxyCircuitBreakerStatus(_ context.Context, _, _ string) ([]kube.CircuitBreakerStatus, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement circuit breaker status")
+}
+
+func (c MockClient) GetExtensionProviders(_ context.Context, _ string) ([]kube.ExtensionProvider, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement extension providers")
+}
+
+func (c MockClient) GetNamespaceLabels(_ context.Context, _ string) (map[string]string, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement namespace labels")
+}
+
+func (c MockClient) AddNamespaceLabel(_ context.Context, _, _, _ string) error {
+	return fmt.Errorf("TODO MockClient doesn't implement namespace labels")
+}
+
+func (c MockClient) RemoveNamespaceLabel(_ context.Context, _, _ string) error {
+	return fmt.Errorf("TODO MockClient doesn't implement namespace labels")
+}
+
+func (c MockClient) GetInjectionStatus(_ context.Context, _ string) (kube.InjectionStatus, error) {
+	return kube.InjectionStatus{}, fmt.Errorf("TODO MockClient doesn't implement injection status")
+}
+
+func (c MockClient) CreateNamespaceWithInjection(_ context.Context, _, _ string) error {
+	return fmt.Errorf("TODO MockClient doesn't implement namespace creation")
+}
+
+func (c MockClient) GetMutatingWebhookOrder(_ context.Context, _ string, _ map[string]string) ([]kube.WebhookMatch, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement webhook ordering")
+}
+
+func (c MockClient) ResolveInjectingRevision(_ context.Context, _ string) (string, error) {
+	return "", fmt.Errorf("TODO MockClient doesn't implement revision resolution")
+}
+
+func (c MockClient) GetInjectionWebhook(_ context.Context, _ string) (*v1beta1.MutatingWebhookConfiguration, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement injection webhooks")
+}
+
+func (c MockClient) PreviewInjection(_ context.Context, _ string, _ v1.PodTemplateSpec) (*v1.PodSpec, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement injection preview")
+}
+
+func (c MockClient) GetDeployment(_ context.Context, _, _ string) (*appsv1.Deployment, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement deployments")
+}
+
+func (c MockClient) ListIstioDeployments(_ context.Context, _ string) ([]appsv1.Deployment, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement deployments")
+}
+
+func (c MockClient) ScaleDeployment(_ context.Context, _, _ string, _ int32) error {
+	return fmt.Errorf("TODO MockClient doesn't implement deployment scaling")
+}
+
+func (c MockClient) RestartDeployment(_ context.Context, _, _ string) error {
+	return fmt.Errorf("TODO MockClient doesn't implement deployment restarts")
+}
+
+func (c MockClient) GetSecret(_ context.Context, _, _ string) (*v1.Secret, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement secret retrieval")
+}
+
+func (c MockClient) GetCertFromSecret(_ context.Context, _, _, _ string) (*x509.Certificate, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement secret retrieval")
+}
+
+func (c MockClient) RotateCACert(_ context.Context, _ string, _, _, _ []byte, _ bool) error {
+	return fmt.Errorf("TODO MockClient doesn't implement CA rotation")
+}
+
+func (c MockClient) WaitForCRDsEstablished(_ context.Context, _ ...string) error {
+	return fmt.Errorf("TODO MockClient doesn't implement CRD waits")
+}
+
 func (c MockClient) ApplyYAMLFiles(string, ...string) error {
 	panic("not implemented by mock")
 }
 
+func (c MockClient) ApplyYAMLDir(_, _ string, _ bool) error {
+	return fmt.Errorf("TODO MockClient doesn't implement ApplyYAMLDir")
+}
+
 func (c MockClient) ApplyYAMLFilesDryRun(string, ...string) error {
 	panic("not implemented by mock")
 }
 
+func (c MockClient) ApplyYAMLDryRunResult(context.Context, string, io.Reader) ([]*unstructured.Unstructured, error) {
+	panic("not implemented by mock")
+}
+
+func (c MockClient) ApplyYAMLFilesWithOptions(string, kube.ApplyOptions, ...string) error {
+	panic("not implemented by mock")
+}
+
+func (c MockClient) DiffYAMLFiles(context.Context, string, ...string) (string, error) {
+	panic("not implemented by mock")
+}
+
 func (c MockClient) DeleteYAMLFiles(string, ...string) error {
 	panic("not implemented by mock")
 }
@@ -106,6 +419,18 @@ func (c MockClient) DeleteYAMLFilesDryRun(string, ...string) error {
 	panic("not implemented by mock")
 }
 
+func (c MockClient) DeleteYAMLFilesWithOptions(string, kube.DeleteOptions, ...string) error {
+	panic("not implemented by mock")
+}
+
+func (c MockClient) DeleteByLabel(_ context.Context, _, _ string, _ ...schema.GroupVersionResource) error {
+	return fmt.Errorf("TODO MockClient doesn't implement delete")
+}
+
+func (c MockClient) WaitForResourceDeleted(_ context.Context, _ schema.GroupVersionResource, _, _ string) error {
+	return fmt.Errorf("TODO MockClient doesn't implement delete")
+}
+
 func (c MockClient) Ext() clientset.Interface {
 	panic("not implemented by mock")
 }
@@ -114,22 +439,87 @@ func (c MockClient) Dynamic() dynamic.Interface {
 	panic("not implemented by mock")
 }
 
+func (c MockClient) Factory() util.Factory {
+	panic("not implemented by mock")
+}
+
+func (c MockClient) Preflight(_ context.Context, _ string) error {
+	return fmt.Errorf("TODO MockClient doesn't implement preflight")
+}
+
 func (c MockClient) GetKubernetesVersion() (*kubeVersion.Info, error) {
 	return nil, fmt.Errorf("TODO MockClient doesn't implement kubernetes version")
 }
 
+func (c MockClient) DetectCNI(_ context.Context) (kube.CNIInfo, error) {
+	return kube.CNIInfo{}, fmt.Errorf("TODO MockClient doesn't implement CNI detection")
+}
+
+func (c MockClient) WatchPods(_ context.Context, _, _ string, _ func(watch.EventType, *v1.Pod)) error {
+	return fmt.Errorf("TODO MockClient doesn't implement pod watches")
+}
+
 func (c MockClient) GetIstioPods(_ context.Context, _ string, _ map[string]string) ([]v1.Pod, error) {
 	return nil, fmt.Errorf("TODO MockClient doesn't implement IstioPods")
 }
 
-func (c MockClient) PodExec(_, _, _ string, _ string) (string, string, error) {
+func (c MockClient) GetIstioPodsRunning(_ context.Context, _ string, _ map[string]string) ([]v1.Pod, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement IstioPods")
+}
+
+func (c MockClient) GetGatewayPods(_ context.Context, _, _ string) ([]v1.Pod, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement IstioPods")
+}
+
+func (c MockClient) GetIstioPodsMatching(_ context.Context, _ string, _ []labels.Selector) ([]v1.Pod, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement IstioPods")
+}
+
+func (c MockClient) PodExecWithEnv(_ context.Context, _, _, _ string, _ map[string]string, _ []string) (string, string, error) {
+	return "", "", fmt.Errorf("TODO MockClient doesn't implement PodExecWithEnv")
+}
+
+func (c MockClient) PodExecCombined(_ context.Context, _, _, _, _ string) (string, error) {
+	return "", fmt.Errorf("TODO MockClient doesn't implement PodExecCombined")
+}
+
+func (c MockClient) PodReachability(_ context.Context, _, _, _, _ string) (int, string, error) {
+	return 0, "", fmt.Errorf("TODO MockClient doesn't implement PodReachability")
+}
+
+func (c MockClient) PodExec(_, _, _ string, _ string, _ ...kube.PodExecOption) (string, string, error) {
 	return "", "", fmt.Errorf("TODO MockClient doesn't implement exec")
 }
 
+func (c MockClient) CopyToPod(_ context.Context, _, _, _, _, _ string) error {
+	return fmt.Errorf("TODO MockClient doesn't implement copy")
+}
+
+func (c MockClient) CopyFromPod(_ context.Context, _, _, _, _, _ string) error {
+	return fmt.Errorf("TODO MockClient doesn't implement copy")
+}
+
 func (c MockClient) PodLogs(_ context.Context, _ string, _ string, _ string, _ bool) (string, error) {
 	return "", fmt.Errorf("TODO MockClient doesn't implement logs")
 }
 
-func (c MockClient) NewPortForwarder(_, _, _ string, _, _ int) (kube.PortForwarder, error) {
+func (c MockClient) GetCrashedContainerLogs(_ context.Context, _, _, _ string) (string, int32, error) {
+	return "", 0, fmt.Errorf("TODO MockClient doesn't implement logs")
+}
+
+func (c MockClient) CollectLogs(_ context.Context, _, _, _ string, _ int64) (map[string]string, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement logs")
+}
+
+func (c MockClient) AllContainerLogs(_ context.Context, _, _ string) (map[string]string, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement logs")
+}
+
+func (c MockClient) NewPortForwarder(_, _, _ string, _, _ int, _ ...kube.PortForwarderOption) (kube.PortForwarder, error) {
 	return nil, fmt.Errorf("TODO MockClient doesn't implement port forwarding")
 }
+
+func (c MockClient) NewServicePortForwarder(_, _, _ string, _, _ int,
+	_ ...kube.PortForwarderOption) (kube.PortForwarder, error) {
+	return nil, fmt.Errorf("TODO MockClient doesn't implement service port forwarding")
+}